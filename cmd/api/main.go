@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -26,6 +27,8 @@ func main() {
 	}
 
 	a := app.New(db, cfg)
+	a.StartJobs(context.Background())
+
 	mux := a.SetupRoutes()
 
 	fmt.Println("Uade API running on port:", cfg.Port)
@@ -1,49 +1,231 @@
 package app
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/railanbaigazy/uade-api/internal/app/middleware"
 	"github.com/railanbaigazy/uade-api/internal/config"
 	"github.com/railanbaigazy/uade-api/internal/handlers"
+	"github.com/railanbaigazy/uade-api/internal/jobs"
+	"github.com/railanbaigazy/uade-api/internal/mailer"
+	"github.com/railanbaigazy/uade-api/internal/oidc"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/ratelimit"
+	"github.com/railanbaigazy/uade-api/internal/rbac"
+	"github.com/railanbaigazy/uade-api/internal/storage"
 )
 
 type App struct {
-	DB  *sqlx.DB
-	Cfg *config.Config
+	DB         *sqlx.DB
+	Cfg        *config.Config
+	Mailer     mailer.Mailer
+	UserStates *middleware.UserStateStore
+	RateLimits *middleware.RateLimiter
+	Providers  map[string]*oidc.Provider
+	Storage    storage.Storage
 }
 
 func New(db *sqlx.DB, cfg *config.Config) *App {
-	return &App{DB: db, Cfg: cfg}
+	var store ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "postgres" {
+		store = ratelimit.NewPostgresStore(db)
+	}
+
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = oidc.NewProvider(p, nil)
+	}
+
+	return &App{
+		DB:         db,
+		Cfg:        cfg,
+		Mailer:     mailer.New(cfg),
+		UserStates: middleware.NewUserStateStore(db, cfg.UserStateCacheTTL),
+		RateLimits: middleware.NewRateLimiter(store, cfg.RateLimitRoutes),
+		Providers:  providers,
+		Storage:    storage.NewDir(cfg.StorageDir),
+	}
+}
+
+// apiKeyScopes lists the routes API keys may call and the scope each needs.
+// All other routes, such as managing sessions, two-factor authentication or
+// API keys themselves, require logging in.
+var apiKeyScopes = map[string]string{
+	"GET /api/users/me":             principal.ScopeRead,
+	"GET /api/users/me/trust-score": principal.ScopeRead,
+	"GET /api/users/me/posts":       principal.ScopeRead,
+	"GET /api/notifications":        principal.ScopeRead,
+	"GET /api/users/{id}":           principal.ScopeRead,
+	"GET /api/users/{id}/reviews":   principal.ScopeRead,
+
+	"GET /api/posts":              principal.ScopeRead,
+	"POST /api/posts":             principal.ScopePostsWrite,
+	"PUT /api/posts/{id}":         principal.ScopePostsWrite,
+	"DELETE /api/posts/{id}":      principal.ScopePostsWrite,
+	"POST /api/posts/{id}/report": principal.ScopePostsWrite,
+
+	"GET /api/agreements":               principal.ScopeRead,
+	"GET /api/agreements/{id}":          principal.ScopeRead,
+	"POST /api/agreements":              principal.ScopeAgreementsWrite,
+	"POST /api/agreements/{id}/accept":  principal.ScopeAgreementsWrite,
+	"POST /api/agreements/{id}/cancel":  principal.ScopeAgreementsWrite,
+	"PUT /api/agreements/{id}/contract": principal.ScopeAgreementsWrite,
+	"POST /api/agreements/{id}/review":  principal.ScopeAgreementsWrite,
+	"POST /api/reviews/{id}/report":     principal.ScopeAgreementsWrite,
 }
 
 func (a *App) SetupRoutes() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /healthz", handlers.HealthzHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", handlers.JWKSHandler(a.Cfg.JWTKeys))
 
-	authHandler := handlers.NewAuthHandler(a.DB, a.Cfg)
-	userHandler := handlers.NewUserHandler(a.DB)
-	postHandler := handlers.NewPostHandler(a.DB)
-	agreementHandler := handlers.NewAgreementHandler(a.DB)
+	authHandler := handlers.NewAuthHandler(a.DB, a.Cfg, a.Mailer)
+	oidcHandler := handlers.NewOIDCHandler(authHandler, a.Providers)
+	userHandler := handlers.NewUserHandler(a.DB, a.Cfg, a.Mailer)
+	sessionHandler := handlers.NewSessionHandler(a.DB)
+	apiKeyHandler := handlers.NewAPIKeyHandler(a.DB)
+	twoFactorHandler := handlers.NewTwoFactorHandler(a.DB, a.Cfg)
+	postHandler := handlers.NewPostHandler(a.DB, a.Cfg)
+	agreementHandler := handlers.NewAgreementHandler(a.DB, a.Cfg)
+	reviewHandler := handlers.NewReviewHandler(a.DB)
+	adminHandler := handlers.NewAdminHandler(a.DB, a.UserStates)
+	kycHandler := handlers.NewKYCHandler(a.DB, a.Storage, adminHandler)
+	accountHandler := handlers.NewAccountHandler(a.DB, a.Storage)
+	notificationHandler := handlers.NewNotificationHandler(a.DB)
 
-	mux.HandleFunc("POST /api/auth/register", authHandler.Register)
-	mux.HandleFunc("POST /api/auth/login", authHandler.Login)
+	sessions := middleware.NewSessionStore(a.DB)
+	apiKeys := middleware.NewAPIKeyStore(a.DB)
+	auth := func(h http.HandlerFunc) http.Handler {
+		return middleware.JWTAuth(a.Cfg.JWTKeys, sessions, apiKeys,
+			middleware.RequireScope(apiKeyScopes,
+				middleware.RateLimit(a.RateLimits, a.Cfg.RateLimitDefault, middleware.ByUser,
+					middleware.ActiveUser(a.UserStates, h))))
+	}
+	byIP := func(h http.Handler) http.Handler {
+		return middleware.RateLimit(a.RateLimits, a.Cfg.RateLimitAuth, middleware.ByIP, h)
+	}
+	can := func(perm rbac.Permission, h http.HandlerFunc) http.Handler {
+		return auth(middleware.RequirePermission(perm, h).ServeHTTP)
+	}
+	verified := func(perm rbac.Permission, h http.HandlerFunc) http.Handler {
+		return can(perm, middleware.RequireVerifiedEmail(a.DB, h).ServeHTTP)
+	}
 
-	mux.Handle("GET /api/users/me", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(userHandler.Profile)))
+	mux.Handle("POST /api/auth/register", byIP(http.HandlerFunc(authHandler.Register)))
+	mux.Handle("POST /api/auth/login", byIP(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("POST /api/auth/login/2fa", byIP(http.HandlerFunc(authHandler.LoginTwoFactor)))
+	mux.Handle("POST /api/auth/unlock", byIP(http.HandlerFunc(authHandler.UnlockAccount)))
+	mux.Handle("POST /api/auth/refresh", byIP(http.HandlerFunc(authHandler.Refresh)))
+	mux.Handle("POST /api/auth/logout", byIP(http.HandlerFunc(authHandler.Logout)))
+	mux.Handle("POST /api/auth/password/forgot", byIP(http.HandlerFunc(authHandler.ForgotPassword)))
+	mux.Handle("POST /api/auth/password/reset", byIP(http.HandlerFunc(authHandler.ResetPassword)))
+	mux.Handle("POST /api/auth/verify-email", byIP(http.HandlerFunc(authHandler.VerifyEmail)))
+	mux.Handle("POST /api/auth/verify-email/resend", byIP(auth(authHandler.ResendVerification)))
+	mux.HandleFunc("GET /api/auth/oidc/providers", oidcHandler.ListProviders)
+	mux.Handle("POST /api/auth/oidc/{provider}/start", byIP(http.HandlerFunc(oidcHandler.Start)))
+	mux.Handle("POST /api/auth/oidc/{provider}/callback", byIP(http.HandlerFunc(oidcHandler.Callback)))
 
-	mux.Handle("GET /api/posts", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(postHandler.GetAll)))
-	mux.Handle("POST /api/posts", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(postHandler.Create)))
-	mux.Handle("PUT /api/posts/{id}", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(postHandler.Update)))
-	mux.Handle("DELETE /api/posts/{id}", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(postHandler.Delete)))
+	mux.Handle("GET /api/users/me", auth(userHandler.Profile))
+	mux.Handle("PATCH /api/users/me", auth(userHandler.UpdateProfile))
+	mux.Handle("DELETE /api/users/me", auth(accountHandler.Delete))
+	mux.Handle("POST /api/users/me/password", auth(userHandler.ChangePassword))
+	mux.Handle("POST /api/users/me/export", auth(accountHandler.Export))
+	mux.Handle("GET /api/users/me/trust-score", auth(userHandler.TrustScore))
+	mux.Handle("GET /api/users/me/posts", auth(postHandler.Mine))
+	mux.Handle("GET /api/users/me/notification-settings", auth(notificationHandler.Settings))
+	mux.Handle("PUT /api/users/me/notification-settings", auth(notificationHandler.UpdateSettings))
+	mux.Handle("GET /api/users/me/kyc", auth(kycHandler.Status))
+	mux.Handle("POST /api/users/me/kyc", auth(kycHandler.Submit))
+	mux.Handle("GET /api/users/{id}", auth(userHandler.PublicProfile))
+	mux.Handle("GET /api/users/me/sessions", auth(sessionHandler.List))
+	mux.Handle("DELETE /api/users/me/sessions", auth(sessionHandler.RevokeAll))
+	mux.Handle("DELETE /api/users/me/sessions/{id}", auth(sessionHandler.Revoke))
+	mux.Handle("GET /api/users/me/api-keys", auth(apiKeyHandler.List))
+	mux.Handle("POST /api/users/me/api-keys", auth(apiKeyHandler.Create))
+	mux.Handle("DELETE /api/users/me/api-keys/{id}", auth(apiKeyHandler.Revoke))
+	mux.Handle("POST /api/users/me/2fa/setup", auth(twoFactorHandler.Setup))
+	mux.Handle("POST /api/users/me/2fa/enable", auth(twoFactorHandler.Enable))
+	mux.Handle("POST /api/users/me/2fa/disable", auth(twoFactorHandler.Disable))
+	mux.Handle("POST /api/users/me/2fa/recovery-codes", auth(twoFactorHandler.RegenerateRecoveryCodes))
 
-	mux.Handle("GET /api/agreements", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(agreementHandler.GetUserAgreements)))
-	mux.Handle("GET /api/agreements/{id}", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(agreementHandler.GetByID)))
-	mux.Handle("POST /api/agreements", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(agreementHandler.Create)))
-	mux.Handle("POST /api/agreements/{id}/accept", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(agreementHandler.Accept)))
-	mux.Handle("POST /api/agreements/{id}/cancel", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(agreementHandler.Cancel)))
-	mux.Handle("PUT /api/agreements/{id}/contract", middleware.JWTAuth(a.Cfg.JWTSecret, http.HandlerFunc(agreementHandler.UpdateContract)))
+	mux.Handle("GET /api/posts", auth(postHandler.GetAll))
+	mux.Handle("POST /api/posts", verified(rbac.PostsCreate, postHandler.Create))
+	mux.Handle("PUT /api/posts/{id}", auth(postHandler.Update))
+	mux.Handle("POST /api/posts/{id}/report", auth(postHandler.Report))
+	mux.Handle("DELETE /api/posts/{id}", auth(postHandler.Delete))
+
+	mux.Handle("GET /api/agreements", auth(agreementHandler.GetUserAgreements))
+	mux.Handle("GET /api/agreements/{id}", auth(agreementHandler.GetByID))
+	mux.Handle("POST /api/agreements", verified(rbac.AgreementsCreate, agreementHandler.Create))
+	mux.Handle("POST /api/agreements/{id}/accept", verified(rbac.AgreementsCreate, agreementHandler.Accept))
+	mux.Handle("POST /api/agreements/{id}/cancel", auth(agreementHandler.Cancel))
+	mux.Handle("PUT /api/agreements/{id}/contract", auth(agreementHandler.UpdateContract))
+	mux.Handle("POST /api/agreements/{id}/review", auth(reviewHandler.Create))
+
+	mux.Handle("GET /api/users/{id}/reviews", auth(reviewHandler.ListForUser))
+	mux.Handle("POST /api/reviews/{id}/report", auth(reviewHandler.Report))
+
+	mux.Handle("GET /api/notifications", auth(notificationHandler.List))
+	mux.Handle("POST /api/notifications/{id}/read", auth(notificationHandler.MarkRead))
+	mux.Handle("POST /api/notifications/read-all", auth(notificationHandler.MarkAllRead))
+
+	mux.Handle("GET /api/admin/users", can(rbac.UsersView, adminHandler.SearchUsers))
+	mux.Handle("GET /api/admin/users/{id}", can(rbac.UsersView, adminHandler.GetUser))
+	mux.Handle("GET /api/admin/users/{id}/posts", can(rbac.UsersView, adminHandler.GetUserPosts))
+	mux.Handle("GET /api/admin/users/{id}/agreements", can(rbac.UsersView, adminHandler.GetUserAgreements))
+	mux.Handle("PUT /api/admin/users/{id}/role", can(rbac.UsersManageRoles, adminHandler.ChangeRole))
+	mux.Handle("POST /api/admin/users/{id}/block", can(rbac.UsersManage, adminHandler.BlockUser))
+	mux.Handle("POST /api/admin/users/{id}/suspend", can(rbac.UsersManage, adminHandler.SuspendUser))
+	mux.Handle("POST /api/admin/users/{id}/unblock", can(rbac.UsersManage, adminHandler.UnblockUser))
+	mux.Handle("POST /api/admin/users/{id}/logout", can(rbac.UsersManage, adminHandler.ForceLogout))
+	mux.Handle("DELETE /api/admin/users/{id}", can(rbac.UsersManage, adminHandler.DeleteUser))
+	mux.Handle("POST /api/admin/users/{id}/restore", can(rbac.UsersManage, adminHandler.RestoreUser))
+	mux.Handle("GET /api/admin/posts", can(rbac.PostsModerate, adminHandler.PostQueue))
+	mux.Handle("GET /api/admin/posts/{id}/reports", can(rbac.PostsModerate, adminHandler.PostReports))
+	mux.Handle("POST /api/admin/posts/{id}/approve", can(rbac.PostsModerate, adminHandler.ApprovePost))
+	mux.Handle("POST /api/admin/posts/{id}/reject", can(rbac.PostsModerate, adminHandler.RejectPost))
+	mux.Handle("POST /api/admin/posts/{id}/restore", can(rbac.PostsModerate, adminHandler.RestorePost))
+	mux.Handle("GET /api/admin/reviews", can(rbac.ReviewsModerate, adminHandler.ReviewQueue))
+	mux.Handle("GET /api/admin/reviews/{id}/reports", can(rbac.ReviewsModerate, adminHandler.ReviewReports))
+	mux.Handle("POST /api/admin/reviews/{id}/hide", can(rbac.ReviewsModerate, adminHandler.HideReview))
+	mux.Handle("POST /api/admin/reviews/{id}/restore", can(rbac.ReviewsModerate, adminHandler.RestoreReview))
+	mux.Handle("GET /api/admin/kyc", can(rbac.KYCReview, kycHandler.Queue))
+	mux.Handle("GET /api/admin/kyc/{id}", can(rbac.KYCReview, kycHandler.Get))
+	mux.Handle("GET /api/admin/kyc/{id}/documents/{kind}", can(rbac.KYCReview, kycHandler.Document))
+	mux.Handle("POST /api/admin/kyc/{id}/approve", can(rbac.KYCReview, kycHandler.Approve))
+	mux.Handle("POST /api/admin/kyc/{id}/reject", can(rbac.KYCReview, kycHandler.Reject))
+	mux.Handle("GET /api/admin/audit-log", can(rbac.UsersManage, adminHandler.AuditLog))
 
 	return mux
 }
+
+// StartJobs launches the background jobs. They stop when ctx is cancelled.
+func (a *App) StartJobs(ctx context.Context) {
+	go jobs.Every(ctx, "purge-soft-deleted", time.Hour, func(ctx context.Context) error {
+		return jobs.PurgeSoftDeleted(ctx, a.DB, a.Cfg.SoftDeleteRetention)
+	})
+	go jobs.Every(ctx, "purge-expired-sessions", time.Hour, func(ctx context.Context) error {
+		return jobs.PurgeExpiredSessions(ctx, a.DB)
+	})
+	if store, ok := a.RateLimits.Store.(*ratelimit.PostgresStore); ok {
+		go jobs.Every(ctx, "purge-rate-limit-buckets", time.Hour, func(ctx context.Context) error {
+			return store.Purge(ctx, time.Now().Add(-24*time.Hour))
+		})
+	}
+	go jobs.Every(ctx, "purge-login-throttle", time.Hour, func(ctx context.Context) error {
+		return jobs.PurgeLoginThrottle(ctx, a.DB, a.Cfg.LoginLockoutDuration)
+	})
+	go jobs.Every(ctx, "recalculate-trust-scores", time.Hour, func(ctx context.Context) error {
+		return jobs.RecalculateTrustScores(ctx, a.DB)
+	})
+	go jobs.Every(ctx, "send-due-reminders", time.Hour, func(ctx context.Context) error {
+		return jobs.SendDueReminders(ctx, a.DB, a.Cfg.DueReminderDays)
+	})
+	go jobs.Every(ctx, "send-notification-emails", time.Minute, func(ctx context.Context) error {
+		return jobs.SendQueuedEmails(ctx, a.DB, a.Mailer, a.Cfg.AppURL)
+	})
+}
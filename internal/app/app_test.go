@@ -6,9 +6,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/ratelimit"
+	"github.com/railanbaigazy/uade-api/internal/utils"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,6 +41,7 @@ func TestSetupRoutes(t *testing.T) {
 		wantStatus int
 	}{
 		{"healthz works", http.MethodGet, "/healthz", "", http.StatusOK},
+		{"jwks works", http.MethodGet, "/.well-known/jwks.json", "", http.StatusOK},
 
 		{"register endpoint", http.MethodPost, "/api/auth/register",
 			`{"name":"Tester","email":"t1@example.com","password":"123456"}`,
@@ -45,8 +51,44 @@ func TestSetupRoutes(t *testing.T) {
 			`{"email":"t1@example.com","password":"123456"}`,
 			http.StatusOK,
 		},
+		{"refresh without token", http.MethodPost, "/api/auth/refresh", `{}`, http.StatusBadRequest},
+		{"refresh with unknown token", http.MethodPost, "/api/auth/refresh", `{"refresh_token":"unknown"}`, http.StatusUnauthorized},
+		{"logout with unknown token", http.MethodPost, "/api/auth/logout", `{"refresh_token":"unknown"}`, http.StatusNoContent},
+		{"forgot password for unknown email", http.MethodPost, "/api/auth/password/forgot", `{"email":"nobody@example.com"}`, http.StatusAccepted},
+		{"reset password with unknown token", http.MethodPost, "/api/auth/password/reset", `{"token":"unknown","password":"123456"}`, http.StatusBadRequest},
+		{"verify email with unknown token", http.MethodPost, "/api/auth/verify-email", `{"token":"unknown"}`, http.StatusBadRequest},
+		{"unauthorized resend verification", http.MethodPost, "/api/auth/verify-email/resend", "", http.StatusUnauthorized},
+		{"list oidc providers", http.MethodGet, "/api/auth/oidc/providers", "", http.StatusOK},
+		{"start login at unknown provider", http.MethodPost, "/api/auth/oidc/unknown/start", "", http.StatusNotFound},
+		{"callback from unknown provider", http.MethodPost, "/api/auth/oidc/unknown/callback", `{"code":"c","state":"s"}`, http.StatusNotFound},
 
 		{"unauthorized /me", http.MethodGet, "/api/users/me", "", http.StatusUnauthorized},
+		{"unauthorized update profile", http.MethodPatch, "/api/users/me", `{"name":"New"}`, http.StatusUnauthorized},
+		{"unauthorized delete account", http.MethodDelete, "/api/users/me", `{}`, http.StatusUnauthorized},
+		{"unauthorized change password", http.MethodPost, "/api/users/me/password", `{}`, http.StatusUnauthorized},
+		{"unauthorized data export", http.MethodPost, "/api/users/me/export", "", http.StatusUnauthorized},
+		{"unauthorized trust score", http.MethodGet, "/api/users/me/trust-score", "", http.StatusUnauthorized},
+		{"unauthorized own posts", http.MethodGet, "/api/users/me/posts", "", http.StatusUnauthorized},
+		{"unauthorized notification settings", http.MethodGet, "/api/users/me/notification-settings", "", http.StatusUnauthorized},
+		{"unauthorized update notification settings", http.MethodPut, "/api/users/me/notification-settings", `{}`, http.StatusUnauthorized},
+		{"unauthorized kyc status", http.MethodGet, "/api/users/me/kyc", "", http.StatusUnauthorized},
+		{"unauthorized kyc submit", http.MethodPost, "/api/users/me/kyc", "", http.StatusUnauthorized},
+		{"unauthorized public profile", http.MethodGet, "/api/users/1", "", http.StatusUnauthorized},
+		{"unauthorized user reviews", http.MethodGet, "/api/users/1/reviews", "", http.StatusUnauthorized},
+		{"unauthorized review agreement", http.MethodPost, "/api/agreements/1/review", `{"rating":5}`, http.StatusUnauthorized},
+		{"unauthorized report review", http.MethodPost, "/api/reviews/1/report", `{"reason":"abuse"}`, http.StatusUnauthorized},
+		{"unauthorized notifications", http.MethodGet, "/api/notifications", "", http.StatusUnauthorized},
+		{"unauthorized mark notification read", http.MethodPost, "/api/notifications/1/read", "", http.StatusUnauthorized},
+		{"unauthorized mark all notifications read", http.MethodPost, "/api/notifications/read-all", "", http.StatusUnauthorized},
+		{"unauthorized list sessions", http.MethodGet, "/api/users/me/sessions", "", http.StatusUnauthorized},
+		{"unauthorized revoke session", http.MethodDelete, "/api/users/me/sessions/1", "", http.StatusUnauthorized},
+		{"unauthorized revoke all sessions", http.MethodDelete, "/api/users/me/sessions", "", http.StatusUnauthorized},
+		{"unauthorized list api keys", http.MethodGet, "/api/users/me/api-keys", "", http.StatusUnauthorized},
+		{"unauthorized create api key", http.MethodPost, "/api/users/me/api-keys", `{}`, http.StatusUnauthorized},
+		{"unauthorized 2fa setup", http.MethodPost, "/api/users/me/2fa/setup", "", http.StatusUnauthorized},
+		{"unauthorized 2fa enable", http.MethodPost, "/api/users/me/2fa/enable", "", http.StatusUnauthorized},
+		{"login 2fa without challenge", http.MethodPost, "/api/auth/login/2fa", `{}`, http.StatusBadRequest},
+		{"unlock without token", http.MethodPost, "/api/auth/unlock", `{}`, http.StatusBadRequest},
 		{"unauthorized get posts", http.MethodGet, "/api/posts", "", http.StatusUnauthorized},
 		{"unauthorized create post", http.MethodPost, "/api/posts", `{"title":"x"}`, http.StatusUnauthorized},
 		{"unauthorized update post", http.MethodPut, "/api/posts/1", `{"title":"x"}`, http.StatusUnauthorized},
@@ -65,6 +107,25 @@ func TestSetupRoutes(t *testing.T) {
 			http.StatusUnauthorized,
 		},
 
+		{"unauthorized admin search users", http.MethodGet, "/api/admin/users", "", http.StatusUnauthorized},
+		{"unauthorized admin get user", http.MethodGet, "/api/admin/users/1", "", http.StatusUnauthorized},
+		{"unauthorized admin change role", http.MethodPut, "/api/admin/users/1/role", "", http.StatusUnauthorized},
+		{"unauthorized admin block user", http.MethodPost, "/api/admin/users/1/block", "", http.StatusUnauthorized},
+		{"unauthorized admin force logout", http.MethodPost, "/api/admin/users/1/logout", "", http.StatusUnauthorized},
+		{"unauthorized admin audit log", http.MethodGet, "/api/admin/audit-log", "", http.StatusUnauthorized},
+		{"unauthorized admin delete user", http.MethodDelete, "/api/admin/users/1", "", http.StatusUnauthorized},
+		{"unauthorized admin restore user", http.MethodPost, "/api/admin/users/1/restore", "", http.StatusUnauthorized},
+		{"unauthorized report post", http.MethodPost, "/api/posts/1/report", "", http.StatusUnauthorized},
+		{"unauthorized moderation queue", http.MethodGet, "/api/admin/posts", "", http.StatusUnauthorized},
+		{"unauthorized review queue", http.MethodGet, "/api/admin/reviews", "", http.StatusUnauthorized},
+		{"unauthorized hide review", http.MethodPost, "/api/admin/reviews/1/hide", "", http.StatusUnauthorized},
+		{"unauthorized kyc queue", http.MethodGet, "/api/admin/kyc", "", http.StatusUnauthorized},
+		{"unauthorized kyc document", http.MethodGet, "/api/admin/kyc/1/documents/front", "", http.StatusUnauthorized},
+		{"unauthorized kyc approve", http.MethodPost, "/api/admin/kyc/1/approve", "", http.StatusUnauthorized},
+		{"unauthorized approve post", http.MethodPost, "/api/admin/posts/1/approve", "", http.StatusUnauthorized},
+		{"unauthorized reject post", http.MethodPost, "/api/admin/posts/1/reject", "", http.StatusUnauthorized},
+		{"unauthorized admin restore post", http.MethodPost, "/api/admin/posts/1/restore", "", http.StatusUnauthorized},
+
 		{"unknown route", http.MethodGet, "/notfound", "", http.StatusNotFound},
 	}
 
@@ -88,3 +149,46 @@ func TestSetupRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifiedRoutes(t *testing.T) {
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/posts"},
+		{http.MethodPost, "/api/agreements"},
+		{http.MethodPost, "/api/agreements/1/accept"},
+	}
+
+	for _, rt := range routes {
+		t.Run(rt.method+" "+rt.path, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			cfg := &config.Config{
+				JWTKeys:          jwtkeys.NewHMAC("test-secret-key"),
+				RateLimitDefault: ratelimit.Limit{Requests: 10, Per: time.Minute, Burst: 10},
+			}
+			mux := New(db, cfg).SetupRoutes()
+
+			mock.ExpectQuery(`SELECT revoked_at IS NULL FROM sessions`).
+				WithArgs(int64(3)).
+				WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+			mock.ExpectQuery(`SELECT id, role, state, suspended_until, deleted_at FROM users`).
+				WithArgs(int64(2)).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "role", "state", "suspended_until", "deleted_at"}).
+					AddRow(2, "user", "active", nil, nil))
+			mock.ExpectQuery(`SELECT email_verified_at IS NOT NULL FROM users`).
+				WithArgs(int64(2)).
+				WillReturnRows(sqlmock.NewRows([]string{"verified"}).AddRow(false))
+
+			token, err := utils.GenerateJWT(2, 3, cfg.JWTKeys, time.Minute)
+			require.NoError(t, err)
+			req := httptest.NewRequest(rt.method, rt.path, bytes.NewBufferString(`{}`))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// APIKeyChecker resolves an API key to the principal it authenticates, or
+// reports false when the key is unknown, revoked or expired.
+type APIKeyChecker interface {
+	APIKeyPrincipal(key string) (principal.Principal, bool, error)
+}
+
+// APIKeyStore checks API keys against the api_keys table.
+type APIKeyStore struct {
+	DB *sqlx.DB
+}
+
+func NewAPIKeyStore(db *sqlx.DB) *APIKeyStore {
+	return &APIKeyStore{DB: db}
+}
+
+// APIKeyPrincipal looks the key up by its hash and records its use.
+func (s *APIKeyStore) APIKeyPrincipal(key string) (principal.Principal, bool, error) {
+	var k models.APIKey
+	err := s.DB.Get(&k, `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING id, user_id, scopes
+	`, utils.HashToken(key))
+	if err == sql.ErrNoRows {
+		return principal.Principal{}, false, nil
+	}
+	if err != nil {
+		return principal.Principal{}, false, err
+	}
+
+	return principal.Principal{UserID: k.UserID, APIKeyID: k.ID, Scopes: k.Scopes}, true, nil
+}
+
+// RequireScope must be chained after JWTAuth. Sessions may call every
+// route, API keys only the routes listed in scopes (keyed by ServeMux
+// pattern) and only if they were granted the scope listed there.
+func RequireScope(scopes map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := principal.FromContext(r.Context())
+		if !p.HasScope(principal.ScopeAll) {
+			scope, ok := scopes[r.Pattern]
+			if !ok || !p.HasScope(scope) {
+				utils.WriteJSONErrorCode(w, "api key lacks the scope for this request", "insufficient_scope", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyStore_APIKeyPrincipal(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	store := NewAPIKeyStore(sqlx.NewDb(sqlDB, "sqlmock"))
+
+	mock.ExpectQuery(`UPDATE api_keys SET last_used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("uade_valid")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "scopes"}).AddRow(3, 7, "{read,posts:write}"))
+	mock.ExpectQuery(`UPDATE api_keys SET last_used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("uade_revoked")).
+		WillReturnError(sql.ErrNoRows)
+
+	p, ok, err := store.APIKeyPrincipal("uade_valid")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, principal.Principal{UserID: 7, APIKeyID: 3, Scopes: []string{"read", "posts:write"}}, p)
+
+	_, ok, err = store.APIKeyPrincipal("uade_revoked")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+type fakeAPIKeys map[string]principal.Principal
+
+func (f fakeAPIKeys) APIKeyPrincipal(key string) (principal.Principal, bool, error) {
+	p, ok := f[key]
+	return p, ok, nil
+}
+
+func TestJWTAuth_APIKey(t *testing.T) {
+	apiKeys := fakeAPIKeys{"uade_good": {UserID: 7, APIKeyID: 3, Scopes: []string{principal.ScopeRead}}}
+	handler := JWTAuth(jwtkeys.NewHMAC("test-secret"), nil, apiKeys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principal.FromContext(r.Context())
+		require.True(t, ok)
+		require.Equal(t, int64(3), p.APIKeyID)
+		require.False(t, p.HasScope(principal.ScopeAll))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for key, want := range map[string]int{"uade_good": http.StatusOK, "uade_unknown": http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, "/api/agreements", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, want, rec.Code, key)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	scopes := map[string]string{
+		"GET /api/agreements":  principal.ScopeRead,
+		"POST /api/agreements": principal.ScopeAgreementsWrite,
+	}
+	readOnly := principal.Principal{UserID: 1, APIKeyID: 2, Scopes: []string{principal.ScopeRead}}
+	session := principal.Principal{UserID: 1, SessionID: 2, Scopes: []string{principal.ScopeAll}}
+
+	tests := []struct {
+		name       string
+		pattern    string
+		p          principal.Principal
+		wantStatus int
+	}{
+		{"api key with scope", "GET /api/agreements", readOnly, http.StatusOK},
+		{"api key without scope", "POST /api/agreements", readOnly, http.StatusForbidden},
+		{"api key on unlisted route", "DELETE /api/users/me/sessions", readOnly, http.StatusForbidden},
+		{"session on unlisted route", "DELETE /api/users/me/sessions", session, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle(tt.pattern, RequireScope(scopes, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			method, path, _ := strings.Cut(tt.pattern, " ")
+			req := principal.WithRequest(httptest.NewRequest(method, path, nil), tt.p)
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+			require.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusForbidden {
+				require.Contains(t, rec.Body.String(), `"code":"insufficient_scope"`)
+			}
+		})
+	}
+}
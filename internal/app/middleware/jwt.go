@@ -1,14 +1,22 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
 )
 
-func JWTAuth(secret string, next http.Handler) http.Handler {
+// JWTAuth validates the Bearer token and passes its user and session IDs to
+// the next handler as the request's principal. Tokens are verified with the
+// key named by their kid header. When sessions is non-nil, tokens whose
+// session has been revoked are rejected as well. When apiKeys is non-nil,
+// Bearer credentials starting with utils.APIKeyPrefix are checked as API
+// keys instead, and the principal is limited to the key's scopes.
+func JWTAuth(keys *jwtkeys.KeySet, sessions SessionChecker, apiKeys APIKeyChecker, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if !strings.HasPrefix(authHeader, "Bearer ") {
@@ -17,23 +25,50 @@ func JWTAuth(secret string, next http.Handler) http.Handler {
 		}
 
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+		if apiKeys != nil && strings.HasPrefix(tokenStr, utils.APIKeyPrefix) {
+			p, ok, err := apiKeys.APIKeyPrincipal(tokenStr)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, principal.WithRequest(r, p))
+			return
+		}
+
 		claims := jwt.MapClaims{}
 
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
+		// Keyfunc only returns a key for the algorithm it was created for,
+		// which rules out alg substitution attacks
+		token, err := jwt.ParseWithClaims(tokenStr, claims, keys.Keyfunc, jwt.WithValidMethods(keys.Methods()))
 		if err != nil || !token.Valid {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		// ensure the signing method is what we expect to avoid alg substitution attacks
-		if token.Method != jwt.SigningMethodHS256 {
+		uid, _ := claims["user_id"].(float64)
+		if uid <= 0 {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		r.Header.Set("X-User-ID", fmt.Sprintf("%v", claims["user_id"]))
-		next.ServeHTTP(w, r)
+		sid, _ := claims["sid"].(float64)
+		if sessions != nil {
+			active, err := sessions.SessionActive(int64(sid))
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(w, "Session revoked", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		p := principal.Principal{UserID: int64(uid), SessionID: int64(sid), Scopes: []string{principal.ScopeAll}}
+		next.ServeHTTP(w, principal.WithRequest(r, p))
 	})
 }
@@ -1,22 +1,32 @@
 package middleware
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/principal"
 	"github.com/stretchr/testify/require"
 )
 
 func TestJWTAuth(t *testing.T) {
-	// happy path: valid token -> handler called and X-User-ID set
+	// happy path: valid token -> handler called with the principal set
 	secret := "test-secret"
-	handler := JWTAuth(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// echo user id header so test can assert it
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// echo user id so test can assert it
+		p, _ := principal.FromContext(r.Context())
 		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(r.Header.Get("X-User-ID")))
+		_, _ = fmt.Fprint(w, p.UserID)
 	}))
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -31,13 +41,13 @@ func TestJWTAuth(t *testing.T) {
 
 	handler.ServeHTTP(rec, req)
 	require.Equal(t, http.StatusOK, rec.Code)
-	// middleware should set X-User-ID to the claim value
+	// middleware should set the principal's user ID to the claim value
 	require.Equal(t, "99", rec.Body.String())
 }
 
 func TestJWTAuth_MissingToken(t *testing.T) {
 	secret := "test-secret"
-	handler := JWTAuth(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
 
@@ -52,7 +62,7 @@ func TestJWTAuth_MissingToken(t *testing.T) {
 
 func TestJWTAuth_InvalidToken(t *testing.T) {
 	secret := "test-secret"
-	handler := JWTAuth(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
 
@@ -67,7 +77,7 @@ func TestJWTAuth_InvalidToken(t *testing.T) {
 
 func TestJWTAuth_ExpiredToken(t *testing.T) {
 	secret := "test-secret"
-	handler := JWTAuth(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
 
@@ -88,7 +98,7 @@ func TestJWTAuth_ExpiredToken(t *testing.T) {
 
 func TestJWTAuth_WrongSecret(t *testing.T) {
 	secret := "test-secret"
-	handler := JWTAuth(secret, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
 
@@ -107,3 +117,128 @@ func TestJWTAuth_WrongSecret(t *testing.T) {
 	require.Equal(t, http.StatusUnauthorized, rec.Code)
 	require.Contains(t, rec.Body.String(), "Unauthorized")
 }
+
+type fakeSessions map[int64]bool
+
+func (f fakeSessions) SessionActive(sessionID int64) (bool, error) {
+	return f[sessionID], nil
+}
+
+func TestJWTAuth_ActiveSession(t *testing.T) {
+	secret := "test-secret"
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), fakeSessions{5: true}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := principal.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, p.SessionID)
+	}))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1,
+		"sid":     5,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	tokenStr, _ := token.SignedString([]byte(secret))
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "5", rec.Body.String())
+}
+
+func TestJWTAuth_RevokedSession(t *testing.T) {
+	secret := "test-secret"
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), fakeSessions{5: false}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1,
+		"sid":     5,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	tokenStr, _ := token.SignedString([]byte(secret))
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "Session revoked")
+}
+
+func TestJWTAuth_TokenWithoutSession(t *testing.T) {
+	secret := "test-secret"
+	handler := JWTAuth(jwtkeys.NewHMAC(secret), fakeSessions{5: true}, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// tokens issued before sessions existed carry no sid claim
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	tokenStr, _ := token.SignedString([]byte(secret))
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestJWTAuth_AsymmetricKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "k1.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	keys, err := jwtkeys.LoadDir(dir, "k1", "legacy-secret")
+	require.NoError(t, err)
+	handler := JWTAuth(keys, nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	signed, err := keys.Sign(jwt.MapClaims{"user_id": 7, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	// issued with the shared secret before switching to key files
+	legacy, err := jwtkeys.NewHMAC("legacy-secret").Sign(jwt.MapClaims{"user_id": 8, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	forged, err := jwtkeys.NewHMAC("guess").Sign(jwt.MapClaims{"user_id": 9, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	for token, want := range map[string]int{signed: http.StatusOK, legacy: http.StatusOK, forged: http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, want, rec.Code)
+	}
+}
+
+func TestJWTAuth_IgnoresSpoofedHeaders(t *testing.T) {
+	handler := JWTAuth(jwtkeys.NewHMAC("test-secret"), nil, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := principal.FromContext(r.Context())
+		_, _ = fmt.Fprint(w, p.UserID)
+	}))
+
+	tokenStr, err := jwtkeys.NewHMAC("test-secret").Sign(jwt.MapClaims{"user_id": 4, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenStr)
+	req.Header.Set("X-User-ID", "1")
+	req.Header.Set("X-User-Role", "admin")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "4", rec.Body.String())
+}
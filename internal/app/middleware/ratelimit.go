@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/ratelimit"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// RateLimiter applies token-bucket limits. Routes listed in Routes (keyed by
+// their ServeMux pattern) get their own limit and bucket; all other routes
+// share the fallback limit passed to RateLimit.
+type RateLimiter struct {
+	Store  ratelimit.Store
+	Routes map[string]ratelimit.Limit
+}
+
+func NewRateLimiter(store ratelimit.Store, routes map[string]ratelimit.Limit) *RateLimiter {
+	return &RateLimiter{Store: store, Routes: routes}
+}
+
+// RateKeyFunc identifies who a request is counted against.
+type RateKeyFunc func(r *http.Request) string
+
+// ByIP counts requests per client IP.
+func ByIP(r *http.Request) string {
+	return "ip:" + utils.ClientIP(r)
+}
+
+// ByUser counts requests per authenticated user and must be chained after
+// JWTAuth.
+func ByUser(r *http.Request) string {
+	userID, _ := principal.UserID(r.Context())
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// RateLimit counts the request against the bucket of the client identified
+// by key and rejects it with 429 once the bucket is empty. Every response
+// carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+// If the store fails, requests are let through rather than taking the API
+// down with it.
+func RateLimit(limiter *RateLimiter, fallback ratelimit.Limit, key RateKeyFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, bucket := fallback, key(r)
+		if l, ok := limiter.Routes[r.Pattern]; ok {
+			limit, bucket = l, bucket+"|"+r.Pattern
+		}
+
+		res, err := limiter.Store.Take(r.Context(), bucket, limit, time.Now())
+		if err != nil {
+			log.Printf("rate limit store failed: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining()))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(res.Reset(limit).Seconds())))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(res.RetryAfter(limit).Seconds())))
+			utils.WriteJSONErrorCode(w, "rate limit exceeded", "rate_limited", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("db down")
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := NewRateLimiter(ratelimit.NewMemoryStore(), map[string]ratelimit.Limit{
+		"POST /login": {Requests: 1, Per: time.Minute, Burst: 1},
+	})
+	fallback := ratelimit.Limit{Requests: 2, Per: time.Minute, Burst: 2}
+
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("POST /login", RateLimit(limiter, fallback, ByIP, ok))
+	mux.Handle("GET /posts", RateLimit(limiter, fallback, ByIP, ok))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/posts")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "30", rec.Header().Get("RateLimit-Reset"))
+
+	// the route with its own limit has its own bucket
+	require.Equal(t, http.StatusOK, do(http.MethodPost, "/login").Code)
+	rec = do(http.MethodPost, "/login")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "60", rec.Header().Get("Retry-After"))
+	require.Contains(t, rec.Body.String(), `"code":"rate_limited"`)
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/posts").Code)
+	require.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/posts").Code)
+}
+
+func TestRateLimit_ByUser(t *testing.T) {
+	limiter := NewRateLimiter(ratelimit.NewMemoryStore(), nil)
+	limit := ratelimit.Limit{Requests: 1, Per: time.Minute, Burst: 1}
+	h := RateLimit(limiter, limit, ByUser, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, user := range []int64{1, 2} {
+		req := principal.WithRequest(httptest.NewRequest(http.MethodGet, "/", nil), principal.Principal{UserID: user})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, "user %d", user)
+	}
+}
+
+func TestRateLimit_StoreFailureLetsRequestsThrough(t *testing.T) {
+	limiter := NewRateLimiter(failingStore{}, nil)
+	limit := ratelimit.Limit{Requests: 1, Per: time.Minute, Burst: 1}
+	h := RateLimit(limiter, limit, ByIP, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/rbac"
+)
+
+// RequireRole must be chained after ActiveUser. It only lets through users
+// whose role is one of roles.
+func RequireRole(roles []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(roles, principal.Role(r.Context())) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission must be chained after ActiveUser. It only lets through
+// users whose role grants perm according to the rbac matrix.
+func RequirePermission(perm rbac.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rbac.Has(principal.Role(r.Context()), perm) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
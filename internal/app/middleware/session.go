@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SessionChecker reports whether the login session an access token was
+// issued for is still active.
+type SessionChecker interface {
+	SessionActive(sessionID int64) (bool, error)
+}
+
+// SessionStore checks sessions against the sessions table.
+type SessionStore struct {
+	DB *sqlx.DB
+}
+
+func NewSessionStore(db *sqlx.DB) *SessionStore {
+	return &SessionStore{DB: db}
+}
+
+func (s *SessionStore) SessionActive(sessionID int64) (bool, error) {
+	var active bool
+	err := s.DB.Get(&active, "SELECT revoked_at IS NULL FROM sessions WHERE id=$1", sessionID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return active, err
+}
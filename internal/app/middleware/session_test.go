@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStore_SessionActive(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	store := NewSessionStore(sqlx.NewDb(sqlDB, "sqlmock"))
+
+	mock.ExpectQuery(`SELECT revoked_at IS NULL FROM sessions WHERE id=\$1`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(true))
+	mock.ExpectQuery(`SELECT revoked_at IS NULL FROM sessions WHERE id=\$1`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"active"}).AddRow(false))
+	mock.ExpectQuery(`SELECT revoked_at IS NULL FROM sessions WHERE id=\$1`).
+		WithArgs(int64(3)).
+		WillReturnError(sql.ErrNoRows)
+
+	active, err := store.SessionActive(1)
+	require.NoError(t, err)
+	require.True(t, active)
+
+	active, err = store.SessionActive(2)
+	require.NoError(t, err)
+	require.False(t, active)
+
+	active, err = store.SessionActive(3)
+	require.NoError(t, err)
+	require.False(t, active)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
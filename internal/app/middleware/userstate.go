@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// UserStateStore loads the account state of users and caches it for a short
+// TTL, so blocking a user takes effect within TTL without a query per request.
+type UserStateStore struct {
+	DB  *sqlx.DB
+	TTL time.Duration
+
+	mu    sync.Mutex
+	cache map[int64]cachedUser
+}
+
+const maxCachedUsers = 10000
+
+type cachedUser struct {
+	user      models.User
+	expiresAt time.Time
+}
+
+func NewUserStateStore(db *sqlx.DB, ttl time.Duration) *UserStateStore {
+	return &UserStateStore{DB: db, TTL: ttl, cache: make(map[int64]cachedUser)}
+}
+
+func (s *UserStateStore) User(userID int64) (models.User, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	c, ok := s.cache[userID]
+	s.mu.Unlock()
+	if ok && now.Before(c.expiresAt) {
+		return c.user, nil
+	}
+
+	var user models.User
+	err := s.DB.Get(&user, "SELECT id, role, state, suspended_until, deleted_at FROM users WHERE id=$1", userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	s.mu.Lock()
+	if len(s.cache) >= maxCachedUsers {
+		// entries are only useful for TTL, so dropping them all is cheap
+		s.cache = make(map[int64]cachedUser)
+	}
+	s.cache[userID] = cachedUser{user: user, expiresAt: now.Add(s.TTL)}
+	s.mu.Unlock()
+
+	return user, nil
+}
+
+// Invalidate drops the cached state of a user on this instance, e.g. right
+// after an admin changed it.
+func (s *UserStateStore) Invalidate(userID int64) {
+	s.mu.Lock()
+	delete(s.cache, userID)
+	s.mu.Unlock()
+}
+
+// ActiveUser must be chained after JWTAuth. It rejects requests from users
+// who are blocked, suspended or deleted, with a code telling them which, and
+// records the current role of everyone else in the request's principal.
+func ActiveUser(states *UserStateStore, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principal.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := states.User(p.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteAccessDenied(w, "account_deleted", nil)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if code := user.AccessDenial(time.Now()); code != "" {
+			utils.WriteAccessDenied(w, code, user.SuspendedUntil)
+			return
+		}
+
+		p.Role = user.Role
+		next.ServeHTTP(w, principal.WithRequest(r, p))
+	})
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/stretchr/testify/require"
+)
+
+var userStateColumns = []string{"id", "role", "state", "suspended_until", "deleted_at"}
+
+func TestActiveUser(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		rows       *sqlmock.Rows
+		dbErr      error
+		wantStatus int
+		wantCode   string
+	}{
+		{"active passes", sqlmock.NewRows(userStateColumns).AddRow(1, "user", "active", nil, nil), nil, http.StatusOK, ""},
+		{"blocked rejected", sqlmock.NewRows(userStateColumns).AddRow(1, "user", "blocked", nil, nil), nil, http.StatusForbidden, "account_blocked"},
+		{"suspended rejected", sqlmock.NewRows(userStateColumns).AddRow(1, "user", "suspended", future, nil), nil, http.StatusForbidden, "account_suspended"},
+		{"expired suspension passes", sqlmock.NewRows(userStateColumns).AddRow(1, "user", "suspended", past, nil), nil, http.StatusOK, ""},
+		{"deleted rejected", sqlmock.NewRows(userStateColumns).AddRow(1, "user", "active", nil, past), nil, http.StatusUnauthorized, "account_deleted"},
+		{"missing rejected", nil, sql.ErrNoRows, http.StatusUnauthorized, "account_deleted"},
+		{"database error fails", nil, sql.ErrConnDone, http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+			states := NewUserStateStore(sqlx.NewDb(sqlDB, "sqlmock"), time.Minute)
+
+			q := mock.ExpectQuery(`SELECT id, role, state, suspended_until, deleted_at FROM users WHERE id=\$1`).WithArgs(int64(1))
+			if tt.dbErr != nil {
+				q.WillReturnError(tt.dbErr)
+			} else {
+				q.WillReturnRows(tt.rows)
+			}
+
+			handler := ActiveUser(states, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "user", principal.Role(r.Context()))
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := principal.WithRequest(httptest.NewRequest(http.MethodGet, "/api/posts", nil), principal.Principal{UserID: 1})
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantCode != "" {
+				require.Contains(t, rec.Body.String(), `"code":"`+tt.wantCode+`"`)
+			}
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserStateStore_Cache(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	states := NewUserStateStore(sqlx.NewDb(sqlDB, "sqlmock"), time.Minute)
+
+	// only the first lookup hits the database
+	mock.ExpectQuery(`SELECT id, role, state, suspended_until, deleted_at FROM users`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows(userStateColumns).AddRow(2, "user", "active", nil, nil))
+
+	for i := 0; i < 3; i++ {
+		user, err := states.User(2)
+		require.NoError(t, err)
+		require.Equal(t, "active", user.State)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// after invalidation the state is loaded again
+	mock.ExpectQuery(`SELECT id, role, state, suspended_until, deleted_at FROM users`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows(userStateColumns).AddRow(2, "user", "blocked", nil, nil))
+
+	states.Invalidate(2)
+	user, err := states.User(2)
+	require.NoError(t, err)
+	require.Equal(t, "blocked", user.State)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+)
+
+// RequireVerifiedEmail must be chained after JWTAuth. Users who have not
+// confirmed their email yet may browse but not perform the wrapped action.
+func RequireVerifiedEmail(db *sqlx.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := principal.UserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var verified bool
+		err := db.Get(&verified, "SELECT email_verified_at IS NOT NULL FROM users WHERE id=$1", userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			http.Error(w, "Email not verified", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
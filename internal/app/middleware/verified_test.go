@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		verified   bool
+		dbErr      error
+		wantStatus int
+	}{
+		{"verified passes", true, nil, http.StatusOK},
+		{"unverified rejected", false, nil, http.StatusForbidden},
+		{"database error fails", false, sql.ErrConnDone, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer sqlDB.Close()
+			db := sqlx.NewDb(sqlDB, "sqlmock")
+
+			q := mock.ExpectQuery(`SELECT email_verified_at IS NOT NULL FROM users WHERE id=\$1`).WithArgs(int64(3))
+			if tt.dbErr != nil {
+				q.WillReturnError(tt.dbErr)
+			} else {
+				q.WillReturnRows(sqlmock.NewRows([]string{"verified"}).AddRow(tt.verified))
+			}
+
+			handler := RequireVerifiedEmail(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := principal.WithRequest(httptest.NewRequest(http.MethodPost, "/api/posts", nil), principal.Principal{UserID: 3})
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, tt.wantStatus, rec.Code)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
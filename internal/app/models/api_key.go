@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APIKey struct {
+	ID         int64          `db:"id" json:"id"`
+	UserID     int64          `db:"user_id" json:"-"`
+	Name       string         `db:"name" json:"name"`
+	Prefix     string         `db:"prefix" json:"prefix"`
+	Scopes     pq.StringArray `db:"scopes" json:"scopes"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time     `db:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time     `db:"last_used_at" json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditLogEntry struct {
+	ID           int64           `db:"id" json:"id"`
+	AdminID      int64           `db:"admin_id" json:"admin_id"`
+	Action       string          `db:"action" json:"action"`
+	TargetUserID *int64          `db:"target_user_id" json:"target_user_id,omitempty"`
+	TargetPostID *int64          `db:"target_post_id" json:"target_post_id,omitempty"`
+	Reason       string          `db:"reason" json:"reason"`
+	Details      json.RawMessage `db:"details" json:"details"`
+	CreatedAt    time.Time       `db:"created_at" json:"created_at"`
+}
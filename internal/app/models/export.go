@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// DataExport is everything the service keeps about a user, as handed out
+// by the personal data export.
+type DataExport struct {
+	ExportedAt time.Time   `json:"exported_at"`
+	Profile    User        `json:"profile"`
+	Posts      []Post      `json:"posts"`
+	Agreements []Agreement `json:"agreements"`
+	// Reviews holds the reviews the user wrote and those about them.
+	Reviews       []Review        `json:"reviews"`
+	TrustScore    *TrustScore     `json:"trust_score"`
+	Verifications []KYCSubmission `json:"identity_verifications"`
+	Sessions      []Session       `json:"sessions"`
+	APIKeys       []APIKey        `json:"api_keys"`
+	Identities    []LinkedAccount `json:"linked_accounts"`
+	Notifications []Notification  `json:"notifications"`
+	// NotificationPreferences holds the types the user changed channels of.
+	NotificationPreferences []NotificationPreference `json:"notification_preferences"`
+	Events                  []AccountEvent           `json:"events"`
+}
+
+// LinkedAccount is an account at an OpenID Connect provider the user
+// signs in with.
+type LinkedAccount struct {
+	Provider    string    `db:"provider" json:"provider"`
+	Email       string    `db:"email" json:"email"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	LastLoginAt time.Time `db:"last_login_at" json:"last_login_at"`
+}
+
+// AccountEvent is a moderation action taken on the user's account. The
+// moderator who took it is left out.
+type AccountEvent struct {
+	Action    string    `db:"action" json:"action"`
+	Reason    string    `db:"reason" json:"reason,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
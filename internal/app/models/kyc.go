@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// KYCSubmission is identity data a user submitted for verification.
+type KYCSubmission struct {
+	ID              int64      `db:"id" json:"id"`
+	UserID          int64      `db:"user_id" json:"user_id"`
+	UserName        string     `db:"user_name" json:"user_name,omitempty"`
+	DocumentType    string     `db:"document_type" json:"document_type"`
+	DocumentNumber  string     `db:"document_number" json:"document_number"`
+	Country         string     `db:"country" json:"country"`
+	IIN             *string    `db:"iin" json:"iin,omitempty"`
+	Status          string     `db:"status" json:"status"`
+	RejectionReason string     `db:"rejection_reason" json:"rejection_reason,omitempty"`
+	ReviewedBy      *int64     `db:"reviewed_by" json:"reviewed_by,omitempty"`
+	ReviewedAt      *time.Time `db:"reviewed_at" json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+
+	Documents []KYCDocument `db:"-" json:"documents,omitempty"`
+}
+
+// KYCDocument is an uploaded image of an identity document. The image
+// itself is kept in storage under StorageKey.
+type KYCDocument struct {
+	ID           int64     `db:"id" json:"id"`
+	SubmissionID int64     `db:"submission_id" json:"submission_id"`
+	Kind         string    `db:"kind" json:"kind"`
+	StorageKey   string    `db:"storage_key" json:"-"`
+	ContentType  string    `db:"content_type" json:"content_type"`
+	SizeBytes    int64     `db:"size_bytes" json:"size_bytes"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification is an entry in a user's inbox; Type is one of the
+// notify package constants.
+type Notification struct {
+	ID          int64           `db:"id" json:"id"`
+	UserID      int64           `db:"user_id" json:"-"`
+	Type        string          `db:"type" json:"type"`
+	AgreementID *int64          `db:"agreement_id" json:"agreement_id,omitempty"`
+	Data        json.RawMessage `db:"data" json:"data"`
+	ReadAt      *time.Time      `db:"read_at" json:"read_at,omitempty"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+}
+
+// NotificationPreference says on which channels a user gets notifications
+// of one type.
+type NotificationPreference struct {
+	Type  string `db:"type" json:"type"`
+	InApp bool   `db:"in_app" json:"in_app"`
+	Email bool   `db:"email" json:"email"`
+}
+
+// NotificationSettings are a user's channel preferences for every
+// notification type and the language of their emails.
+type NotificationSettings struct {
+	Locale      string                   `json:"locale"`
+	Preferences []NotificationPreference `json:"preferences"`
+}
@@ -3,10 +3,26 @@ package models
 import "time"
 
 type Post struct {
-	ID        int64     `db:"id" json:"id"`
-	Title     string    `db:"title" json:"title"`
-	Content   string    `db:"content" json:"content"`
-	Type      string    `db:"type" json:"type"`
-	AuthorID  int64     `db:"author_id" json:"author_id"`
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	ID               int64  `db:"id" json:"id"`
+	Title            string `db:"title" json:"title"`
+	Content          string `db:"content" json:"content"`
+	Type             string `db:"type" json:"type"`
+	AuthorID         int64  `db:"author_id" json:"author_id"`
+	Status           string `db:"status" json:"status,omitempty"`
+	ModerationReason string `db:"moderation_reason" json:"moderation_reason,omitempty"`
+	// MinTrustScore is the lowest trust score a borrower needs to request
+	// an agreement on a lend post.
+	MinTrustScore *int       `db:"min_trust_score" json:"min_trust_score,omitempty"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	DeletedAt     *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// PostReport is a user's complaint about a post, e.g. a suspected scam.
+type PostReport struct {
+	ID         int64     `db:"id" json:"id"`
+	PostID     int64     `db:"post_id" json:"post_id"`
+	ReporterID int64     `db:"reporter_id" json:"reporter_id"`
+	Reason     string    `db:"reason" json:"reason"`
+	Comment    string    `db:"comment" json:"comment"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Review is a party's rating of the other party after an agreement ended.
+type Review struct {
+	ID               int64      `db:"id" json:"id"`
+	AgreementID      int64      `db:"agreement_id" json:"agreement_id"`
+	ReviewerID       int64      `db:"reviewer_id" json:"reviewer_id"`
+	ReviewerName     string     `db:"reviewer_name" json:"reviewer_name,omitempty"`
+	RevieweeID       int64      `db:"reviewee_id" json:"reviewee_id"`
+	Rating           int        `db:"rating" json:"rating"`
+	Comment          string     `db:"comment" json:"comment"`
+	Status           string     `db:"status" json:"status,omitempty"`
+	ModerationReason string     `db:"moderation_reason" json:"moderation_reason,omitempty"`
+	ReportCount      int        `db:"report_count" json:"report_count,omitempty"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+	ModeratedAt      *time.Time `db:"moderated_at" json:"moderated_at,omitempty"`
+}
+
+// RatingSummary aggregates the published reviews of a user.
+type RatingSummary struct {
+	// Average is nil until the user has been reviewed.
+	Average *float64 `db:"average" json:"average"`
+	Count   int      `db:"count" json:"count"`
+}
+
+// ReviewReport is a user's complaint about an abusive review.
+type ReviewReport struct {
+	ID         int64     `db:"id" json:"id"`
+	ReviewID   int64     `db:"review_id" json:"review_id"`
+	ReporterID int64     `db:"reporter_id" json:"reporter_id"`
+	Reason     string    `db:"reason" json:"reason"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
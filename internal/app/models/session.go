@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         int64      `db:"id" json:"id"`
+	UserID     int64      `db:"user_id" json:"-"`
+	Device     string     `db:"device" json:"device"`
+	IP         string     `db:"ip" json:"ip"`
+	UserAgent  string     `db:"user_agent" json:"user_agent"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt time.Time  `db:"last_used_at" json:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	Current    bool       `db:"-" json:"current"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TrustScore is a user's last computed trust score. Factors is the
+// breakdown of trust.Score explaining it.
+type TrustScore struct {
+	Score      int             `db:"score" json:"score"`
+	Factors    json.RawMessage `db:"factors" json:"factors"`
+	ComputedAt time.Time       `db:"computed_at" json:"computed_at"`
+}
@@ -1,13 +1,70 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/railanbaigazy/uade-api/internal/trust"
+)
 
 type User struct {
-	ID           int64     `db:"id" json:"id"`
-	Name         string    `db:"name" json:"name"`
-	Email        string    `db:"email" json:"email"`
-	PasswordHash string    `db:"password_hash" json:"-"`
-	Role         string    `db:"role" json:"role"`
-	State        string    `db:"state" json:"state"`
-	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	ID              int64      `db:"id" json:"id"`
+	Name            string     `db:"name" json:"name"`
+	Email           string     `db:"email" json:"email"`
+	PasswordHash    string     `db:"password_hash" json:"-"`
+	Role            string     `db:"role" json:"role"`
+	State           string     `db:"state" json:"state"`
+	SuspendedUntil  *time.Time `db:"suspended_until" json:"suspended_until,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at,omitempty"`
+	PendingEmail    *string    `db:"pending_email" json:"pending_email,omitempty"`
+	// IdentityVerifiedAt is set once a moderator approved an identity
+	// document of the user.
+	IdentityVerifiedAt *time.Time `db:"identity_verified_at" json:"identity_verified_at,omitempty"`
+	DeletedAt          *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	TOTPEnabledAt      *time.Time `db:"totp_enabled_at" json:"two_factor_enabled_at,omitempty"`
+	// Locale is the language of emails sent to the user.
+	Locale string `db:"locale" json:"locale,omitempty"`
+}
+
+// VerificationLevel returns the user's trust.Level.
+func (u User) VerificationLevel() int {
+	return trust.Level(u.EmailVerifiedAt != nil, u.IdentityVerifiedAt != nil)
+}
+
+// AccessDenial returns an error code explaining why the user may not use
+// the API at the given time, or "" if access is allowed. A suspension
+// without an end date lasts until it is lifted manually.
+func (u User) AccessDenial(now time.Time) string {
+	switch {
+	case u.DeletedAt != nil:
+		return "account_deleted"
+	case u.State == "blocked":
+		return "account_blocked"
+	case u.State == "suspended" && (u.SuspendedUntil == nil || now.Before(*u.SuspendedUntil)):
+		return "account_suspended"
+	}
+	return ""
+}
+
+// AgreementStats counts a user's finished agreements in one role.
+type AgreementStats struct {
+	Completed int `db:"completed" json:"completed"`
+	Defaulted int `db:"defaulted" json:"defaulted"`
+}
+
+// PublicProfile is what other users can see about a user before dealing
+// with them. It must never carry contact details or account state.
+type PublicProfile struct {
+	ID          int64          `db:"id" json:"id"`
+	Name        string         `db:"name" json:"name"`
+	MemberSince time.Time      `db:"created_at" json:"member_since"`
+	AsLender    AgreementStats `json:"as_lender"`
+	AsBorrower  AgreementStats `json:"as_borrower"`
+	// OnTimePaymentRate is the share of the user's finished loans as
+	// borrower that were repaid by their due date, or nil without any.
+	OnTimePaymentRate *float64 `json:"on_time_payment_rate"`
+	// TrustScore is nil until the score job has run for the user.
+	TrustScore  *int          `db:"trust_score" json:"trust_score"`
+	Rating      RatingSummary `json:"rating"`
+	ActivePosts []Post        `json:"active_posts"`
 }
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUser_AccessDenial(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		user User
+		want string
+	}{
+		{"active", User{State: "active"}, ""},
+		{"blocked", User{State: "blocked"}, "account_blocked"},
+		{"suspended indefinitely", User{State: "suspended"}, "account_suspended"},
+		{"suspended until later", User{State: "suspended", SuspendedUntil: &future}, "account_suspended"},
+		{"suspension over", User{State: "suspended", SuspendedUntil: &past}, ""},
+		{"deleted", User{State: "active", DeletedAt: &past}, "account_deleted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.user.AccessDenial(now))
+		})
+	}
+}
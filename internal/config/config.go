@@ -1,17 +1,125 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/oidc"
+	"github.com/railanbaigazy/uade-api/internal/ratelimit"
+	"github.com/railanbaigazy/uade-api/internal/trust"
 )
 
 type Config struct {
-	DBURL     string
-	Port      string
-	Env       string
-	JWTSecret string
+	DBURL string
+	Port  string
+	Env   string
+
+	// JWTKeys signs and verifies access tokens: RS256/EdDSA keys loaded from
+	// JWT_KEYS_DIR, or the HS256 JWT_SECRET when no key directory is set.
+	JWTKeys *jwtkeys.KeySet
+
+	// AccessTokenTTL is the lifetime of JWT access tokens, RefreshTokenTTL the
+	// lifetime of the opaque refresh tokens used to obtain new ones.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// SoftDeleteRetention is how long soft-deleted posts and users are kept
+	// before the purge job removes them permanently.
+	SoftDeleteRetention time.Duration
+
+	// AppURL is the public base URL of the frontend, used to build links in emails.
+	AppURL string
+
+	// SMTP settings for outgoing mail. When SMTPHost is empty mail is only logged.
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	PasswordResetTTL time.Duration
+
+	// EmailVerificationTTL is how long a verification link stays valid and
+	// EmailVerificationCooldown how long users must wait between resends.
+	EmailVerificationTTL      time.Duration
+	EmailVerificationCooldown time.Duration
+
+	// UserStateCacheTTL bounds how long a blocked or suspended user can keep
+	// using an already issued access token.
+	UserStateCacheTTL time.Duration
+
+	// PostPreModeration holds new and edited posts in pending_review until a
+	// moderator approves them. PostReportThreshold is the number of reports
+	// after which a published post is hidden automatically.
+	PostPreModeration   bool
+	PostReportThreshold int
+
+	// TOTPIssuer is the account issuer shown in authenticator apps and
+	// LoginChallengeTTL how long the second login step may take.
+	TOTPIssuer        string
+	LoginChallengeTTL time.Duration
+
+	// TwoFactorAgreementThreshold is the principal amount above which creating
+	// or accepting an agreement requires a fresh two-factor code. Zero
+	// disables the check.
+	TwoFactorAgreementThreshold float64
+
+	// MaxAgreementAmount is the largest principal a party of each
+	// verification level (see trust.Level) may borrow or lend in one
+	// agreement. Levels without an entry or with zero have no limit.
+	MaxAgreementAmount map[int]float64
+	// MaxAgreementAmountByScore further caps one agreement by the party's
+	// trust score, ordered by MinScore. Empty means no caps by score.
+	MaxAgreementAmountByScore []ScoreLimit
+
+	// Borrowers may owe at most MaxOutstandingPrincipal across their active
+	// and disputed agreements and have at most MaxPendingRequests requests
+	// awaiting a lender. A MaxOutstandingPrincipal of zero disables it.
+	MaxOutstandingPrincipal float64
+	MaxPendingRequests      int
+
+	// DueReminderDays is how many days before its due date the borrower of
+	// an active agreement is reminded of it.
+	DueReminderDays int
+
+	// StorageDir is the directory uploaded files, such as identity
+	// documents, are kept in.
+	StorageDir string
+
+	// Failed logins lock an account after LoginMaxAccountFailures and a client
+	// IP after LoginMaxIPFailures consecutive failures, for LoginLockoutDuration.
+	LoginMaxAccountFailures int
+	LoginMaxIPFailures      int
+	LoginLockoutDuration    time.Duration
+
+	// RateLimitStore is "memory" or "postgres"; use postgres when running
+	// several instances. RateLimitDefault applies per user to authenticated
+	// routes, RateLimitAuth per IP to /api/auth/*, and RateLimitRoutes
+	// overrides either for single routes.
+	RateLimitStore   string
+	RateLimitDefault ratelimit.Limit
+	RateLimitAuth    ratelimit.Limit
+	RateLimitRoutes  map[string]ratelimit.Limit
+
+	// OIDCProviders are the OpenID Connect providers users can log in with
+	// and OIDCLoginTTL how long a login at a provider may take.
+	OIDCProviders []oidc.Config
+	OIDCLoginTTL  time.Duration
+}
+
+// ScoreLimit caps the principal of one agreement at Amount for users whose
+// trust score is at least MinScore. Zero means no limit.
+type ScoreLimit struct {
+	MinScore int
+	Amount   float64
 }
 
 func Load() *Config {
@@ -34,17 +142,248 @@ func Load() *Config {
 		env = "development"
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET not set in .env")
+	jwtKeys := loadJWTKeys()
+
+	accessTokenTTL := getDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	refreshTokenTTL := getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+	retentionDays := getInt("SOFT_DELETE_RETENTION_DAYS", 30)
+
+	rateLimitStore := getString("RATE_LIMIT_STORE", "memory")
+	if rateLimitStore != "memory" && rateLimitStore != "postgres" {
+		log.Fatal("RATE_LIMIT_STORE must be memory or postgres")
+	}
+	rateLimitRoutes, err := ratelimit.ParseRoutes(getString("RATE_LIMIT_ROUTES",
+		"POST /api/auth/register=10/1h;POST /api/auth/password/forgot=5/1h"))
+	if err != nil {
+		log.Fatalf("RATE_LIMIT_ROUTES: %v", err)
+	}
+
+	scoreLimits, err := parseScoreLimits(getString("MAX_AGREEMENT_AMOUNT_BY_SCORE", ""))
+	if err != nil {
+		log.Fatalf("MAX_AGREEMENT_AMOUNT_BY_SCORE: %v", err)
 	}
 
+	appURL := getString("APP_URL", "http://localhost:3000")
+
 	log.Printf("Loaded config for %s environment", env)
 
 	return &Config{
-		DBURL:     dbURL,
-		Port:      port,
-		Env:       env,
-		JWTSecret: jwtSecret,
+		DBURL:   dbURL,
+		Port:    port,
+		Env:     env,
+		JWTKeys: jwtKeys,
+
+		AccessTokenTTL:  accessTokenTTL,
+		RefreshTokenTTL: refreshTokenTTL,
+
+		SoftDeleteRetention: time.Duration(retentionDays) * 24 * time.Hour,
+
+		AppURL: appURL,
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getString("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		MailFrom:     getString("MAIL_FROM", "Uade <no-reply@uade.kz>"),
+
+		PasswordResetTTL: getDuration("PASSWORD_RESET_TTL", time.Hour),
+
+		EmailVerificationTTL:      getDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		EmailVerificationCooldown: getDuration("EMAIL_VERIFICATION_COOLDOWN", time.Minute),
+
+		UserStateCacheTTL: getDuration("USER_STATE_CACHE_TTL", 30*time.Second),
+
+		PostPreModeration:   getBool("POST_PREMODERATION", false),
+		PostReportThreshold: getInt("POST_REPORT_THRESHOLD", 5),
+
+		TOTPIssuer:        getString("TOTP_ISSUER", "Uade"),
+		LoginChallengeTTL: getDuration("LOGIN_CHALLENGE_TTL", 5*time.Minute),
+
+		TwoFactorAgreementThreshold: getFloat("TWO_FACTOR_AGREEMENT_THRESHOLD", 0),
+
+		MaxAgreementAmount: map[int]float64{
+			trust.LevelEmail:    getFloat("MAX_AGREEMENT_AMOUNT", 100000),
+			trust.LevelIdentity: getFloat("MAX_AGREEMENT_AMOUNT_IDENTITY", 0),
+		},
+		MaxAgreementAmountByScore: scoreLimits,
+
+		MaxOutstandingPrincipal: getFloat("MAX_OUTSTANDING_PRINCIPAL", 500000),
+		MaxPendingRequests:      getInt("MAX_PENDING_REQUESTS", 5),
+
+		DueReminderDays: getInt("DUE_REMINDER_DAYS", 3),
+
+		StorageDir: getString("STORAGE_DIR", "data/uploads"),
+
+		LoginMaxAccountFailures: getInt("LOGIN_MAX_ACCOUNT_FAILURES", 10),
+		LoginMaxIPFailures:      getInt("LOGIN_MAX_IP_FAILURES", 50),
+		LoginLockoutDuration:    getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+
+		RateLimitStore:   rateLimitStore,
+		RateLimitDefault: getLimit("RATE_LIMIT_DEFAULT", "120/1m"),
+		RateLimitAuth:    getLimit("RATE_LIMIT_AUTH", "20/1m"),
+		RateLimitRoutes:  rateLimitRoutes,
+
+		OIDCProviders: loadOIDCProviders(appURL),
+		OIDCLoginTTL:  getDuration("OIDC_LOGIN_TTL", 10*time.Minute),
+	}
+}
+
+// loadJWTKeys loads the asymmetric keys from JWT_KEYS_DIR, signing with
+// JWT_SIGNING_KEY_ID. Without a key directory tokens are signed with the
+// HS256 JWT_SECRET; with one, JWT_SECRET is optional and only keeps
+// previously issued HS256 tokens valid during the switch.
+func loadJWTKeys() *jwtkeys.KeySet {
+	secret := os.Getenv("JWT_SECRET")
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if secret == "" {
+			log.Fatal("JWT_SECRET not set in .env")
+		}
+		return jwtkeys.NewHMAC(secret)
+	}
+
+	kid := os.Getenv("JWT_SIGNING_KEY_ID")
+	if kid == "" {
+		log.Fatal("JWT_SIGNING_KEY_ID must be set with JWT_KEYS_DIR")
+	}
+	keys, err := jwtkeys.LoadDir(dir, kid, secret)
+	if err != nil {
+		log.Fatalf("JWT_KEYS_DIR: %v", err)
+	}
+	return keys
+}
+
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS, e.g.
+// "google,keycloak", each configured with OIDC_<NAME>_ISSUER, _CLIENT_ID,
+// _CLIENT_SECRET and optionally _SCOPES and _REDIRECT_URL.
+func loadOIDCProviders(appURL string) []oidc.Config {
+	var providers []oidc.Config
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !oidcNamePattern.MatchString(name) {
+			log.Fatalf("OIDC_PROVIDERS: invalid provider name %q", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getString(prefix+"REDIRECT_URL", strings.TrimSuffix(appURL, "/")+"/oauth/callback/"+name),
+			Scopes:       strings.Fields(getString(prefix+"SCOPES", "openid email profile")),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+var oidcNamePattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// parseScoreLimits reads ";"-separated "min_score=amount" pairs, e.g.
+// "0=50000;50=200000;80=0", into limits ordered by score.
+func parseScoreLimits(s string) ([]ScoreLimit, error) {
+	var limits []ScoreLimit
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		score, amount, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not min_score=amount", pair)
+		}
+		minScore, err := strconv.Atoi(strings.TrimSpace(score))
+		if err != nil || minScore < 0 || minScore > trust.MaxScore {
+			return nil, fmt.Errorf("invalid score %q", score)
+		}
+		max, err := strconv.ParseFloat(strings.TrimSpace(amount), 64)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("invalid amount %q", amount)
+		}
+		limits = append(limits, ScoreLimit{MinScore: minScore, Amount: max})
+	}
+	sort.Slice(limits, func(i, j int) bool { return limits[i].MinScore < limits[j].MinScore })
+	return limits, nil
+}
+
+func getString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getBool reads a boolean ("true", "1", "false", ...) from the environment,
+// falling back to def when the variable is unset.
+func getBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("%s must be true or false", key)
+	}
+	return b
+}
+
+// getInt reads a positive integer from the environment, falling back to def
+// when the variable is unset.
+func getInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Fatalf("%s must be a positive integer", key)
+	}
+	return n
+}
+
+// getFloat reads a non-negative number from the environment, falling back to
+// def when the variable is unset.
+func getFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Fatalf("%s must be a non-negative number", key)
+	}
+	return f
+}
+
+// getLimit reads a rate limit such as "120/1m" or "5/1h:10" (see
+// ratelimit.ParseLimit) from the environment, falling back to def.
+func getLimit(key, def string) ratelimit.Limit {
+	l, err := ratelimit.ParseLimit(getString(key, def))
+	if err != nil {
+		log.Fatalf("%s: %v", key, err)
+	}
+	return l
+}
+
+// getDuration reads a Go duration string (e.g. "15m", "720h") from the
+// environment, falling back to def when the variable is unset.
+func getDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("%s must be a positive duration such as 15m or 720h", key)
 	}
+	return d
 }
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/storage"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// deletedUserName replaces the name of users who deleted their account.
+const deletedUserName = "Deleted user"
+
+// personalTables hold data that only concerns the user and is erased with
+// their account. Each has a user_id column.
+var personalTables = []string{
+	"refresh_tokens",
+	"sessions",
+	"password_reset_tokens",
+	"email_verification_tokens",
+	"recovery_codes",
+	"login_challenges",
+	"account_unlock_tokens",
+	"api_keys",
+	"user_identities",
+	"trust_scores",
+	"kyc_submissions",
+	"notifications",
+	"notification_preferences",
+	"email_outbox",
+}
+
+// AccountHandler lets users take their data with them and delete their
+// account.
+type AccountHandler struct {
+	DB      *sqlx.DB
+	Storage storage.Storage
+}
+
+func NewAccountHandler(db *sqlx.DB, store storage.Storage) *AccountHandler {
+	return &AccountHandler{DB: db, Storage: store}
+}
+
+// Export returns everything stored about the caller as a JSON file to
+// download. Deleted posts and finished agreements are included. It reads
+// from one snapshot so the parts of the archive agree with each other.
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	tx, err := h.DB.BeginTxx(r.Context(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		utils.WriteJSONError(w, "failed to export data", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	export := models.DataExport{
+		ExportedAt:              time.Now().UTC(),
+		Posts:                   []models.Post{},
+		Agreements:              []models.Agreement{},
+		Reviews:                 []models.Review{},
+		Verifications:           []models.KYCSubmission{},
+		Sessions:                []models.Session{},
+		APIKeys:                 []models.APIKey{},
+		Identities:              []models.LinkedAccount{},
+		Notifications:           []models.Notification{},
+		NotificationPreferences: []models.NotificationPreference{},
+		Events:                  []models.AccountEvent{},
+	}
+
+	err = tx.Get(&export.Profile, `
+		SELECT id, name, email, role, state, suspended_until, created_at, email_verified_at,
+		       pending_email, identity_verified_at, totp_enabled_at, locale
+		FROM users WHERE id=$1 AND deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "user not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to export data", http.StatusInternalServerError)
+		return
+	}
+
+	var score models.TrustScore
+	err = tx.Get(&score, "SELECT score, factors, computed_at FROM trust_scores WHERE user_id=$1", userID)
+	switch {
+	case err == nil:
+		export.TrustScore = &score
+	case err != sql.ErrNoRows:
+		utils.WriteJSONError(w, "failed to export data", http.StatusInternalServerError)
+		return
+	}
+
+	parts := []struct {
+		dest  any
+		query string
+	}{
+		{&export.Posts, `
+			SELECT id, title, content, type, author_id, status, moderation_reason, min_trust_score,
+			       created_at, deleted_at
+			FROM posts WHERE author_id = $1 ORDER BY created_at`},
+		{&export.Agreements, `
+			SELECT * FROM agreements WHERE lender_id = $1 OR borrower_id = $1 ORDER BY created_at`},
+		{&export.Reviews, `
+			SELECT id, agreement_id, reviewer_id, reviewee_id, rating, comment, status,
+			       moderation_reason, created_at, moderated_at
+			FROM reviews WHERE reviewer_id = $1 OR reviewee_id = $1 ORDER BY created_at`},
+		{&export.Verifications, `
+			SELECT id, user_id, document_type, document_number, country, iin, status,
+			       rejection_reason, reviewed_at, created_at
+			FROM kyc_submissions WHERE user_id = $1 ORDER BY created_at`},
+		{&export.Sessions, `
+			SELECT id, user_id, device, ip, user_agent, created_at, last_used_at, revoked_at
+			FROM sessions WHERE user_id = $1 ORDER BY created_at`},
+		{&export.APIKeys, `
+			SELECT id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at
+			FROM api_keys WHERE user_id = $1 ORDER BY created_at`},
+		{&export.Identities, `
+			SELECT provider, email, created_at, last_login_at
+			FROM user_identities WHERE user_id = $1 ORDER BY created_at`},
+		{&export.Notifications, `
+			SELECT id, user_id, type, agreement_id, data, read_at, created_at
+			FROM notifications WHERE user_id = $1 ORDER BY created_at`},
+		{&export.NotificationPreferences, `
+			SELECT type, in_app, email FROM notification_preferences WHERE user_id = $1 ORDER BY type`},
+		{&export.Events, `
+			SELECT action, reason, created_at
+			FROM admin_audit_log WHERE target_user_id = $1 ORDER BY created_at`},
+	}
+	for _, p := range parts {
+		if err := tx.Select(p.dest, p.query, userID); err != nil {
+			utils.WriteJSONError(w, "failed to export data", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("uade-export-%d-%s.json", userID, export.ExportedAt.Format("20060102"))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, export, http.StatusOK)
+}
+
+// Delete erases the caller's account after checking their password. The
+// user row stays, stripped of personal data, because agreements keep
+// referring to both parties; everything else personal is removed and their
+// posts are taken down. Accounts with agreements still in progress cannot
+// be deleted.
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	err := h.DB.Get(&passwordHash, "SELECT password_hash FROM users WHERE id=$1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		utils.WriteJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if !utils.CheckPassword(passwordHash, input.CurrentPassword) {
+		utils.WriteJSONErrorCode(w, "current password is incorrect", "invalid_password", http.StatusForbidden)
+		return
+	}
+
+	// nobody knows this password, so the account can never be signed in to
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	unusableHash, err := utils.HashPassword(secret)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// agreements are requested and accepted with the borrower locked
+	if err := lockUser(tx, userID); err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	var open int
+	err = tx.Get(&open, `
+		SELECT COUNT(*) FROM agreements
+		WHERE (lender_id = $1 OR borrower_id = $1) AND status IN ('pending', 'active', 'disputed')
+	`, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	if open > 0 {
+		utils.WriteJSONErrorCode(w, "finish or cancel your open agreements before deleting the account",
+			"open_agreements", http.StatusConflict)
+		return
+	}
+
+	var documentKeys []string
+	err = tx.Select(&documentKeys, `
+		SELECT d.storage_key FROM kyc_documents d
+		JOIN kyc_submissions k ON k.id = d.submission_id
+		WHERE k.user_id = $1
+	`, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET name = $2, email = $3, password_hash = $4, pending_email = NULL,
+		    totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0,
+		    deleted_at = NOW(), anonymized_at = NOW()
+		WHERE id = $1
+	`, userID, deletedUserName, fmt.Sprintf("deleted-%d@deleted.invalid", userID), unusableHash)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	// posts stay for the agreements made on them, without their text
+	_, err = tx.Exec(`
+		UPDATE posts SET title = '', content = '', deleted_at = COALESCE(deleted_at, NOW())
+		WHERE author_id = $1
+	`, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	for _, table := range personalTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+			utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	for _, key := range documentKeys {
+		if err := h.Storage.Delete(r.Context(), key); err != nil {
+			log.Printf("delete account %d: remove %s: %v", userID, key, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
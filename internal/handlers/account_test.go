@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/storage"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountExport(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAccountHandler(db, nil)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, name, email, role, state, suspended_until`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "role", "state", "created_at"}).
+			AddRow(4, "Aida", "aida@example.com", "user", "active", now))
+	mock.ExpectQuery(`SELECT score, factors, computed_at FROM trust_scores`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "factors", "computed_at"}).AddRow(55, []byte(`[]`), now))
+	mock.ExpectQuery(`FROM posts WHERE author_id = \$1`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "content", "type", "author_id", "created_at", "deleted_at"}).
+			AddRow(3, "Need 10k", "for rent", "borrow", 4, now, now))
+	mock.ExpectQuery(`SELECT \* FROM agreements WHERE lender_id = \$1 OR borrower_id = \$1`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lender_id", "borrower_id", "status", "due_date", "created_at"}).
+			AddRow(9, 2, 4, "completed", now, now))
+	mock.ExpectQuery(`FROM reviews WHERE reviewer_id = \$1 OR reviewee_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM kyc_submissions WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM sessions WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "device", "ip", "created_at", "last_used_at"}).
+			AddRow(7, "phone", "10.0.0.1", now, now))
+	mock.ExpectQuery(`FROM api_keys WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM user_identities WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"provider"}))
+	mock.ExpectQuery(`FROM notifications WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`FROM notification_preferences WHERE user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "in_app", "email"}).AddRow("review_received", true, false))
+	mock.ExpectQuery(`FROM admin_audit_log WHERE target_user_id = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"action", "reason", "created_at"}).AddRow("suspend_user", "spam", now))
+	mock.ExpectRollback()
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/users/me/export", nil), 4)
+	rec := httptest.NewRecorder()
+	h.Export(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Header().Get("Content-Disposition"), `attachment; filename="uade-export-4-`)
+
+	var export map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &export))
+	require.Contains(t, string(export["profile"]), `"email":"aida@example.com"`)
+	require.Contains(t, string(export["posts"]), `"deleted_at"`)
+	require.Contains(t, string(export["agreements"]), `"id":9`)
+	require.Contains(t, string(export["events"]), `"action":"suspend_user"`)
+	require.NotContains(t, string(export["events"]), "admin_id")
+	require.JSONEq(t, `[]`, string(export["reviews"]))
+	require.JSONEq(t, `[{"type":"review_received","in_app":true,"email":false}]`, string(export["notification_preferences"]))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAccountExport_UserNotFound(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAccountHandler(db, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM users WHERE id=\$1 AND deleted_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/users/me/export", nil), 4)
+	rec := httptest.NewRecorder()
+	h.Export(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func deleteAccount(h *AccountHandler, password string) *httptest.ResponseRecorder {
+	body := `{"current_password":"` + password + `"}`
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/api/users/me", strings.NewReader(body)), 4)
+	rec := httptest.NewRecorder()
+	h.Delete(rec, req)
+	return rec
+}
+
+func expectPasswordHash(t *testing.T, mock sqlmock.Sqlmock) {
+	t.Helper()
+	hash, err := utils.HashPassword("secret1")
+	require.NoError(t, err)
+	mock.ExpectQuery(`SELECT password_hash FROM users WHERE id=\$1 AND deleted_at IS NULL`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(hash))
+}
+
+func TestAccountDelete(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	store := storage.NewMemory()
+	require.NoError(t, store.Put(context.Background(), "kyc/7/front", bytes.NewReader(pngImage)))
+	h := NewAccountHandler(db, store)
+
+	expectPasswordHash(t, mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE id=\$1 FOR UPDATE`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM agreements`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT d.storage_key FROM kyc_documents d`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key"}).AddRow("kyc/7/front"))
+	mock.ExpectExec(`UPDATE users\s+SET name = \$2, email = \$3, password_hash = \$4`).
+		WithArgs(int64(4), "Deleted user", "deleted-4@deleted.invalid", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE posts SET title = '', content = ''`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	for _, table := range personalTables {
+		mock.ExpectExec(`DELETE FROM ` + table + ` WHERE user_id = \$1`).
+			WithArgs(int64(4)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	rec := deleteAccount(h, "secret1")
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.Empty(t, store.Keys())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAccountDelete_WrongPassword(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAccountHandler(db, storage.NewMemory())
+
+	expectPasswordHash(t, mock)
+
+	rec := deleteAccount(h, "wrong")
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid_password")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAccountDelete_OpenAgreements(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAccountHandler(db, storage.NewMemory())
+
+	expectPasswordHash(t, mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE id=\$1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM agreements`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	rec := deleteAccount(h, "secret1")
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "open_agreements")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
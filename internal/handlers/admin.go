@@ -0,0 +1,641 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/rbac"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// UserStateInvalidator drops cached account state so admin changes to a
+// user apply to their next request.
+type UserStateInvalidator interface {
+	Invalidate(userID int64)
+}
+
+type AdminHandler struct {
+	DB         *sqlx.DB
+	UserStates UserStateInvalidator
+}
+
+func NewAdminHandler(db *sqlx.DB, states UserStateInvalidator) *AdminHandler {
+	return &AdminHandler{DB: db, UserStates: states}
+}
+
+var errTargetNotFound = errors.New("target not found")
+
+// errNoPrincipal means an admin action was reached without authentication,
+// which the routes never allow.
+var errNoPrincipal = errors.New("no authenticated admin")
+
+var validUserStates = map[string]bool{
+	"active":    true,
+	"blocked":   true,
+	"suspended": true,
+}
+
+// SearchUsers lists users matching the optional q (name or email), role and
+// state filters. Deleted users are only included with include_deleted=true.
+func (h *AdminHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if role := q.Get("role"); role != "" && !rbac.ValidRole(role) {
+		utils.WriteJSONError(w, "role must be one of: user, moderator, admin", http.StatusBadRequest)
+		return
+	}
+	if state := q.Get("state"); state != "" && !validUserStates[state] {
+		utils.WriteJSONError(w, "state must be one of: active, blocked, suspended", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		SELECT id, name, email, role, state, suspended_until, created_at, email_verified_at, deleted_at
+		FROM users
+		WHERE 1=1
+	`
+	args := []any{}
+
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		args = append(args, "%"+search+"%")
+		n := strconv.Itoa(len(args))
+		query += " AND (name ILIKE $" + n + " OR email ILIKE $" + n + ")"
+	}
+	if role := q.Get("role"); role != "" {
+		args = append(args, role)
+		query += " AND role = $" + strconv.Itoa(len(args))
+	}
+	if state := q.Get("state"); state != "" {
+		args = append(args, state)
+		query += " AND state = $" + strconv.Itoa(len(args))
+	}
+	if q.Get("include_deleted") != "true" {
+		query += " AND deleted_at IS NULL"
+	}
+
+	limit, offset := pagination(r)
+	args = append(args, limit, offset)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+
+	users := make([]models.User, 0)
+	if err := h.DB.Select(&users, query, args...); err != nil {
+		utils.WriteJSONError(w, "failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, users, http.StatusOK)
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var user models.User
+	err := h.DB.Get(&user, `
+		SELECT id, name, email, role, state, suspended_until, created_at, email_verified_at, deleted_at
+		FROM users
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "user not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, user, http.StatusOK)
+}
+
+// GetUserPosts lists every post of the user, including soft-deleted ones.
+func (h *AdminHandler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	posts := make([]models.Post, 0)
+	err := h.DB.Select(&posts, `
+		SELECT id, title, content, type, author_id, status, moderation_reason, created_at, deleted_at
+		FROM posts
+		WHERE author_id = $1
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch posts", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, posts, http.StatusOK)
+}
+
+// GetUserAgreements lists the agreements the user is a party to.
+func (h *AdminHandler) GetUserAgreements(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	agreements := make([]models.Agreement, 0)
+	err := h.DB.Select(&agreements, `
+		SELECT
+			id, lender_id, borrower_id, post_id,
+			principal_amount, interest_rate, total_amount, currency,
+			created_at, accepted_at, disbursed_at, start_date, due_date, completed_at,
+			payment_frequency, number_of_payments,
+			status, contract_url, contract_hash
+		FROM agreements
+		WHERE lender_id = $1 OR borrower_id = $1
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch agreements", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, agreements, http.StatusOK)
+}
+
+func (h *AdminHandler) ChangeRole(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role   string `json:"role"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if !rbac.ValidRole(input.Role) {
+		utils.WriteJSONError(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+
+	h.updateUser(w, r, targetID, "change_role", input.Reason, map[string]any{"role": input.Role},
+		"UPDATE users SET role = $2 WHERE id = $1 AND deleted_at IS NULL", input.Role)
+}
+
+func (h *AdminHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	reason, ok := decodeReason(w, r)
+	if !ok {
+		return
+	}
+
+	h.updateUser(w, r, targetID, "block", reason, nil,
+		"UPDATE users SET state = 'blocked', suspended_until = NULL WHERE id = $1 AND deleted_at IS NULL")
+}
+
+// SuspendUser suspends the user until the given time, or indefinitely when
+// until is omitted.
+func (h *AdminHandler) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string     `json:"reason"`
+		Until  *time.Time `json:"until"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json, until must be RFC 3339", http.StatusBadRequest)
+		return
+	}
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Reason == "" {
+		utils.WriteJSONError(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	if input.Until != nil && !input.Until.After(time.Now()) {
+		utils.WriteJSONError(w, "until must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	h.updateUser(w, r, targetID, "suspend", input.Reason, map[string]any{"until": input.Until},
+		"UPDATE users SET state = 'suspended', suspended_until = $2 WHERE id = $1 AND deleted_at IS NULL", input.Until)
+}
+
+// UnblockUser lifts a block or suspension.
+func (h *AdminHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	reason, ok := decodeReason(w, r)
+	if !ok {
+		return
+	}
+
+	h.updateUser(w, r, targetID, "unblock", reason, nil,
+		"UPDATE users SET state = 'active', suspended_until = NULL WHERE id = $1 AND deleted_at IS NULL")
+}
+
+// ForceLogout ends every session of the user.
+func (h *AdminHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.audited(r, targetID, nil, "force_logout", "", nil, func(tx *sqlx.Tx) error {
+		var exists bool
+		if err := tx.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", targetID); err != nil {
+			return err
+		}
+		if !exists {
+			return errTargetNotFound
+		}
+		_, err := tx.Exec("UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", targetID)
+		return err
+	})
+	h.writeActionResult(w, err, "user not found", "failed to log out user")
+}
+
+func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	targetID, ok := h.targetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	h.updateUser(w, r, targetID, "delete_user", "", nil,
+		"UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL")
+}
+
+func (h *AdminHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.audited(r, id, nil, "restore_user", "", nil, func(tx *sqlx.Tx) error {
+		return execOne(tx, "UPDATE users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL AND anonymized_at IS NULL", id)
+	})
+	h.writeActionResult(w, err, "deleted user not found", "failed to restore user")
+}
+
+func (h *AdminHandler) RestorePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.audited(r, 0, &id, "restore_post", "", nil, func(tx *sqlx.Tx) error {
+		return execOne(tx, "UPDATE posts SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	})
+	h.writeActionResult(w, err, "deleted post not found", "failed to restore post")
+}
+
+var moderationStatuses = map[string]bool{
+	"pending_review": true,
+	"hidden":         true,
+	"rejected":       true,
+}
+
+// PostQueue lists posts awaiting a moderation decision, oldest first. By
+// default these are pending_review posts; status=hidden lists posts hidden
+// by user reports.
+func (h *AdminHandler) PostQueue(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "pending_review"
+	}
+	if !moderationStatuses[status] {
+		utils.WriteJSONError(w, "status must be one of: pending_review, hidden, rejected", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := pagination(r)
+
+	posts := make([]models.Post, 0)
+	err := h.DB.Select(&posts, `
+		SELECT id, title, content, type, author_id, status, moderation_reason, created_at
+		FROM posts
+		WHERE status = $1 AND deleted_at IS NULL
+		ORDER BY created_at ASC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch posts", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, posts, http.StatusOK)
+}
+
+func (h *AdminHandler) PostReports(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	reports := make([]models.PostReport, 0)
+	err := h.DB.Select(&reports, `
+		SELECT id, post_id, reporter_id, reason, comment, created_at
+		FROM post_reports
+		WHERE post_id = $1
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch reports", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, reports, http.StatusOK)
+}
+
+// ApprovePost publishes a pending or hidden post. Reports filed so far count
+// as reviewed and no longer contribute to automatic hiding.
+func (h *AdminHandler) ApprovePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.audited(r, 0, &id, "approve_post", "", nil, func(tx *sqlx.Tx) error {
+		return execOne(tx, `
+			UPDATE posts SET status = 'published', moderation_reason = '', moderated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL AND status <> 'published'
+		`, id)
+	})
+	h.writeActionResult(w, err, "post not awaiting moderation", "failed to approve post")
+}
+
+// RejectPost takes a post off the board. The reason is shown to its author
+// with their own posts.
+func (h *AdminHandler) RejectPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	reason, ok := decodeReason(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.audited(r, 0, &id, "reject_post", reason, nil, func(tx *sqlx.Tx) error {
+		return execOne(tx, `
+			UPDATE posts SET status = 'rejected', moderation_reason = $2, moderated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL AND status <> 'rejected'
+		`, id, reason)
+	})
+	h.writeActionResult(w, err, "post not found", "failed to reject post")
+}
+
+// ReviewQueue lists published reviews reported as abusive, most reported
+// first.
+func (h *AdminHandler) ReviewQueue(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r)
+
+	reviews := make([]models.Review, 0)
+	err := h.DB.Select(&reviews, `
+		SELECT rv.id, rv.agreement_id, rv.reviewer_id, rv.reviewee_id, rv.rating, rv.comment,
+		       rv.status, rv.created_at, COUNT(rr.id) AS report_count
+		FROM reviews rv
+		JOIN review_reports rr ON rr.review_id = rv.id
+		    AND rr.created_at > COALESCE(rv.moderated_at, '-infinity')
+		WHERE rv.status = 'published'
+		GROUP BY rv.id
+		ORDER BY report_count DESC, rv.created_at ASC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, reviews, http.StatusOK)
+}
+
+func (h *AdminHandler) ReviewReports(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	reports := make([]models.ReviewReport, 0)
+	err := h.DB.Select(&reports, `
+		SELECT id, review_id, reporter_id, reason, created_at
+		FROM review_reports
+		WHERE review_id = $1
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch reports", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, reports, http.StatusOK)
+}
+
+// HideReview removes an abusive review from profiles and rating averages.
+func (h *AdminHandler) HideReview(w http.ResponseWriter, r *http.Request) {
+	reason, ok := decodeReason(w, r)
+	if !ok {
+		return
+	}
+
+	h.moderateReview(w, r, "hide_review", reason, `
+		UPDATE reviews SET status = 'hidden', moderation_reason = $2, moderated_at = NOW()
+		WHERE id = $1 AND status <> 'hidden'
+	`, reason)
+}
+
+// RestoreReview publishes a review again. Reports filed so far count as
+// reviewed and leave the moderation queue.
+func (h *AdminHandler) RestoreReview(w http.ResponseWriter, r *http.Request) {
+	h.moderateReview(w, r, "restore_review", "", `
+		UPDATE reviews SET status = 'published', moderation_reason = '', moderated_at = NOW()
+		WHERE id = $1
+	`)
+}
+
+// moderateReview runs query on the review ($1 is its ID) and records it in
+// the audit log against the reviewed user.
+func (h *AdminHandler) moderateReview(w http.ResponseWriter, r *http.Request, action, reason, query string, args ...any) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var revieweeID int64
+	if err := h.DB.Get(&revieweeID, "SELECT reviewee_id FROM reviews WHERE id = $1", id); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "review not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to moderate review", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.audited(r, revieweeID, nil, action, reason, map[string]any{"review_id": id}, func(tx *sqlx.Tx) error {
+		return execOne(tx, query, append([]any{id}, args...)...)
+	})
+	h.writeActionResult(w, err, "review already hidden", "failed to moderate review")
+}
+
+// AuditLog lists recorded admin actions, newest first, optionally filtered
+// by admin_id or target_user_id.
+func (h *AdminHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	query := `
+		SELECT id, admin_id, action, target_user_id, target_post_id, reason, details, created_at
+		FROM admin_audit_log
+		WHERE 1=1
+	`
+	args := []any{}
+
+	if adminID := q.Get("admin_id"); adminID != "" {
+		args = append(args, adminID)
+		query += " AND admin_id = $" + strconv.Itoa(len(args))
+	}
+	if targetID := q.Get("target_user_id"); targetID != "" {
+		args = append(args, targetID)
+		query += " AND target_user_id = $" + strconv.Itoa(len(args))
+	}
+
+	limit, offset := pagination(r)
+	args = append(args, limit, offset)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+
+	entries := make([]models.AuditLogEntry, 0)
+	if err := h.DB.Select(&entries, query, args...); err != nil {
+		utils.WriteJSONError(w, "failed to fetch audit log", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, entries, http.StatusOK)
+}
+
+// targetUserID parses the {id} path value and refuses actions an admin
+// takes against their own account, which could lock them out.
+func (h *AdminHandler) targetUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	targetID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return 0, false
+	}
+	if targetID == caller.UserID {
+		utils.WriteJSONError(w, "cannot perform this action on yourself", http.StatusBadRequest)
+		return 0, false
+	}
+
+	return targetID, true
+}
+
+func decodeReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return "", false
+	}
+
+	input.Reason = strings.TrimSpace(input.Reason)
+	if input.Reason == "" {
+		utils.WriteJSONError(w, "reason is required", http.StatusBadRequest)
+		return "", false
+	}
+
+	return input.Reason, true
+}
+
+// updateUser runs a single-row UPDATE on the target user ($1 is the user ID)
+// and records it in the audit log.
+func (h *AdminHandler) updateUser(w http.ResponseWriter, r *http.Request, targetID int64, action, reason string, details map[string]any, query string, args ...any) {
+	err := h.audited(r, targetID, nil, action, reason, details, func(tx *sqlx.Tx) error {
+		return execOne(tx, query, append([]any{targetID}, args...)...)
+	})
+	h.writeActionResult(w, err, "user not found", "failed to update user")
+}
+
+// audited runs action and records it in the audit log in one transaction,
+// so no change happens without a trace.
+func (h *AdminHandler) audited(r *http.Request, targetUserID int64, targetPostID *int64, action, reason string, details map[string]any, fn func(tx *sqlx.Tx) error) error {
+	adminID, ok := principal.UserID(r.Context())
+	if !ok {
+		return errNoPrincipal
+	}
+
+	if details == nil {
+		details = map[string]any{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	var target *int64
+	if targetUserID != 0 {
+		target = &targetUserID
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO admin_audit_log (admin_id, action, target_user_id, target_post_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, adminID, action, target, targetPostID, reason, detailsJSON)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if target != nil && h.UserStates != nil {
+		h.UserStates.Invalidate(*target)
+	}
+	return nil
+}
+
+func (h *AdminHandler) writeActionResult(w http.ResponseWriter, err error, notFoundMsg, failedMsg string) {
+	switch {
+	case errors.Is(err, errTargetNotFound):
+		utils.WriteJSONError(w, notFoundMsg, http.StatusNotFound)
+	case err != nil:
+		utils.WriteJSONError(w, failedMsg, http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// execOne runs an UPDATE that is expected to touch exactly one row and
+// reports errTargetNotFound when it touched none.
+func execOne(tx *sqlx.Tx, query string, args ...any) error {
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errTargetNotFound
+	}
+	return nil
+}
@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeInvalidator []int64
+
+func (f *fakeInvalidator) Invalidate(userID int64) {
+	*f = append(*f, userID)
+}
+
+func expectAudit(mock sqlmock.Sqlmock, action string) {
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(1), action, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// SearchUsers
+func TestAdminHandler_SearchUsers_Filters(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users?q=ali&state=blocked&limit=10", nil)
+
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "role", "state", "suspended_until", "created_at", "email_verified_at", "deleted_at"}).
+		AddRow(7, "Ali", "ali@example.com", "user", "blocked", nil, time.Now(), time.Now(), nil)
+	mock.ExpectQuery(`FROM users\s+WHERE 1=1 AND \(name ILIKE \$1 OR email ILIKE \$1\) AND state = \$2 AND deleted_at IS NULL ORDER BY id DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs("%ali%", "blocked", 10, 0).
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	h.SearchUsers(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "ali@example.com")
+	require.NotContains(t, rec.Body.String(), "password")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_SearchUsers_InvalidFilters(t *testing.T) {
+	for _, query := range []string{"role=superuser", "state=gone"} {
+		t.Run(query, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			h := NewAdminHandler(db, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/users?"+query, nil)
+			rec := httptest.NewRecorder()
+			h.SearchUsers(rec, req)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// GetUser
+func TestAdminHandler_GetUser_NotFound(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users/5", nil)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectQuery(`FROM users\s+WHERE id = \$1`).
+		WithArgs("5").
+		WillReturnError(sql.ErrNoRows)
+
+	rec := httptest.NewRecorder()
+	h.GetUser(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ChangeRole
+func TestAdminHandler_ChangeRole_InvalidRole(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/users/5/role", bytes.NewBufferString(`{"role":"root"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	rec := httptest.NewRecorder()
+	h.ChangeRole(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid role")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_ChangeRole_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	states := &fakeInvalidator{}
+	h := NewAdminHandler(db, states)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/users/5/role", bytes.NewBufferString(`{"role":"moderator","reason":"trusted"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET role = \$2`).
+		WithArgs(int64(5), "moderator").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, "change_role")
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.ChangeRole(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.Equal(t, []int64{5}, []int64(*states))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// BlockUser
+func TestAdminHandler_BlockUser_ReasonRequired(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/5/block", bytes.NewBufferString(`{"reason":"  "}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	rec := httptest.NewRecorder()
+	h.BlockUser(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "reason is required")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_BlockUser_Self(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/1/block", bytes.NewBufferString(`{"reason":"test"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "1")
+
+	rec := httptest.NewRecorder()
+	h.BlockUser(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_BlockUser_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/5/block", bytes.NewBufferString(`{"reason":"fraud"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET state = 'blocked'`).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(1), "block", sqlmock.AnyArg(), nil, "fraud", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.BlockUser(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// SuspendUser
+func TestAdminHandler_SuspendUser_PastUntil(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/5/suspend",
+		bytes.NewBufferString(`{"reason":"spam","until":"2000-01-01T00:00:00Z"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	rec := httptest.NewRecorder()
+	h.SuspendUser(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "until must be in the future")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_SuspendUser_NotFound(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/5/suspend", bytes.NewBufferString(`{"reason":"spam"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET state = 'suspended'`).
+		WithArgs(int64(5), nil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.SuspendUser(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ForceLogout
+func TestAdminHandler_ForceLogout_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/5/logout", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE user_id = \$1`).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	expectAudit(mock, "force_logout")
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.ForceLogout(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// DeleteUser
+func TestAdminHandler_DeleteUser_Self(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/admin/users/1", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "1")
+
+	rec := httptest.NewRecorder()
+	h.DeleteUser(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "cannot perform this action on yourself")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_DeleteUser_NotFound(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/admin/users/5", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET deleted_at = NOW\(\)`).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.DeleteUser(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_DeleteUser_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/admin/users/5", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET deleted_at = NOW\(\)`).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, "delete_user")
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.DeleteUser(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// RestoreUser
+func TestAdminHandler_RestoreUser_NotDeleted(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/5/restore", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET deleted_at = NULL`).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.RestoreUser(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, rec.Body.String(), "deleted user not found")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_RestoreUser_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/users/5/restore", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "5")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET deleted_at = NULL`).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, "restore_user")
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.RestoreUser(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// RestorePost
+func TestAdminHandler_RestorePost_DBError(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/posts/3/restore", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "3")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE posts SET deleted_at = NULL`).
+		WithArgs(int64(3)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.RestorePost(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_RestorePost_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/posts/3/restore", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "3")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE posts SET deleted_at = NULL`).
+		WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(1), "restore_post", nil, sqlmock.AnyArg(), "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.RestorePost(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// AuditLog
+func TestAdminHandler_AuditLog_FilterByTarget(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/audit-log?target_user_id=5", nil)
+
+	rows := sqlmock.NewRows([]string{"id", "admin_id", "action", "target_user_id", "target_post_id", "reason", "details", "created_at"}).
+		AddRow(1, 1, "block", 5, nil, "fraud", []byte(`{}`), time.Now())
+	mock.ExpectQuery(`FROM admin_audit_log\s+WHERE 1=1 AND target_user_id = \$1 ORDER BY id DESC LIMIT \$2 OFFSET \$3`).
+		WithArgs("5", 50, 0).
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	h.AuditLog(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"action":"block"`)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// PostQueue
+func TestAdminHandler_PostQueue_InvalidStatus(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/posts?status=published", nil)
+
+	rec := httptest.NewRecorder()
+	h.PostQueue(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_PostQueue_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/posts", nil)
+
+	rows := sqlmock.NewRows([]string{"id", "title", "content", "type", "author_id", "status", "moderation_reason", "created_at"}).
+		AddRow(3, "Lend", "10k", "lend", 4, "pending_review", "", time.Now())
+	mock.ExpectQuery(`FROM posts\s+WHERE status = \$1`).
+		WithArgs("pending_review", 50, 0).
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	h.PostQueue(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"status":"pending_review"`)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// ApprovePost
+func TestAdminHandler_ApprovePost_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/posts/3/approve", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "3")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE posts SET status = 'published'`).
+		WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, "approve_post")
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.ApprovePost(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// RejectPost
+func TestAdminHandler_RejectPost_ReasonRequired(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/posts/3/reject", bytes.NewBufferString(`{}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "3")
+
+	rec := httptest.NewRecorder()
+	h.RejectPost(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_RejectPost_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/posts/3/reject", bytes.NewBufferString(`{"reason":"looks like a scam"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "3")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE posts SET status = 'rejected'`).
+		WithArgs(int64(3), "looks like a scam").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(mock, "reject_post")
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.RejectPost(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Reviews
+func TestAdminHandler_ReviewQueue(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	mock.ExpectQuery(`FROM reviews rv\s+JOIN review_reports rr`).
+		WithArgs(defaultPageLimit, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agreement_id", "reviewer_id", "reviewee_id", "rating", "comment", "status", "created_at", "report_count"}).
+			AddRow(10, 3, 2, 1, 1, "abusive text", "published", time.Now(), 2))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/reviews", nil)
+	rec := httptest.NewRecorder()
+	h.ReviewQueue(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"report_count":2`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_HideReview_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/reviews/10/hide", bytes.NewBufferString(`{"reason":"insults"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "10")
+
+	mock.ExpectQuery(`SELECT reviewee_id FROM reviews WHERE id = \$1`).
+		WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"reviewee_id"}).AddRow(5))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE reviews SET status = 'hidden'`).
+		WithArgs(int64(10), "insults").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(1), "hide_review", int64(5), nil, "insults", []byte(`{"review_id":10}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.HideReview(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdminHandler_HideReview_NotFound(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAdminHandler(db, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/reviews/10/hide", bytes.NewBufferString(`{"reason":"insults"}`))
+	req = asUser(req, 1)
+	req.SetPathValue("id", "10")
+
+	mock.ExpectQuery(`SELECT reviewee_id FROM reviews`).
+		WillReturnError(sql.ErrNoRows)
+
+	rec := httptest.NewRecorder()
+	h.HideReview(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -10,15 +10,19 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/notify"
+	"github.com/railanbaigazy/uade-api/internal/rbac"
 	"github.com/railanbaigazy/uade-api/internal/utils"
 )
 
 type AgreementHandler struct {
-	DB *sqlx.DB
+	DB  *sqlx.DB
+	Cfg *config.Config
 }
 
-func NewAgreementHandler(db *sqlx.DB) *AgreementHandler {
-	return &AgreementHandler{DB: db}
+func NewAgreementHandler(db *sqlx.DB, cfg *config.Config) *AgreementHandler {
+	return &AgreementHandler{DB: db, Cfg: cfg}
 }
 
 func (h *AgreementHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -79,14 +83,18 @@ func (h *AgreementHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userIDStr := r.Header.Get("X-User-ID")
-	borrowerID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	borrowerID := caller.UserID
 
 	var post struct {
-		AuthorID int    `db:"author_id"`
-		Type     string `db:"type"`
+		AuthorID      int    `db:"author_id"`
+		Type          string `db:"type"`
+		MinTrustScore *int   `db:"min_trust_score"`
 	}
-	err = h.DB.Get(&post, "SELECT author_id, type FROM posts WHERE id=$1", input.PostID)
+	err = h.DB.Get(&post, "SELECT author_id, type, min_trust_score FROM posts WHERE id=$1 AND deleted_at IS NULL AND status = 'published'", input.PostID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.WriteJSONError(w, "post not found", http.StatusNotFound)
@@ -107,6 +115,19 @@ func (h *AgreementHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if post.MinTrustScore != nil {
+		var score int
+		err = h.DB.Get(&score, "SELECT COALESCE((SELECT score FROM trust_scores WHERE user_id=$1), 0)", borrowerID)
+		if err != nil {
+			utils.WriteJSONError(w, "failed to check trust score", http.StatusInternalServerError)
+			return
+		}
+		if score < *post.MinTrustScore {
+			utils.WriteJSONErrorCode(w, "your trust score is below the lender's minimum", "trust_score_too_low", http.StatusForbidden)
+			return
+		}
+	}
+
 	lenderID := post.AuthorID
 	totalAmount := input.PrincipalAmount * (1 + input.InterestRate)
 
@@ -121,7 +142,34 @@ func (h *AgreementHandler) Create(w http.ResponseWriter, r *http.Request) {
 		RETURNING id, created_at
 	`
 
-	err = h.DB.Get(&agreement, query,
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create agreement", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if !requireSecondFactor(w, r, tx, h.Cfg, borrowerID, input.PrincipalAmount) {
+		return
+	}
+	if err := lockUser(tx, borrowerID); err != nil {
+		utils.WriteJSONError(w, "failed to create agreement", http.StatusInternalServerError)
+		return
+	}
+	limitErr, err := checkAmountLimit(tx, h.Cfg, borrowerID, "borrow", input.PrincipalAmount)
+	if err == nil && limitErr == nil {
+		limitErr, err = checkBorrowerLimits(tx, h.Cfg, borrowerID, input.PrincipalAmount, true)
+	}
+	if err != nil {
+		utils.WriteJSONError(w, "failed to check limits", http.StatusInternalServerError)
+		return
+	}
+	if limitErr != nil {
+		limitErr.write(w)
+		return
+	}
+
+	err = tx.Get(&agreement, query,
 		lenderID, borrowerID, input.PostID,
 		input.PrincipalAmount, input.InterestRate, totalAmount, "KZT",
 		dueDate, input.PaymentFrequency, input.NumberOfPayments,
@@ -132,6 +180,23 @@ func (h *AgreementHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	agreementID := int64(agreement.ID)
+	err = notify.Send(tx, notify.Event{
+		UserID:      int64(lenderID),
+		Type:        notify.AgreementRequested,
+		AgreementID: &agreementID,
+		Data:        map[string]any{"post_id": input.PostID, "principal_amount": input.PrincipalAmount, "currency": "KZT"},
+	})
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create agreement", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to create agreement", http.StatusInternalServerError)
+		return
+	}
+
 	agreement.LenderID = int64(lenderID)
 	agreement.BorrowerID = borrowerID
 	agreement.PostID = input.PostID
@@ -152,8 +217,11 @@ func (h *AgreementHandler) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AgreementHandler) GetUserAgreements(w http.ResponseWriter, r *http.Request) {
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
 	statusFilter := r.URL.Query().Get("status")
 	roleFilter := r.URL.Query().Get("role")
@@ -185,6 +253,20 @@ func (h *AgreementHandler) GetUserAgreements(w http.ResponseWriter, r *http.Requ
 		query += " AND borrower_id = $1"
 	}
 
+	minScore, ok := minScoreParam(w, r)
+	if !ok {
+		return
+	}
+	if minScore != nil {
+		// filters on the other party, e.g. a lender screening incoming requests
+		argCount++
+		query += ` AND COALESCE((
+			SELECT score FROM trust_scores
+			WHERE user_id = CASE WHEN lender_id = $1 THEN borrower_id ELSE lender_id END
+		), 0) >= $` + strconv.Itoa(argCount)
+		args = append(args, *minScore)
+	}
+
 	query += " ORDER BY created_at DESC"
 
 	agreements := make([]models.Agreement, 0)
@@ -200,8 +282,11 @@ func (h *AgreementHandler) GetUserAgreements(w http.ResponseWriter, r *http.Requ
 
 func (h *AgreementHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
 	var agreement models.Agreement
 	query := `
@@ -226,7 +311,8 @@ func (h *AgreementHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if agreement.LenderID != userID && agreement.BorrowerID != userID {
+	isParty := agreement.LenderID == userID || agreement.BorrowerID == userID
+	if !isParty && !rbac.Has(caller.Role, rbac.AgreementsViewAll) {
 		utils.WriteJSONError(w, "not authorized to view this agreement", http.StatusForbidden)
 		return
 	}
@@ -238,8 +324,11 @@ func (h *AgreementHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 
 func (h *AgreementHandler) Accept(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
 	var agreement models.Agreement
 	err := h.DB.Get(&agreement, "SELECT * FROM agreements WHERE id=$1", id)
@@ -262,16 +351,66 @@ func (h *AgreementHandler) Accept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to accept agreement", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if !requireSecondFactor(w, r, tx, h.Cfg, userID, agreement.PrincipalAmount) {
+		return
+	}
+
+	// other requests of the borrower may have been accepted since this one
+	// was made, so their limits are checked again under lock
+	if err := lockUser(tx, agreement.BorrowerID); err != nil {
+		utils.WriteJSONError(w, "failed to accept agreement", http.StatusInternalServerError)
+		return
+	}
+	limitErr, err := checkAmountLimit(tx, h.Cfg, userID, "lend", agreement.PrincipalAmount)
+	if err == nil && limitErr == nil {
+		limitErr, err = checkBorrowerLimits(tx, h.Cfg, agreement.BorrowerID, agreement.PrincipalAmount, false)
+	}
+	if err != nil {
+		utils.WriteJSONError(w, "failed to check limits", http.StatusInternalServerError)
+		return
+	}
+	if limitErr != nil {
+		limitErr.write(w)
+		return
+	}
+
 	now := time.Now()
-	_, err = h.DB.Exec(`
+	res, err := tx.Exec(`
 		UPDATE agreements 
 		SET status = 'active', accepted_at = $1, start_date = $2
-		WHERE id = $3
+		WHERE id = $3 AND status = 'pending'
 	`, now, now, id)
 	if err != nil {
 		utils.WriteJSONError(w, "failed to accept agreement", http.StatusInternalServerError)
 		return
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.WriteJSONError(w, "can only accept pending agreements", http.StatusConflict)
+		return
+	}
+
+	agreementID := int64(agreement.ID)
+	err = notify.Send(tx, notify.Event{
+		UserID:      agreement.BorrowerID,
+		Type:        notify.AgreementAccepted,
+		AgreementID: &agreementID,
+	})
+	if err != nil {
+		utils.WriteJSONError(w, "failed to accept agreement", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to accept agreement", http.StatusInternalServerError)
+		return
+	}
 
 	agreement.Status = "active"
 	agreement.AcceptedAt = &now
@@ -285,8 +424,11 @@ func (h *AgreementHandler) Accept(w http.ResponseWriter, r *http.Request) {
 
 func (h *AgreementHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
 	var agreement models.Agreement
 	err := h.DB.Get(&agreement, "SELECT * FROM agreements WHERE id=$1", id)
@@ -309,12 +451,46 @@ func (h *AgreementHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.DB.Exec("UPDATE agreements SET status = 'cancelled' WHERE id = $1", id)
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to cancel agreement", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the lender may have accepted it since it was read
+	res, err := tx.Exec("UPDATE agreements SET status = 'cancelled' WHERE id = $1 AND status = 'pending'", id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to cancel agreement", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.WriteJSONError(w, "can only cancel pending agreements", http.StatusConflict)
+		return
+	}
+
+	// the other party learns who cancelled
+	otherPartyID := agreement.LenderID
+	if userID == agreement.LenderID {
+		otherPartyID = agreement.BorrowerID
+	}
+	agreementID := int64(agreement.ID)
+	err = notify.Send(tx, notify.Event{
+		UserID:      otherPartyID,
+		Type:        notify.AgreementCancelled,
+		AgreementID: &agreementID,
+		Data:        map[string]any{"cancelled_by": userID},
+	})
 	if err != nil {
 		utils.WriteJSONError(w, "failed to cancel agreement", http.StatusInternalServerError)
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to cancel agreement", http.StatusInternalServerError)
+		return
+	}
+
 	agreement.Status = "cancelled"
 
 	if err := json.NewEncoder(w).Encode(agreement); err != nil {
@@ -324,8 +500,11 @@ func (h *AgreementHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 
 func (h *AgreementHandler) UpdateContract(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
 	var input struct {
 		ContractURL  string `json:"contract_url"`
@@ -11,6 +11,9 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/trust"
 	"github.com/railanbaigazy/uade-api/internal/utils"
 	"github.com/stretchr/testify/require"
 )
@@ -18,7 +21,7 @@ import (
 // Create
 func TestAgreementHandler_Create_BadJSON(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(`{`))
 	rec := httptest.NewRecorder()
@@ -31,7 +34,7 @@ func TestAgreementHandler_Create_BadJSON(t *testing.T) {
 
 func TestAgreementHandler_Create_MissingPostID(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"principal_amount": 1000, "interest_rate": 0.1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
@@ -45,7 +48,7 @@ func TestAgreementHandler_Create_MissingPostID(t *testing.T) {
 
 func TestAgreementHandler_Create_InvalidPrincipalAmount(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 1, "principal_amount": -100, "interest_rate": 0.1, "due_date": "2026-01-01", "payment_frequency": "one_time", "number_of_payments": 1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
@@ -59,7 +62,7 @@ func TestAgreementHandler_Create_InvalidPrincipalAmount(t *testing.T) {
 
 func TestAgreementHandler_Create_InvalidInterestRate(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 1, "principal_amount": 1000, "interest_rate": -0.5, "due_date": "2026-01-01", "payment_frequency": "one_time", "number_of_payments": 1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
@@ -73,7 +76,7 @@ func TestAgreementHandler_Create_InvalidInterestRate(t *testing.T) {
 
 func TestAgreementHandler_Create_InvalidPaymentFrequency(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 1, "principal_amount": 1000, "interest_rate": 0.1, "due_date": "2026-01-01", "payment_frequency": "invalid", "number_of_payments": 1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
@@ -87,7 +90,7 @@ func TestAgreementHandler_Create_InvalidPaymentFrequency(t *testing.T) {
 
 func TestAgreementHandler_Create_InvalidDueDateFormat(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 1, "principal_amount": 1000, "interest_rate": 0.1, "due_date": "01/01/2026", "payment_frequency": "one_time", "number_of_payments": 1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
@@ -101,13 +104,13 @@ func TestAgreementHandler_Create_InvalidDueDateFormat(t *testing.T) {
 
 func TestAgreementHandler_Create_PostNotFound(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 999, "principal_amount": 1000, "interest_rate": 0.1, "due_date": "2026-12-31", "payment_frequency": "one_time", "number_of_payments": 1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "2")
+	req = asUser(req, 2)
 
-	mock.ExpectQuery(`SELECT author_id, type FROM posts WHERE id=\$1`).
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts WHERE id=\$1`).
 		WithArgs(999).
 		WillReturnError(sql.ErrNoRows)
 
@@ -122,13 +125,13 @@ func TestAgreementHandler_Create_PostNotFound(t *testing.T) {
 
 func TestAgreementHandler_Create_WrongPostType(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 1, "principal_amount": 1000, "interest_rate": 0.1, "due_date": "2026-12-31", "payment_frequency": "one_time", "number_of_payments": 1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "2")
+	req = asUser(req, 2)
 
-	mock.ExpectQuery(`SELECT author_id, type FROM posts`).
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
 		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "borrow"))
 
 	rec := httptest.NewRecorder()
@@ -142,13 +145,13 @@ func TestAgreementHandler_Create_WrongPostType(t *testing.T) {
 
 func TestAgreementHandler_Create_OwnPost(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 1, "principal_amount": 1000, "interest_rate": 0.1, "due_date": "2026-12-31", "payment_frequency": "one_time", "number_of_payments": 1}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 
-	mock.ExpectQuery(`SELECT author_id, type FROM posts`).
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
 		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "lend"))
 
 	rec := httptest.NewRecorder()
@@ -162,20 +165,32 @@ func TestAgreementHandler_Create_OwnPost(t *testing.T) {
 
 func TestAgreementHandler_Create_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"post_id": 1, "principal_amount": 1000, "interest_rate": 0.1, "due_date": "2026-12-31", "payment_frequency": "monthly", "number_of_payments": 12}`
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "2")
+	req = asUser(req, 2)
 
-	mock.ExpectQuery(`SELECT author_id, type FROM posts`).
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
 		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "lend"))
 
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE id=\$1 FOR UPDATE`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
 	rows := sqlmock.NewRows([]string{"id", "created_at"}).
 		AddRow(10, time.Now())
 
 	mock.ExpectQuery(`INSERT INTO agreements`).
 		WillReturnRows(rows)
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(int64(1), "agreement_requested", sqlmock.AnyArg(),
+			[]byte(`{"currency":"KZT","post_id":1,"principal_amount":1000}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	rec := httptest.NewRecorder()
 	h.Create(rec, req)
@@ -193,13 +208,161 @@ func TestAgreementHandler_Create_Success(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestAgreementHandler_Create_TrustScoreTooLow(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{})
+
+	body := `{"post_id": 1, "principal_amount": 1000, "interest_rate": 0.1, "due_date": "2026-12-31", "payment_frequency": "one_time", "number_of_payments": 1}`
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
+	req = asUser(req, 2)
+
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type", "min_trust_score"}).AddRow(1, "lend", 60))
+	mock.ExpectQuery(`SELECT score FROM trust_scores WHERE user_id=\$1`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(45))
+
+	rec := httptest.NewRecorder()
+	h.Create(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "trust_score_too_low")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// limitColumns are the columns checkAmountLimit reads about a user.
+var limitColumns = []string{"email_verified_at", "identity_verified_at", "trust_score"}
+
+// expectLimitsLocked expects Create or Accept to lock the borrower before
+// checking limits.
+func expectLimitsLocked(mock sqlmock.Sqlmock, borrowerID int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE id=\$1 FOR UPDATE`).
+		WithArgs(borrowerID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(borrowerID))
+}
+
+func createAgreement(h *AgreementHandler, amount string) *httptest.ResponseRecorder {
+	body := `{"post_id": 1, "principal_amount": ` + amount + `, "interest_rate": 0.1, "due_date": "2026-12-31", "payment_frequency": "one_time", "number_of_payments": 1}`
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements", strings.NewReader(body))
+	req = asUser(req, 2)
+	rec := httptest.NewRecorder()
+	h.Create(rec, req)
+	return rec
+}
+
+func TestAgreementHandler_Create_VerificationLimit(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{MaxAgreementAmount: map[int]float64{
+		trust.LevelEmail:    100000,
+		trust.LevelIdentity: 0,
+	}})
+
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "lend"))
+	expectLimitsLocked(mock, 2)
+	mock.ExpectQuery(`SELECT email_verified_at, identity_verified_at, .* FROM users WHERE id=\$1`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows(limitColumns).AddRow(time.Now(), nil, 40))
+	mock.ExpectRollback()
+
+	rec := createAgreement(h, "250000")
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "verification_limit_exceeded")
+	require.Contains(t, rec.Body.String(), "verify your identity")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAgreementHandler_Create_IdentityVerifiedHasNoLimit(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{MaxAgreementAmount: map[int]float64{
+		trust.LevelEmail:    100000,
+		trust.LevelIdentity: 0,
+	}})
+
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "lend"))
+	expectLimitsLocked(mock, 2)
+	mock.ExpectQuery(`SELECT email_verified_at, identity_verified_at, .* FROM users`).
+		WillReturnRows(sqlmock.NewRows(limitColumns).AddRow(time.Now(), time.Now(), 40))
+	mock.ExpectQuery(`INSERT INTO agreements`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, time.Now()))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := createAgreement(h, "250000")
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAgreementHandler_Create_TrustScoreLimit(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{MaxAgreementAmountByScore: []config.ScoreLimit{
+		{MinScore: 0, Amount: 50000},
+		{MinScore: 50, Amount: 0},
+	}})
+
+	mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "lend"))
+	expectLimitsLocked(mock, 2)
+	mock.ExpectQuery(`FROM users WHERE id=\$1`).
+		WillReturnRows(sqlmock.NewRows(limitColumns).AddRow(time.Now(), nil, 40))
+	mock.ExpectRollback()
+
+	rec := createAgreement(h, "60000")
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "trust_score_limit_exceeded")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAgreementHandler_Create_BorrowerLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		outstanding float64
+		pending     int
+		code        string
+	}{
+		{"too many pending requests", 0, 3, "pending_limit_exceeded"},
+		{"too much outstanding", 480000, 0, "outstanding_limit_exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			h := NewAgreementHandler(db, &config.Config{MaxOutstandingPrincipal: 500000, MaxPendingRequests: 3})
+
+			mock.ExpectQuery(`SELECT author_id, type, min_trust_score FROM posts`).
+				WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "lend"))
+			expectLimitsLocked(mock, 2)
+			mock.ExpectQuery(`FROM agreements\s+WHERE borrower_id = \$1`).
+				WithArgs(int64(2)).
+				WillReturnRows(sqlmock.NewRows([]string{"outstanding", "pending"}).AddRow(tt.outstanding, tt.pending))
+			mock.ExpectRollback()
+
+			rec := createAgreement(h, "30000")
+
+			require.Equal(t, http.StatusForbidden, rec.Code)
+			require.Contains(t, rec.Body.String(), tt.code)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
 // GetUserAgreements
 func TestAgreementHandler_GetUserAgreements_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/agreements", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 
 	now := time.Now()
 	rows := sqlmock.NewRows([]string{
@@ -231,10 +394,10 @@ func TestAgreementHandler_GetUserAgreements_Success(t *testing.T) {
 
 func TestAgreementHandler_GetUserAgreements_WithStatusFilter(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/agreements?status=active", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 
 	rows := sqlmock.NewRows([]string{
 		"id", "lender_id", "borrower_id", "post_id",
@@ -256,13 +419,45 @@ func TestAgreementHandler_GetUserAgreements_WithStatusFilter(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestAgreementHandler_GetUserAgreements_MinScoreFilter(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agreements?status=pending&role=lender&min_score=60", nil)
+	req = asUser(req, 1)
+
+	mock.ExpectQuery(`SELECT .* FROM agreements .* AND lender_id = \$1 AND COALESCE\(\( SELECT score FROM trust_scores .* \), 0\) >= \$3`).
+		WithArgs(int64(1), "pending", 60).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	rec := httptest.NewRecorder()
+	h.GetUserAgreements(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAgreementHandler_GetUserAgreements_InvalidMinScore(t *testing.T) {
+	db, _ := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agreements?min_score=101", nil)
+	req = asUser(req, 1)
+
+	rec := httptest.NewRecorder()
+	h.GetUserAgreements(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
 // GetByID
 func TestAgreementHandler_GetByID_NotFound(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/agreements/999", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "999")
 
 	mock.ExpectQuery(`SELECT .* FROM agreements WHERE id = \$1`).
@@ -280,10 +475,10 @@ func TestAgreementHandler_GetByID_NotFound(t *testing.T) {
 
 func TestAgreementHandler_GetByID_Forbidden(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/agreements/1", nil)
-	req.Header.Set("X-User-ID", "3")
+	req = asUser(req, 3)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -316,10 +511,10 @@ func TestAgreementHandler_GetByID_Forbidden(t *testing.T) {
 
 func TestAgreementHandler_GetByID_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodGet, "/api/agreements/1", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -353,13 +548,48 @@ func TestAgreementHandler_GetByID_Success(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestAgreementHandler_GetByID_ModeratorCanView(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/agreements/1", nil)
+	req = principal.WithRequest(req, principal.Principal{UserID: 3, Role: "moderator"})
+	req.SetPathValue("id", "1")
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{
+		"id", "lender_id", "borrower_id", "post_id",
+		"principal_amount", "interest_rate", "total_amount", "currency",
+		"created_at", "accepted_at", "disbursed_at", "start_date", "due_date", "completed_at",
+		"payment_frequency", "number_of_payments",
+		"status", "contract_url", "contract_hash",
+	}).AddRow(
+		1, 1, 2, 10,
+		1000.0, 0.1, 1100.0, "KZT",
+		now, nil, nil, nil, now.AddDate(0, 1, 0), nil,
+		"one_time", 1,
+		"disputed", nil, nil,
+	)
+
+	mock.ExpectQuery(`SELECT .* FROM agreements WHERE id = \$1`).
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	h.GetByID(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 // Accept
 func TestAgreementHandler_Accept_NotFound(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements/999/accept", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "999")
 
 	mock.ExpectQuery(`SELECT \* FROM agreements WHERE id=\$1`).
@@ -377,10 +607,10 @@ func TestAgreementHandler_Accept_NotFound(t *testing.T) {
 
 func TestAgreementHandler_Accept_NotLender(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/accept", nil)
-	req.Header.Set("X-User-ID", "2")
+	req = asUser(req, 2)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -413,10 +643,10 @@ func TestAgreementHandler_Accept_NotLender(t *testing.T) {
 
 func TestAgreementHandler_Accept_NotPending(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/accept", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -449,10 +679,10 @@ func TestAgreementHandler_Accept_NotPending(t *testing.T) {
 
 func TestAgreementHandler_Accept_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/accept", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -474,8 +704,15 @@ func TestAgreementHandler_Accept_Success(t *testing.T) {
 		WithArgs("1").
 		WillReturnRows(rows)
 
-	mock.ExpectExec(`UPDATE agreements SET status = 'active', accepted_at = \$1, start_date = \$2 WHERE id = \$3`).
+	expectLimitsLocked(mock, 2)
+	mock.ExpectExec(`UPDATE agreements SET status = 'active', accepted_at = \$1, start_date = \$2 WHERE id = \$3 AND status = 'pending'`).
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(int64(2), "agreement_accepted", sqlmock.AnyArg(), []byte(`{}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	rec := httptest.NewRecorder()
 	h.Accept(rec, req)
@@ -490,13 +727,80 @@ func TestAgreementHandler_Accept_Success(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+// pendingAgreementRows is agreement 1 from lender 1 to borrower 2 over
+// 1000 KZT awaiting acceptance.
+func pendingAgreementRows() *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{
+		"id", "lender_id", "borrower_id", "post_id",
+		"principal_amount", "interest_rate", "total_amount", "currency",
+		"created_at", "accepted_at", "disbursed_at", "start_date", "due_date", "completed_at",
+		"payment_frequency", "number_of_payments",
+		"status", "contract_url", "contract_hash",
+	}).AddRow(
+		1, 1, 2, 10,
+		1000.0, 0.1, 1100.0, "KZT",
+		now, nil, nil, nil, now.AddDate(0, 1, 0), nil,
+		"one_time", 1,
+		"pending", nil, nil,
+	)
+}
+
+func TestAgreementHandler_Accept_OutstandingLimit(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{MaxOutstandingPrincipal: 5000, MaxPendingRequests: 1})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/accept", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "1")
+
+	mock.ExpectQuery(`SELECT \* FROM agreements WHERE id=\$1`).
+		WillReturnRows(pendingAgreementRows())
+	expectLimitsLocked(mock, 2)
+	// the pending request being accepted does not count against the borrower
+	mock.ExpectQuery(`FROM agreements\s+WHERE borrower_id = \$1`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"outstanding", "pending"}).AddRow(4500.0, 1))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.Accept(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "outstanding_limit_exceeded")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAgreementHandler_Accept_AlreadyAccepted(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/accept", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "1")
+
+	mock.ExpectQuery(`SELECT \* FROM agreements WHERE id=\$1`).
+		WillReturnRows(pendingAgreementRows())
+	expectLimitsLocked(mock, 2)
+	// accepted by a concurrent request after it was read
+	mock.ExpectExec(`UPDATE agreements`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.Accept(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 // Cancel
 func TestAgreementHandler_Cancel_NotFound(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements/999/cancel", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "999")
 
 	mock.ExpectQuery(`SELECT \* FROM agreements WHERE id=\$1`).
@@ -513,10 +817,10 @@ func TestAgreementHandler_Cancel_NotFound(t *testing.T) {
 
 func TestAgreementHandler_Cancel_NotAuthorized(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/cancel", nil)
-	req.Header.Set("X-User-ID", "3")
+	req = asUser(req, 3)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -549,10 +853,10 @@ func TestAgreementHandler_Cancel_NotAuthorized(t *testing.T) {
 
 func TestAgreementHandler_Cancel_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/cancel", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -574,9 +878,16 @@ func TestAgreementHandler_Cancel_Success(t *testing.T) {
 		WithArgs("1").
 		WillReturnRows(rows)
 
-	mock.ExpectExec(`UPDATE agreements SET status = 'cancelled' WHERE id = \$1`).
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE agreements SET status = 'cancelled' WHERE id = \$1 AND status = 'pending'`).
 		WithArgs("1").
 		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(int64(2), "agreement_cancelled", sqlmock.AnyArg(), []byte(`{"cancelled_by":1}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	rec := httptest.NewRecorder()
 	h.Cancel(rec, req)
@@ -590,12 +901,43 @@ func TestAgreementHandler_Cancel_Success(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestAgreementHandler_Cancel_AcceptedMeanwhile(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAgreementHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements/1/cancel", nil)
+	req = asUser(req, 2)
+	req.SetPathValue("id", "1")
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "lender_id", "borrower_id", "post_id", "due_date", "status"}).
+		AddRow(1, 1, 2, 10, now.AddDate(0, 1, 0), "pending")
+	mock.ExpectQuery(`SELECT \* FROM agreements WHERE id=\$1`).
+		WithArgs("1").
+		WillReturnRows(rows)
+
+	// the lender accepted between the read and the update
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE agreements SET status = 'cancelled' WHERE id = \$1 AND status = 'pending'`).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.Cancel(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "can only cancel pending agreements")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 // UpdateContract
 func TestAgreementHandler_UpdateContract_BadJSON(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPut, "/api/agreements/1/contract", strings.NewReader(`{`))
+	req = asUser(req, 1)
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
@@ -607,10 +949,11 @@ func TestAgreementHandler_UpdateContract_BadJSON(t *testing.T) {
 
 func TestAgreementHandler_UpdateContract_MissingURL(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"contract_hash": "abc123"}`
 	req := httptest.NewRequest(http.MethodPut, "/api/agreements/1/contract", strings.NewReader(body))
+	req = asUser(req, 1)
 	req.SetPathValue("id", "1")
 	rec := httptest.NewRecorder()
 
@@ -622,11 +965,11 @@ func TestAgreementHandler_UpdateContract_MissingURL(t *testing.T) {
 
 func TestAgreementHandler_UpdateContract_NotLender(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"contract_url": "https://example.com/contract.pdf", "contract_hash": "abc123"}`
 	req := httptest.NewRequest(http.MethodPut, "/api/agreements/1/contract", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "2")
+	req = asUser(req, 2)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
@@ -659,11 +1002,11 @@ func TestAgreementHandler_UpdateContract_NotLender(t *testing.T) {
 
 func TestAgreementHandler_UpdateContract_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewAgreementHandler(db)
+	h := NewAgreementHandler(db, &config.Config{})
 
 	body := `{"contract_url": "https://example.com/contract.pdf", "contract_hash": "abc123"}`
 	req := httptest.NewRequest(http.MethodPut, "/api/agreements/1/contract", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 	req.SetPathValue("id", "1")
 
 	now := time.Now()
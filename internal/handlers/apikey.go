@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+const (
+	// maxAPIKeys bounds the active API keys per user.
+	maxAPIKeys = 20
+	// apiKeyPrefixLen is how much of a key is kept in clear to identify it.
+	apiKeyPrefixLen = len(utils.APIKeyPrefix) + 6
+)
+
+type APIKeyHandler struct {
+	DB *sqlx.DB
+}
+
+func NewAPIKeyHandler(db *sqlx.DB) *APIKeyHandler {
+	return &APIKeyHandler{DB: db}
+}
+
+// Create issues a new API key. The key itself is returned only in this
+// response; afterwards only its prefix is shown.
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		utils.WriteJSONError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(input.Name) > 100 {
+		utils.WriteJSONError(w, "name must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	if len(input.Scopes) == 0 {
+		utils.WriteJSONError(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !slices.Contains(principal.APIKeyScopes, scope) {
+			utils.WriteJSONError(w, fmt.Sprintf("unknown scope %q, expected one of %s", scope, strings.Join(principal.APIKeyScopes, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+	slices.Sort(input.Scopes)
+	input.Scopes = slices.Compact(input.Scopes)
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		utils.WriteJSONError(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to generate key", http.StatusInternalServerError)
+		return
+	}
+	key := utils.APIKeyPrefix + token
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create key", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// lock the user so concurrent requests cannot exceed the limit
+	if _, err := tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", caller.UserID); err != nil {
+		utils.WriteJSONError(w, "failed to create key", http.StatusInternalServerError)
+		return
+	}
+
+	var active int
+	err = tx.Get(&active, `
+		SELECT COUNT(*) FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, caller.UserID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create key", http.StatusInternalServerError)
+		return
+	}
+	if active >= maxAPIKeys {
+		utils.WriteJSONError(w, fmt.Sprintf("at most %d active API keys are allowed", maxAPIKeys), http.StatusConflict)
+		return
+	}
+
+	apiKey := models.APIKey{
+		UserID:    caller.UserID,
+		Name:      input.Name,
+		Prefix:    key[:apiKeyPrefixLen],
+		Scopes:    pq.StringArray(input.Scopes),
+		ExpiresAt: input.ExpiresAt,
+	}
+	err = tx.QueryRowx(`
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, apiKey.UserID, apiKey.Name, apiKey.Prefix, utils.HashToken(key), apiKey.Scopes, apiKey.ExpiresAt).
+		Scan(&apiKey.ID, &apiKey.CreatedAt)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create key", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to create key", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, struct {
+		models.APIKey
+		Key string `json:"key"`
+	}{apiKey, key}, http.StatusCreated)
+}
+
+// List returns the user's API keys that have not been revoked, newest first.
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	keys := make([]models.APIKey, 0)
+	err := h.DB.Select(&keys, `
+		SELECT id, user_id, name, prefix, scopes, created_at, expires_at, last_used_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, caller.UserID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, keys, http.StatusOK)
+}
+
+// Revoke disables an API key of the current user immediately.
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.DB.Exec(`
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, r.PathValue("id"), caller.UserID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.WriteJSONError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// Create
+func TestAPIKeyHandler_Create_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAPIKeyHandler(db)
+
+	body := `{"name":"export script","scopes":["read","agreements:write","read"]}`
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/users/me/api-keys", strings.NewReader(body)), 1)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM api_keys`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`INSERT INTO api_keys`).
+		WithArgs(int64(1), "export script", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, time.Now()))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.Create(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	var resp struct {
+		models.APIKey
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, int64(7), resp.ID)
+	require.True(t, strings.HasPrefix(resp.Key, utils.APIKeyPrefix))
+	require.True(t, strings.HasPrefix(resp.Key, resp.Prefix))
+	require.Equal(t, []string{"agreements:write", "read"}, []string(resp.Scopes))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyHandler_Create_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"invalid json", `{`, "invalid json"},
+		{"missing name", `{"scopes":["read"]}`, "name is required"},
+		{"no scopes", `{"name":"ci"}`, "at least one scope is required"},
+		{"unknown scope", `{"name":"ci","scopes":["admin"]}`, `unknown scope \"admin\"`},
+		{"past expiry", `{"name":"ci","scopes":["read"],"expires_at":"2020-01-01T00:00:00Z"}`, "expires_at must be in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			h := NewAPIKeyHandler(db)
+
+			req := asUser(httptest.NewRequest(http.MethodPost, "/api/users/me/api-keys", strings.NewReader(tt.body)), 1)
+			rec := httptest.NewRecorder()
+			h.Create(rec, req)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			require.Contains(t, rec.Body.String(), tt.wantErr)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAPIKeyHandler_Create_TooMany(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAPIKeyHandler(db)
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/users/me/api-keys", strings.NewReader(`{"name":"ci","scopes":["read"]}`)), 1)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT id FROM users WHERE id = \$1 FOR UPDATE`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM api_keys`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(maxAPIKeys))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.Create(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// List
+func TestAPIKeyHandler_List(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAPIKeyHandler(db)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/users/me/api-keys", nil), 1)
+
+	now := time.Now()
+	mock.ExpectQuery(`SELECT .* FROM api_keys WHERE user_id = \$1 AND revoked_at IS NULL`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "created_at", "expires_at", "last_used_at"}).
+			AddRow(3, 1, "ci", "uade_abcdef", "{read}", now, nil, now))
+
+	rec := httptest.NewRecorder()
+	h.List(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotContains(t, rec.Body.String(), "key_hash")
+
+	var keys []models.APIKey
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&keys))
+	require.Len(t, keys, 1)
+	require.Equal(t, []string{"read"}, []string(keys[0].Scopes))
+	require.NotNil(t, keys[0].LastUsedAt)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Revoke
+func TestAPIKeyHandler_Revoke(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		affected int64
+		want     int
+	}{
+		{"revoked", 1, http.StatusNoContent},
+		{"someone else's key", 0, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			h := NewAPIKeyHandler(db)
+
+			req := asUser(httptest.NewRequest(http.MethodDelete, "/api/users/me/api-keys/3", nil), 1)
+			req.SetPathValue("id", "3")
+
+			mock.ExpectExec(`UPDATE api_keys SET revoked_at = NOW\(\)`).
+				WithArgs("3", int64(1)).
+				WillReturnResult(sqlmock.NewResult(0, tc.affected))
+
+			rec := httptest.NewRecorder()
+			h.Revoke(rec, req)
+
+			require.Equal(t, tc.want, rec.Code)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -1,24 +1,37 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"net/mail"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
 	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/mailer"
 	"github.com/railanbaigazy/uade-api/internal/utils"
 )
 
 type AuthHandler struct {
-	DB  *sqlx.DB
-	Cfg *config.Config
+	DB     *sqlx.DB
+	Cfg    *config.Config
+	Mailer mailer.Mailer
+
+	// background tracks work left running after a response was written.
+	background sync.WaitGroup
 }
 
-func NewAuthHandler(db *sqlx.DB, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{DB: db, Cfg: cfg}
+func NewAuthHandler(db *sqlx.DB, cfg *config.Config, m mailer.Mailer) *AuthHandler {
+	return &AuthHandler{DB: db, Cfg: cfg, Mailer: m}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -63,9 +76,11 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.DB.Exec(`
+	var userID int
+	err = h.DB.Get(&userID, `
 		INSERT INTO users (name, email, password_hash)
 		VALUES ($1, $2, $3)
+		RETURNING id
 	`, input.Name, input.Email, hashedPassword)
 	if err != nil {
 		// handle unique constraint violation for email
@@ -79,13 +94,184 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the account exists either way; a failed email can be resent later
+	if err := sendVerificationEmail(r, h.DB, h.Cfg, h.Mailer, userID, input.Email, false); err != nil {
+		log.Printf("failed to send verification email: %v", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 }
 
+// VerifyEmail confirms the user's email address with a token from the
+// verification email.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.Token == "" {
+		utils.WriteJSONError(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var token struct {
+		UserID int     `db:"user_id"`
+		Email  *string `db:"email"`
+	}
+	err = tx.Get(&token, `
+		UPDATE email_verification_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email
+	`, utils.HashToken(input.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		utils.WriteJSONError(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if token.Email == nil {
+		_, err = tx.Exec(
+			"UPDATE users SET email_verified_at = NOW() WHERE id=$1 AND email_verified_at IS NULL",
+			token.UserID,
+		)
+		if err != nil {
+			utils.WriteJSONError(w, "failed to verify email", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// links for an address the user has since replaced or cancelled
+		// no longer match pending_email
+		res, err := tx.Exec(`
+			UPDATE users SET email = pending_email, pending_email = NULL, email_verified_at = NOW()
+			WHERE id = $1 AND pending_email = $2
+		`, token.UserID, *token.Email)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				utils.WriteJSONError(w, "email already exists", http.StatusConflict)
+				return
+			}
+			utils.WriteJSONError(w, "failed to verify email", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			utils.WriteJSONError(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification sends a fresh verification email to the authenticated
+// user, at most once per EmailVerificationCooldown.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	var user struct {
+		Email      string     `db:"email"`
+		VerifiedAt *time.Time `db:"email_verified_at"`
+		LastSentAt *time.Time `db:"last_sent_at"`
+	}
+	err := h.DB.Get(&user, `
+		SELECT u.email, u.email_verified_at,
+		       (SELECT MAX(created_at) FROM email_verification_tokens WHERE user_id = u.id) AS last_sent_at
+		FROM users u
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if user.VerifiedAt != nil {
+		utils.WriteJSONError(w, "email already verified", http.StatusConflict)
+		return
+	}
+
+	if user.LastSentAt != nil {
+		if wait := time.Until(user.LastSentAt.Add(h.Cfg.EmailVerificationCooldown)); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			utils.WriteJSONError(w, "verification email was sent recently, try again later", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if err := sendVerificationEmail(r, h.DB, h.Cfg, h.Mailer, int(userID), user.Email, false); err != nil {
+		utils.WriteJSONError(w, "failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendVerificationEmail emails a link confirming email. With change set,
+// email is the user's pending new address and the link makes it the
+// current one.
+func sendVerificationEmail(r *http.Request, db sqlx.Execer, cfg *config.Config, m mailer.Mailer, userID int, email string, change bool) error {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	var newEmail *string
+	if change {
+		newEmail = &email
+	}
+	_, err = db.Exec(`
+		INSERT INTO email_verification_tokens (user_id, token_hash, expires_at, email)
+		VALUES ($1, $2, $3, $4)
+	`, userID, utils.HashToken(token), time.Now().Add(cfg.EmailVerificationTTL), newEmail)
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(cfg.AppURL, "/") + "/verify-email?token=" + token
+	if change {
+		return m.Send(r.Context(), mailer.Message{
+			To:      email,
+			Subject: "Confirm your new Uade email",
+			Text: "Open this link to use this address for your Uade account:\n" + link + "\n\n" +
+				"Until you do, your previous address stays in use. " +
+				"If you did not ask for this change, you can ignore this email.\n",
+		})
+	}
+	return m.Send(r.Context(), mailer.Message{
+		To:      email,
+		Subject: "Confirm your Uade email",
+		Text: "Welcome to Uade!\n\n" +
+			"Open this link to confirm your email address:\n" + link + "\n\n" +
+			"Until you do, you can browse posts but cannot publish posts or request agreements.\n",
+	})
+}
+
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Device   string `json:"device"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -108,24 +294,548 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var storedHash string
-	var userID int
-	err := h.DB.QueryRow("SELECT id, password_hash FROM users WHERE email=$1", input.Email).Scan(&userID, &storedHash)
+	throttleKey, ip := strings.ToLower(input.Email), utils.ClientIP(r)
+
+	// the account's throttle row stays locked until this attempt is counted
+	tx, err := h.DB.Beginx()
 	if err != nil {
-		utils.WriteJSONError(w, "invalid credentials", http.StatusUnauthorized)
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
 		return
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	if !utils.CheckPassword(storedHash, input.Password) {
+	if !h.checkLoginThrottle(w, tx, throttleKey, ip) {
+		return
+	}
+
+	var user models.User
+	err = h.DB.Get(&user, "SELECT id, password_hash, state, suspended_until, totp_enabled_at FROM users WHERE email=$1 AND deleted_at IS NULL", input.Email)
+	if err != nil && err != sql.ErrNoRows {
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	if err == sql.ErrNoRows || !utils.CheckPassword(user.PasswordHash, input.Password) {
+		accountLocked := h.countLoginFailures(tx, throttleKey, ip)
+		if err := tx.Commit(); err != nil {
+			log.Printf("failed to record login failure: %v", err)
+		} else if accountLocked {
+			h.notifyLockout(r.Context(), throttleKey)
+		}
 		utils.WriteJSONError(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	// nothing was counted, rolling back releases the throttle row
+	_ = tx.Rollback()
+
+	// state is only revealed to someone who knows the password
+	if code := user.AccessDenial(time.Now()); code != "" {
+		utils.WriteAccessDenied(w, code, user.SuspendedUntil)
+		return
+	}
+
+	// with two-factor authentication the account throttle is only cleared
+	// once the second step succeeds
+	if user.TOTPEnabledAt != nil {
+		h.startLoginChallenge(w, user.ID, input.Device)
+		return
+	}
+
+	if err := clearAccountThrottle(h.DB, user.ID); err != nil {
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.startSession(r, int(user.ID), input.Device)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, tokens, http.StatusOK)
+}
 
-	token, err := utils.GenerateJWT(userID, h.Cfg.JWTSecret)
+// maxLoginChallengeAttempts bounds how many codes can be guessed per
+// password login.
+const maxLoginChallengeAttempts = 5
+
+// startLoginChallenge answers a correct password of a user with two-factor
+// authentication enabled. Instead of tokens the client receives a
+// short-lived challenge token to complete the login with LoginTwoFactor.
+func (h *AuthHandler) startLoginChallenge(w http.ResponseWriter, userID int64, device string) {
+	token, err := utils.GenerateToken()
 	if err != nil {
 		utils.WriteJSONError(w, "failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	utils.WriteJSON(w, map[string]string{"token": token}, http.StatusOK)
+	_, err = h.DB.Exec(`
+		INSERT INTO login_challenges (user_id, token_hash, device, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, utils.HashToken(token), strings.TrimSpace(device), time.Now().Add(h.Cfg.LoginChallengeTTL))
+	if err != nil {
+		utils.WriteJSONError(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, map[string]any{
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_in":          int(h.Cfg.LoginChallengeTTL.Seconds()),
+	}, http.StatusOK)
+}
+
+// LoginTwoFactor completes a login started by Login with a TOTP code or a
+// recovery code and issues the session tokens.
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	input.Code = strings.TrimSpace(input.Code)
+	if input.ChallengeToken == "" || input.Code == "" {
+		utils.WriteJSONError(w, "challenge_token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var challenge struct {
+		ID        int64      `db:"id"`
+		UserID    int64      `db:"user_id"`
+		Email     string     `db:"email"`
+		Device    string     `db:"device"`
+		Attempts  int        `db:"attempts"`
+		ExpiresAt time.Time  `db:"expires_at"`
+		UsedAt    *time.Time `db:"used_at"`
+	}
+	err = tx.Get(&challenge, `
+		SELECT lc.id, lc.user_id, lower(u.email) AS email, lc.device, lc.attempts, lc.expires_at, lc.used_at
+		FROM login_challenges lc
+		JOIN users u ON u.id = lc.user_id
+		WHERE lc.token_hash = $1
+		FOR UPDATE OF lc
+	`, utils.HashToken(input.ChallengeToken))
+	if err != nil && err != sql.ErrNoRows {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if err == sql.ErrNoRows || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) ||
+		challenge.Attempts >= maxLoginChallengeAttempts {
+		utils.WriteJSONError(w, "invalid or expired challenge, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := verifySecondFactor(tx, challenge.UserID, input.Code)
+	if err != nil && !errors.Is(err, errTwoFactorNotEnabled) {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		// release the row locks first, the failed attempt is counted outside
+		// the discarded transaction
+		_ = tx.Rollback()
+		if _, err := h.DB.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1", challenge.ID); err != nil {
+			utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+			return
+		}
+		h.recordLoginFailure(r.Context(), challenge.Email, utils.ClientIP(r))
+		utils.WriteJSONError(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE login_challenges SET used_at = NOW() WHERE id = $1", challenge.ID); err != nil {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if err := clearAccountThrottle(tx, challenge.UserID); err != nil {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	// logging in again lifts the lock on codes for agreements
+	if _, err := tx.Exec("UPDATE users SET totp_failed_attempts = 0 WHERE id = $1", challenge.UserID); err != nil {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.startSession(r, int(challenge.UserID), challenge.Device)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, tokens, http.StatusOK)
+}
+
+// Refresh exchanges a refresh token for a new access/refresh token pair.
+// Every refresh token is single-use: presenting one that was already rotated
+// means it leaked, so the whole session it belongs to is revoked.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.RefreshToken == "" {
+		utils.WriteJSONError(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	var stored struct {
+		ID             int        `db:"id"`
+		UserID         int        `db:"user_id"`
+		SessionID      int64      `db:"session_id"`
+		ExpiresAt      time.Time  `db:"expires_at"`
+		UsedAt         *time.Time `db:"used_at"`
+		RevokedAt      *time.Time `db:"revoked_at"`
+		State          string     `db:"state"`
+		SuspendedUntil *time.Time `db:"suspended_until"`
+	}
+	err := h.DB.Get(&stored, `
+		SELECT rt.id, rt.user_id, rt.session_id, rt.expires_at, rt.used_at, s.revoked_at,
+		       u.state, u.suspended_until
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		JOIN users u ON u.id = rt.user_id
+		WHERE rt.token_hash = $1 AND u.deleted_at IS NULL
+	`, utils.HashToken(input.RefreshToken))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	if stored.RevokedAt != nil {
+		utils.WriteJSONError(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if stored.UsedAt != nil {
+		h.revokeSession(stored.SessionID)
+		utils.WriteJSONError(w, "refresh token reuse detected", http.StatusUnauthorized)
+		return
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		utils.WriteJSONError(w, "refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	user := models.User{State: stored.State, SuspendedUntil: stored.SuspendedUntil}
+	if code := user.AccessDenial(time.Now()); code != "" {
+		utils.WriteAccessDenied(w, code, user.SuspendedUntil)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the conditional update makes rotation atomic: of two concurrent
+	// requests with the same token only one can mark it used
+	res, err := tx.Exec(
+		"UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1 AND used_at IS NULL",
+		stored.ID,
+	)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		_ = tx.Rollback()
+		h.revokeSession(stored.SessionID)
+		utils.WriteJSONError(w, "refresh token reuse detected", http.StatusUnauthorized)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sessions SET last_used_at = NOW(), ip = $1, user_agent = $2
+		WHERE id = $3
+	`, utils.ClientIP(r), r.UserAgent(), stored.SessionID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.issueTokens(tx, stored.UserID, stored.SessionID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, tokens, http.StatusOK)
+}
+
+// Logout revokes the session the given refresh token belongs to.
+// It always succeeds for unknown tokens so it cannot be used as an oracle.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.RefreshToken == "" {
+		utils.WriteJSONError(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.DB.Exec(`
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = (SELECT session_id FROM refresh_tokens WHERE token_hash = $1)
+		  AND revoked_at IS NULL
+	`, utils.HashToken(input.RefreshToken))
+	if err != nil {
+		utils.WriteJSONError(w, "failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// passwordResetTimeout bounds preparing and sending a reset link after
+// ForgotPassword has answered.
+const passwordResetTimeout = time.Minute
+
+// ForgotPassword emails a single-use reset link to the given address. The
+// response is the same whether or not the address is registered, and it is
+// written before the address is even looked up, so its timing does not
+// tell either.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	input.Email = strings.TrimSpace(input.Email)
+	if _, err := mail.ParseAddress(input.Email); err != nil {
+		utils.WriteJSONError(w, "email is invalid", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), passwordResetTimeout)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		defer cancel()
+		if err := h.sendPasswordReset(ctx, input.Email); err != nil {
+			log.Printf("failed to send password reset: %v", err)
+		}
+	}()
+
+	utils.WriteJSON(w, map[string]string{
+		"message": "if the email is registered, a reset link has been sent",
+	}, http.StatusAccepted)
+}
+
+func (h *AuthHandler) sendPasswordReset(ctx context.Context, email string) error {
+	var userID int
+	err := h.DB.GetContext(ctx, &userID, "SELECT id FROM users WHERE email=$1 AND deleted_at IS NULL", email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// only the most recently requested link stays valid
+	if _, err := tx.Exec("DELETE FROM password_reset_tokens WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, utils.HashToken(token), time.Now().Add(h.Cfg.PasswordResetTTL))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(h.Cfg.AppURL, "/") + "/reset-password?token=" + token
+	return h.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your Uade password",
+		Text: "Someone requested a password reset for your Uade account.\n\n" +
+			"Open this link to choose a new password:\n" + link + "\n\n" +
+			"The link expires in " + h.Cfg.PasswordResetTTL.String() + ". " +
+			"If you did not request a reset, you can ignore this email.\n",
+	})
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and
+// ends every existing session of the user.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.Token == "" {
+		utils.WriteJSONError(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	if len(input.Password) < 6 {
+		utils.WriteJSONError(w, "password must be at least 6 characters", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var userID int
+	err = tx.Get(&userID, `
+		UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, utils.HashToken(input.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		utils.WriteJSONError(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password_hash=$1 WHERE id=$2", hashedPassword, userID); err != nil {
+		utils.WriteJSONError(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE sessions SET revoked_at = NOW() WHERE user_id=$1 AND revoked_at IS NULL", userID); err != nil {
+		utils.WriteJSONError(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	if err := clearAccountThrottle(tx, int64(userID)); err != nil {
+		utils.WriteJSONError(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startSession records a new login session for the request's client and
+// issues its first token pair.
+func (h *AuthHandler) startSession(r *http.Request, userID int, device string) (map[string]string, error) {
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var sessionID int64
+	err = tx.Get(&sessionID, `
+		INSERT INTO sessions (user_id, device, ip, user_agent)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, userID, strings.TrimSpace(device), utils.ClientIP(r), r.UserAgent())
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := h.issueTokens(tx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, tx.Commit()
+}
+
+// issueTokens signs a new access token and stores a new refresh token for
+// the given session. Only the hash of the refresh token is persisted.
+func (h *AuthHandler) issueTokens(db sqlx.Execer, userID int, sessionID int64) (map[string]string, error) {
+	accessToken, err := utils.GenerateJWT(userID, sessionID, h.Cfg.JWTKeys, h.Cfg.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO refresh_tokens (user_id, token_hash, session_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, utils.HashToken(refreshToken), sessionID, time.Now().Add(h.Cfg.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+	}, nil
+}
+
+func (h *AuthHandler) revokeSession(sessionID int64) {
+	_, err := h.DB.Exec(
+		"UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL",
+		sessionID,
+	)
+	if err != nil {
+		log.Printf("failed to revoke session %d: %v", sessionID, err)
+	}
 }
@@ -2,16 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jmoiron/sqlx"
 	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/mailer"
+	"github.com/railanbaigazy/uade-api/internal/totp"
 	"github.com/railanbaigazy/uade-api/internal/utils"
 	"github.com/stretchr/testify/require"
 )
@@ -25,11 +31,13 @@ func TestRegisterAndLogin_SQLMock(t *testing.T) {
 	db := sqlx.NewDb(sqlDB, "postgres")
 	defer db.Close()
 
-	cfg := &config.Config{JWTSecret: "test-secret"}
-	h := NewAuthHandler(db, cfg)
+	cfg := &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret"), AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: 24 * time.Hour, AppURL: "https://uade.kz"}
+	m := mailer.NewMemoryMailer()
+	h := NewAuthHandler(db, cfg, m)
 
 	// Expect Exec for INSERT during Register. We don't know the hashed password value
-	mock.ExpectExec("INSERT INTO users").WithArgs("TestUser", "user@example.com", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("INSERT INTO users").WithArgs("TestUser", "user@example.com", sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO email_verification_tokens").WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// Register
 	registerBody := `{"name":"TestUser","email":"user@example.com","password":"12345678"}`
@@ -40,14 +48,27 @@ func TestRegisterAndLogin_SQLMock(t *testing.T) {
 	h.Register(rec, req)
 	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
 
+	// a verification link is emailed on registration
+	sent := m.Sent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "user@example.com", sent[0].To)
+	require.Contains(t, sent[0].Text, "https://uade.kz/verify-email?token=")
+
 	// Prepare hashed password to be returned by SELECT during Login
 	password := "12345678"
 	hashed, err := utils.HashPassword(password)
 	require.NoError(t, err)
 
 	// Expect Query for SELECT during Login
-	rows := sqlmock.NewRows([]string{"id", "password_hash"}).AddRow(1, hashed)
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, password_hash FROM users WHERE email=$1")).WithArgs("user@example.com").WillReturnRows(rows)
+	expectLoginThrottle(mock, "user@example.com")
+	rows := sqlmock.NewRows([]string{"id", "password_hash", "state", "suspended_until"}).AddRow(1, hashed, "active", nil)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, password_hash, state, suspended_until, totp_enabled_at FROM users WHERE email=$1")).WithArgs("user@example.com").WillReturnRows(rows)
+	mock.ExpectRollback()
+	mock.ExpectExec("DELETE FROM login_throttle").WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO sessions").WithArgs(1, "", sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec("INSERT INTO refresh_tokens").WithArgs(1, sqlmock.AnyArg(), int64(3), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	// Login
 	loginBody := `{"email":"user@example.com","password":"12345678"}`
@@ -65,16 +86,18 @@ func TestRegisterAndLogin_SQLMock(t *testing.T) {
 	tokenStr, ok := resp["token"]
 	require.True(t, ok)
 	require.NotEmpty(t, tokenStr)
+	require.NotEmpty(t, resp["refresh_token"])
 
 	// Parse token and verify claim
 	parsed, err := jwt.ParseWithClaims(tokenStr, jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(cfg.JWTSecret), nil
+		return []byte("test-secret"), nil
 	})
 	require.NoError(t, err)
 	require.True(t, parsed.Valid)
 	claims, ok := parsed.Claims.(jwt.MapClaims)
 	require.True(t, ok)
 	require.Equal(t, float64(1), claims["user_id"])
+	require.Equal(t, float64(3), claims["sid"])
 
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
@@ -88,8 +111,8 @@ func TestRegisterValidation(t *testing.T) {
 	db := sqlx.NewDb(sqlDB, "postgres")
 	defer db.Close()
 
-	cfg := &config.Config{JWTSecret: "test-secret"}
-	h := NewAuthHandler(db, cfg)
+	cfg := &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret")}
+	h := NewAuthHandler(db, cfg, mailer.NewMemoryMailer())
 
 	// Missing name
 	body := `{"name":"","email":"user@example.com","password":"123456"}`
@@ -131,8 +154,8 @@ func TestLoginValidation(t *testing.T) {
 	db := sqlx.NewDb(sqlDB, "postgres")
 	defer db.Close()
 
-	cfg := &config.Config{JWTSecret: "test-secret"}
-	h := NewAuthHandler(db, cfg)
+	cfg := &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret")}
+	h := NewAuthHandler(db, cfg, mailer.NewMemoryMailer())
 
 	// Missing email
 	body := `{"email":"","password":"123456"}`
@@ -165,3 +188,609 @@ func TestLoginValidation(t *testing.T) {
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
 }
+
+// newAuthTestHandler returns an AuthHandler on a mock database that records
+// the emails it sends. Its config has the signing key, token lifetimes and
+// app URL set; configure, if not nil, adjusts it further.
+func newAuthTestHandler(t *testing.T, configure func(*config.Config)) (*AuthHandler, sqlmock.Sqlmock, *mailer.MemoryMailer) {
+	db, mock := utils.NewSQLXMock(t)
+	m := mailer.NewMemoryMailer()
+	cfg := &config.Config{
+		JWTKeys:                   jwtkeys.NewHMAC("test-secret"),
+		AppURL:                    "https://uade.kz",
+		AccessTokenTTL:            15 * time.Minute,
+		RefreshTokenTTL:           24 * time.Hour,
+		PasswordResetTTL:          time.Hour,
+		EmailVerificationTTL:      24 * time.Hour,
+		EmailVerificationCooldown: time.Minute,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	return NewAuthHandler(db, cfg, m), mock, m
+}
+
+var refreshTokenColumns = []string{"id", "user_id", "session_id", "expires_at", "used_at", "revoked_at", "state", "suspended_until"}
+
+func TestRefresh_MissingToken(t *testing.T) {
+	h, _, _ := newAuthTestHandler(t, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "refresh_token is required")
+}
+
+func TestRefresh_UnknownToken(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT rt.id, rt.user_id, rt.session_id`).
+		WithArgs(utils.HashToken("nope")).
+		WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"nope"}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid refresh token")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_Expired(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT rt.id, rt.user_id, rt.session_id`).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, 9, time.Now().Add(-time.Minute), nil, nil, "active", nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"old"}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "refresh token expired")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_ReuseRevokesSession(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT rt.id, rt.user_id, rt.session_id`).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, 9, time.Now().Add(time.Hour), time.Now().Add(-time.Minute), nil, "active", nil))
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"stolen"}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "refresh token reuse detected")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_ConcurrentRotationRevokesSession(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT rt.id, rt.user_id, rt.session_id`).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, 9, time.Now().Add(time.Hour), nil, nil, "active", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refresh_tokens SET used_at = NOW\(\)`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"raced"}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "refresh token reuse detected")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_Success(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT rt.id, rt.user_id, rt.session_id`).
+		WithArgs(utils.HashToken("valid")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, 9, time.Now().Add(time.Hour), nil, nil, "active", nil))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refresh_tokens SET used_at = NOW\(\)`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE sessions SET last_used_at = NOW\(\)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), int64(9)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO refresh_tokens`).
+		WithArgs(5, sqlmock.AnyArg(), int64(9), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"valid"}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp map[string]string
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.NotEmpty(t, resp["token"])
+	require.NotEmpty(t, resp["refresh_token"])
+	require.NotEqual(t, "valid", resp["refresh_token"])
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogout(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE id = \(SELECT session_id FROM refresh_tokens`).
+		WithArgs(utils.HashToken("valid")).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", strings.NewReader(`{"refresh_token":"valid"}`))
+	rec := httptest.NewRecorder()
+	h.Logout(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_RevokedSession(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT rt.id, rt.user_id, rt.session_id`).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, 9, time.Now().Add(time.Hour), nil, time.Now().Add(-time.Minute), "active", nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"revoked"}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid refresh token")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForgotPassword_UnknownEmail(t *testing.T) {
+	h, mock, m := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE email=\$1`).
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/password/forgot", strings.NewReader(`{"email":"nobody@example.com"}`))
+	rec := httptest.NewRecorder()
+	h.ForgotPassword(rec, req)
+	h.background.Wait()
+
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Contains(t, rec.Body.String(), "if the email is registered")
+	require.Empty(t, m.Sent())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestForgotPassword_KnownEmail(t *testing.T) {
+	h, mock, m := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT id FROM users WHERE email=\$1`).
+		WithArgs("user@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM password_reset_tokens WHERE user_id=\$1`).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO password_reset_tokens`).
+		WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/password/forgot", strings.NewReader(`{"email":"user@example.com"}`))
+	rec := httptest.NewRecorder()
+	h.ForgotPassword(rec, req)
+	h.background.Wait()
+
+	// identical response to the unknown email case
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Contains(t, rec.Body.String(), "if the email is registered")
+
+	sent := m.Sent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "user@example.com", sent[0].To)
+	require.Contains(t, sent[0].Text, "https://uade.kz/reset-password?token=")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPassword_ShortPassword(t *testing.T) {
+	h, _, _ := newAuthTestHandler(t, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/password/reset", strings.NewReader(`{"token":"abc","password":"123"}`))
+	rec := httptest.NewRecorder()
+	h.ResetPassword(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "password must be at least 6 characters")
+}
+
+func TestResetPassword_InvalidToken(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE password_reset_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("used")).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/password/reset", strings.NewReader(`{"token":"used","password":"newpass"}`))
+	rec := httptest.NewRecorder()
+	h.ResetPassword(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid or expired token")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPassword_Success(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE password_reset_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("valid")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectExec(`UPDATE users SET password_hash=\$1 WHERE id=\$2`).
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE user_id=\$1`).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM login_throttle`).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/password/reset", strings.NewReader(`{"token":"valid","password":"newpass"}`))
+	rec := httptest.NewRecorder()
+	h.ResetPassword(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmail_InvalidToken(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE email_verification_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("expired")).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-email", strings.NewReader(`{"token":"expired"}`))
+	rec := httptest.NewRecorder()
+	h.VerifyEmail(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid or expired token")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmail_Success(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE email_verification_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("valid")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(4, nil))
+	mock.ExpectExec(`UPDATE users SET email_verified_at = NOW\(\) WHERE id=\$1`).
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-email", strings.NewReader(`{"token":"valid"}`))
+	rec := httptest.NewRecorder()
+	h.VerifyEmail(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmail_ChangesEmail(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE email_verification_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("valid")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(4, "new@example.com"))
+	mock.ExpectExec(`UPDATE users SET email = pending_email, pending_email = NULL`).
+		WithArgs(4, "new@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-email", strings.NewReader(`{"token":"valid"}`))
+	rec := httptest.NewRecorder()
+	h.VerifyEmail(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmail_SupersededChange(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE email_verification_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("old")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(4, "first@example.com"))
+	mock.ExpectExec(`UPDATE users SET email = pending_email`).
+		WithArgs(4, "first@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-email", strings.NewReader(`{"token":"old"}`))
+	rec := httptest.NewRecorder()
+	h.VerifyEmail(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+var resendColumns = []string{"email", "email_verified_at", "last_sent_at"}
+
+func TestResendVerification_AlreadyVerified(t *testing.T) {
+	h, mock, m := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT u.email, u.email_verified_at`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(resendColumns).AddRow("user@example.com", time.Now(), nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-email/resend", nil)
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.ResendVerification(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Empty(t, m.Sent())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResendVerification_Cooldown(t *testing.T) {
+	h, mock, m := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT u.email, u.email_verified_at`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(resendColumns).AddRow("user@example.com", nil, time.Now().Add(-10*time.Second)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-email/resend", nil)
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.ResendVerification(rec, req)
+
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+	require.Empty(t, m.Sent())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResendVerification_Success(t *testing.T) {
+	h, mock, m := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT u.email, u.email_verified_at`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows(resendColumns).AddRow("user@example.com", nil, time.Now().Add(-2*time.Minute)))
+	mock.ExpectExec(`INSERT INTO email_verification_tokens`).
+		WithArgs(4, sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/verify-email/resend", nil)
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.ResendVerification(rec, req)
+
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	require.Len(t, m.Sent(), 1)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_BlockedUser(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAuthHandler(db, &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret")}, mailer.NewMemoryMailer())
+
+	hashed, err := utils.HashPassword("12345678")
+	require.NoError(t, err)
+
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectQuery(`SELECT id, password_hash, state, suspended_until, totp_enabled_at FROM users`).
+		WithArgs("user@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash", "state", "suspended_until"}).AddRow(1, hashed, "blocked", nil))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"email":"user@example.com","password":"12345678"}`))
+	rec := httptest.NewRecorder()
+	h.Login(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"account_blocked"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_SuspendedUserWrongPassword(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAuthHandler(db, &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret"), LoginMaxAccountFailures: 10, LoginMaxIPFailures: 50}, mailer.NewMemoryMailer())
+
+	hashed, err := utils.HashPassword("12345678")
+	require.NoError(t, err)
+
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectQuery(`SELECT id, password_hash, state, suspended_until, totp_enabled_at FROM users`).
+		WithArgs("user@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash", "state", "suspended_until"}).AddRow(1, hashed, "suspended", time.Now().Add(time.Hour)))
+	expectLoginFailure(mock, "user@example.com", 1)
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"email":"user@example.com","password":"wrong-pass"}`))
+	rec := httptest.NewRecorder()
+	h.Login(rec, req)
+
+	// the suspension is not revealed without the right password
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid credentials")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_SuspendedUser(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, nil)
+
+	mock.ExpectQuery(`SELECT rt.id, rt.user_id, rt.session_id`).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow(1, 5, 9, time.Now().Add(time.Hour), nil, nil, "suspended", time.Now().Add(time.Hour)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"valid"}`))
+	rec := httptest.NewRecorder()
+	h.Refresh(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"account_suspended"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_TwoFactorChallenge(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAuthHandler(db, &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret"), LoginChallengeTTL: 5 * time.Minute}, mailer.NewMemoryMailer())
+
+	hashed, err := utils.HashPassword("12345678")
+	require.NoError(t, err)
+
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectQuery(`SELECT id, password_hash, state, suspended_until, totp_enabled_at FROM users`).
+		WithArgs("user@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash", "state", "suspended_until", "totp_enabled_at"}).
+			AddRow(1, hashed, "active", nil, time.Now()))
+	mock.ExpectRollback()
+	mock.ExpectExec(`INSERT INTO login_challenges`).
+		WithArgs(int64(1), sqlmock.AnyArg(), "phone", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login",
+		strings.NewReader(`{"email":"user@example.com","password":"12345678","device":"phone"}`))
+	rec := httptest.NewRecorder()
+	h.Login(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp map[string]any
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Equal(t, true, resp["two_factor_required"])
+	require.NotEmpty(t, resp["challenge_token"])
+	require.NotContains(t, resp, "token")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+var challengeColumns = []string{"id", "user_id", "email", "device", "attempts", "expires_at", "used_at"}
+
+func TestLoginTwoFactor_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	cfg := &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret"), AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: 24 * time.Hour}
+	h := NewAuthHandler(db, cfg, mailer.NewMemoryMailer())
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	code, err := totp.CodeAt(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM login_challenges`).
+		WithArgs(utils.HashToken("challenge")).
+		WillReturnRows(sqlmock.NewRows(challengeColumns).AddRow(3, 1, "user@example.com", "phone", 0, time.Now().Add(time.Minute), nil))
+	mock.ExpectQuery(`SELECT totp_secret, totp_last_step FROM users`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_last_step"}).AddRow(secret, 0))
+	mock.ExpectExec(`UPDATE users SET totp_last_step`).
+		WithArgs(totp.Step(time.Now()), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE login_challenges SET used_at`).
+		WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM login_throttle`).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET totp_failed_attempts = 0`).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO sessions`).
+		WithArgs(1, "phone", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectExec(`INSERT INTO refresh_tokens`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := `{"challenge_token":"challenge","code":"` + code + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login/2fa", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.LoginTwoFactor(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"refresh_token"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginTwoFactor_InvalidCode(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAuthHandler(db, &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret"), LoginMaxAccountFailures: 10, LoginMaxIPFailures: 50}, mailer.NewMemoryMailer())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM login_challenges`).
+		WillReturnRows(sqlmock.NewRows(challengeColumns).AddRow(3, 1, "user@example.com", "", 1, time.Now().Add(time.Minute), nil))
+	mock.ExpectQuery(`SELECT totp_secret, totp_last_step FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_last_step"}).AddRow("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 0))
+	mock.ExpectExec(`UPDATE recovery_codes SET used_at`).
+		WithArgs(int64(1), utils.HashToken("wrong-codex")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectExec(`UPDATE login_challenges SET attempts = attempts \+ 1`).
+		WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectLoginFailure(mock, "user@example.com", 2)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login/2fa",
+		strings.NewReader(`{"challenge_token":"challenge","code":"wrong-codex"}`))
+	rec := httptest.NewRecorder()
+	h.LoginTwoFactor(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid code")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginTwoFactor_TooManyAttempts(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewAuthHandler(db, &config.Config{JWTKeys: jwtkeys.NewHMAC("test-secret")}, mailer.NewMemoryMailer())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM login_challenges`).
+		WillReturnRows(sqlmock.NewRows(challengeColumns).AddRow(3, 1, "user@example.com", "", maxLoginChallengeAttempts, time.Now().Add(time.Minute), nil))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login/2fa",
+		strings.NewReader(`{"challenge_token":"challenge","code":"123456"}`))
+	rec := httptest.NewRecorder()
+	h.LoginTwoFactor(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Contains(t, rec.Body.String(), "log in again")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// JWKSHandler publishes the public keys that verify access tokens, so other
+// services can check tokens without sharing a secret.
+func JWKSHandler(keys *jwtkeys.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// short enough that a newly added key is picked up well before it
+		// starts signing
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		utils.WriteJSON(w, map[string]any{"keys": keys.JWKS()}, http.StatusOK)
+	}
+}
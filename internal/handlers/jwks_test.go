@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSHandler_HidesSharedSecret(t *testing.T) {
+	rec := httptest.NewRecorder()
+	JWKSHandler(jwtkeys.NewHMAC("test-secret"))(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "public, max-age=300", rec.Header().Get("Cache-Control"))
+
+	var body struct {
+		Keys []jwtkeys.JWK `json:"keys"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.NotNil(t, body.Keys)
+	require.Empty(t, body.Keys)
+}
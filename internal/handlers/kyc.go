@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/kyc"
+	"github.com/railanbaigazy/uade-api/internal/notify"
+	"github.com/railanbaigazy/uade-api/internal/storage"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+const (
+	maxKYCImageSize = 5 << 20
+	// room for every image plus the text fields
+	maxKYCUploadSize = 3*maxKYCImageSize + 1<<20
+)
+
+// kycImageKinds are the images a submission may include; front is required.
+var kycImageKinds = []string{"front", "back", "selfie"}
+
+var kycImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+}
+
+var (
+	countryPattern        = regexp.MustCompile(`^[A-Z]{2}$`)
+	documentNumberPattern = regexp.MustCompile(`^[A-Z0-9-]{4,64}$`)
+)
+
+var errIdentityTaken = errors.New("identity already verified on another account")
+
+type KYCHandler struct {
+	DB      *sqlx.DB
+	Storage storage.Storage
+	Admin   *AdminHandler
+}
+
+func NewKYCHandler(db *sqlx.DB, store storage.Storage, admin *AdminHandler) *KYCHandler {
+	return &KYCHandler{DB: db, Storage: store, Admin: admin}
+}
+
+// kycImage is an uploaded document image that passed validation.
+type kycImage struct {
+	kind        string
+	contentType string
+	data        []byte
+}
+
+// Submit takes identity data as multipart/form-data: document_type,
+// document_number, country (ISO 3166 alpha-2), iin (required for KZ) and
+// the images front, back and selfie. A user can have one submission
+// awaiting review at a time.
+func (h *KYCHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxKYCUploadSize)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteJSONError(w, "upload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		utils.WriteJSONError(w, "invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	documentType := strings.TrimSpace(r.FormValue("document_type"))
+	documentNumber := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(r.FormValue("document_number")), " ", ""))
+	country := strings.ToUpper(strings.TrimSpace(r.FormValue("country")))
+	iin := strings.TrimSpace(r.FormValue("iin"))
+
+	if !kyc.DocumentTypes[documentType] {
+		utils.WriteJSONError(w, "document_type must be one of: id_card, passport, residence_permit", http.StatusBadRequest)
+		return
+	}
+	if !documentNumberPattern.MatchString(documentNumber) {
+		utils.WriteJSONError(w, "document_number is invalid", http.StatusBadRequest)
+		return
+	}
+	if !countryPattern.MatchString(country) {
+		utils.WriteJSONError(w, "country must be a two-letter country code", http.StatusBadRequest)
+		return
+	}
+	if country == "KZ" && iin == "" {
+		utils.WriteJSONError(w, "iin is required for Kazakhstan documents", http.StatusBadRequest)
+		return
+	}
+	if iin != "" && !kyc.ValidIIN(iin) {
+		utils.WriteJSONError(w, "iin is invalid", http.StatusBadRequest)
+		return
+	}
+
+	images, ok := readKYCImages(w, r)
+	if !ok {
+		return
+	}
+
+	var verified bool
+	err := h.DB.Get(&verified, "SELECT identity_verified_at IS NOT NULL FROM users WHERE id=$1", userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to submit verification", http.StatusInternalServerError)
+		return
+	}
+	if verified {
+		utils.WriteJSONError(w, "identity already verified", http.StatusConflict)
+		return
+	}
+
+	var iinArg *string
+	if iin != "" {
+		iinArg = &iin
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to submit verification", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	submission := models.KYCSubmission{
+		UserID:         userID,
+		DocumentType:   documentType,
+		DocumentNumber: documentNumber,
+		Country:        country,
+		IIN:            iinArg,
+	}
+	err = tx.Get(&submission, `
+		INSERT INTO kyc_submissions (user_id, document_type, document_number, country, iin)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at
+	`, userID, documentType, documentNumber, country, iinArg)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			utils.WriteJSONError(w, "a verification is already awaiting review", http.StatusConflict)
+			return
+		}
+		utils.WriteJSONError(w, "failed to submit verification", http.StatusInternalServerError)
+		return
+	}
+
+	var stored []string
+	// images of a submission that did not commit are useless
+	cleanup := func() {
+		for _, key := range stored {
+			if err := h.Storage.Delete(r.Context(), key); err != nil {
+				log.Printf("failed to delete kyc image %s: %v", key, err)
+			}
+		}
+	}
+
+	for _, img := range images {
+		key := fmt.Sprintf("kyc/%d/%s", submission.ID, img.kind)
+		if err := h.Storage.Put(r.Context(), key, bytes.NewReader(img.data)); err != nil {
+			cleanup()
+			utils.WriteJSONError(w, "failed to store document", http.StatusInternalServerError)
+			return
+		}
+		stored = append(stored, key)
+
+		doc := models.KYCDocument{
+			SubmissionID: submission.ID,
+			Kind:         img.kind,
+			ContentType:  img.contentType,
+			SizeBytes:    int64(len(img.data)),
+		}
+		err := tx.Get(&doc, `
+			INSERT INTO kyc_documents (submission_id, kind, storage_key, content_type, size_bytes)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at
+		`, submission.ID, img.kind, key, img.contentType, len(img.data))
+		if err != nil {
+			cleanup()
+			utils.WriteJSONError(w, "failed to submit verification", http.StatusInternalServerError)
+			return
+		}
+		submission.Documents = append(submission.Documents, doc)
+	}
+
+	if err := tx.Commit(); err != nil {
+		cleanup()
+		utils.WriteJSONError(w, "failed to submit verification", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, submission, http.StatusCreated)
+}
+
+// readKYCImages reads and checks the uploaded images. Only JPEG and PNG
+// are accepted, judged by their content rather than the declared type.
+func readKYCImages(w http.ResponseWriter, r *http.Request) ([]kycImage, bool) {
+	var images []kycImage
+	for _, kind := range kycImageKinds {
+		file, header, err := r.FormFile(kind)
+		if errors.Is(err, http.ErrMissingFile) {
+			if kind == "front" {
+				utils.WriteJSONError(w, "front image is required", http.StatusBadRequest)
+				return nil, false
+			}
+			continue
+		}
+		if err != nil {
+			utils.WriteJSONError(w, "invalid "+kind+" image", http.StatusBadRequest)
+			return nil, false
+		}
+
+		if header.Size > maxKYCImageSize {
+			_ = file.Close()
+			utils.WriteJSONError(w, kind+" image must be at most 5 MB", http.StatusBadRequest)
+			return nil, false
+		}
+		data, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			utils.WriteJSONError(w, "invalid "+kind+" image", http.StatusBadRequest)
+			return nil, false
+		}
+
+		contentType := http.DetectContentType(data)
+		if !kycImageTypes[contentType] {
+			utils.WriteJSONError(w, kind+" image must be a JPEG or PNG", http.StatusBadRequest)
+			return nil, false
+		}
+
+		images = append(images, kycImage{kind: kind, contentType: contentType, data: data})
+	}
+	return images, true
+}
+
+// Status returns the caller's latest verification submission.
+func (h *KYCHandler) Status(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var submission models.KYCSubmission
+	err := h.DB.Get(&submission, `
+		SELECT id, user_id, document_type, document_number, country, iin, status,
+		       rejection_reason, reviewed_at, created_at
+		FROM kyc_submissions
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, caller.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "no verification submitted", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch verification", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, submission, http.StatusOK)
+}
+
+// Queue lists submissions for moderators, oldest first, by default those
+// awaiting review. Other statuses can be listed with ?status=.
+func (h *KYCHandler) Queue(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "pending"
+	}
+	if status != "pending" && status != "approved" && status != "rejected" {
+		utils.WriteJSONError(w, "status must be one of: pending, approved, rejected", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := pagination(r)
+
+	submissions := make([]models.KYCSubmission, 0)
+	err := h.DB.Select(&submissions, `
+		SELECT k.id, k.user_id, u.name AS user_name, k.document_type, k.document_number, k.country,
+		       k.iin, k.status, k.rejection_reason, k.reviewed_by, k.reviewed_at, k.created_at
+		FROM kyc_submissions k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.status = $1
+		ORDER BY k.created_at ASC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch submissions", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, submissions, http.StatusOK)
+}
+
+// Get returns a submission with the list of its document images.
+func (h *KYCHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var submission models.KYCSubmission
+	err = h.DB.Get(&submission, `
+		SELECT k.id, k.user_id, u.name AS user_name, k.document_type, k.document_number, k.country,
+		       k.iin, k.status, k.rejection_reason, k.reviewed_by, k.reviewed_at, k.created_at
+		FROM kyc_submissions k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.id = $1
+	`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "submission not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch submission", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.DB.Select(&submission.Documents, `
+		SELECT id, submission_id, kind, content_type, size_bytes, created_at
+		FROM kyc_documents
+		WHERE submission_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch submission", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, submission, http.StatusOK)
+}
+
+// Document streams one image of a submission to a moderator.
+func (h *KYCHandler) Document(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var doc models.KYCDocument
+	err = h.DB.Get(&doc, `
+		SELECT storage_key, content_type
+		FROM kyc_documents
+		WHERE submission_id = $1 AND kind = $2
+	`, id, r.PathValue("kind"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "document not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch document", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := h.Storage.Open(r.Context(), doc.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			utils.WriteJSONError(w, "document not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch document", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	w.Header().Set("Content-Type", doc.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("failed to send kyc document %s: %v", doc.StorageKey, err)
+	}
+}
+
+// Approve verifies the identity of the submission's user, raising their
+// verification level.
+func (h *KYCHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, "approve_kyc", "", func(tx *sqlx.Tx, id, userID, reviewerID int64) error {
+		err := execOne(tx, `
+			UPDATE kyc_submissions SET status = 'approved', reviewed_by = $2, reviewed_at = NOW()
+			WHERE id = $1 AND status = 'pending'
+		`, id, reviewerID)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return errIdentityTaken
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE users SET identity_verified_at = NOW() WHERE id = $1", userID); err != nil {
+			return err
+		}
+		return notify.Send(tx, notify.Event{UserID: userID, Type: notify.IdentityApproved})
+	})
+}
+
+// Reject declines a submission with a reason shown to the user, who may
+// then submit again.
+func (h *KYCHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	reason, ok := decodeReason(w, r)
+	if !ok {
+		return
+	}
+
+	h.review(w, r, "reject_kyc", reason, func(tx *sqlx.Tx, id, userID, reviewerID int64) error {
+		err := execOne(tx, `
+			UPDATE kyc_submissions
+			SET status = 'rejected', rejection_reason = $3, reviewed_by = $2, reviewed_at = NOW()
+			WHERE id = $1 AND status = 'pending'
+		`, id, reviewerID, reason)
+		if err != nil {
+			return err
+		}
+		return notify.Send(tx, notify.Event{UserID: userID, Type: notify.IdentityRejected, Data: map[string]any{"reason": reason}})
+	})
+}
+
+// review decides a pending submission and records the decision in the
+// audit log against the submitting user.
+func (h *KYCHandler) review(w http.ResponseWriter, r *http.Request, action, reason string, decide func(tx *sqlx.Tx, id, userID, reviewerID int64) error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var userID int64
+	if err := h.DB.Get(&userID, "SELECT user_id FROM kyc_submissions WHERE id = $1", id); err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "submission not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to review submission", http.StatusInternalServerError)
+		return
+	}
+	if userID == caller.UserID {
+		utils.WriteJSONError(w, "cannot review your own submission", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Admin.audited(r, userID, nil, action, reason, map[string]any{"submission_id": id}, func(tx *sqlx.Tx) error {
+		return decide(tx, id, userID, caller.UserID)
+	})
+	if errors.Is(err, errIdentityTaken) {
+		utils.WriteJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	h.Admin.writeActionResult(w, err, "submission already reviewed", "failed to review submission")
+}
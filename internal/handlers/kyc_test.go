@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/railanbaigazy/uade-api/internal/storage"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01")
+
+// kycForm builds a multipart submission with the given fields and images.
+func kycForm(t *testing.T, fields map[string]string, images map[string][]byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		require.NoError(t, mw.WriteField(k, v))
+	}
+	for kind, data := range images {
+		fw, err := mw.CreateFormFile(kind, kind+".png")
+		require.NoError(t, err)
+		_, err = fw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/kyc", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return asUser(req, 4)
+}
+
+var kazakhID = map[string]string{
+	"document_type":   "id_card",
+	"document_number": "04 1234567",
+	"country":         "kz",
+	"iin":             "900101300007",
+}
+
+func TestKYCSubmit_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	store := storage.NewMemory()
+	h := NewKYCHandler(db, store, nil)
+
+	mock.ExpectQuery(`SELECT identity_verified_at IS NOT NULL FROM users WHERE id=\$1`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"verified"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO kyc_submissions`).
+		WithArgs(int64(4), "id_card", "041234567", "KZ", "900101300007").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(7, "pending", time.Now()))
+	mock.ExpectQuery(`INSERT INTO kyc_documents`).
+		WithArgs(int64(7), "front", "kyc/7/front", "image/png", len(pngImage)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	h.Submit(rec, kycForm(t, kazakhID, map[string][]byte{"front": pngImage}))
+
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"status":"pending"`)
+	require.Contains(t, rec.Body.String(), `"kind":"front"`)
+	require.NotContains(t, rec.Body.String(), "kyc/7/front")
+	require.Equal(t, []string{"kyc/7/front"}, store.Keys())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKYCSubmit_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		images map[string][]byte
+		want   string
+	}{
+		{"bad iin", map[string]string{"document_type": "id_card", "document_number": "041234567", "country": "KZ", "iin": "900101300008"},
+			map[string][]byte{"front": pngImage}, "iin is invalid"},
+		{"missing iin", map[string]string{"document_type": "passport", "document_number": "N1234567", "country": "KZ"},
+			map[string][]byte{"front": pngImage}, "iin is required"},
+		{"unknown document", map[string]string{"document_type": "library_card", "document_number": "041234567", "country": "KZ"},
+			map[string][]byte{"front": pngImage}, "document_type"},
+		{"missing front", kazakhID, map[string][]byte{"back": pngImage}, "front image is required"},
+		{"not an image", kazakhID, map[string][]byte{"front": []byte("%PDF-1.4")}, "JPEG or PNG"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			h := NewKYCHandler(db, storage.NewMemory(), nil)
+
+			rec := httptest.NewRecorder()
+			h.Submit(rec, kycForm(t, tt.fields, tt.images))
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			require.Contains(t, rec.Body.String(), tt.want)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestKYCSubmit_AlreadyPending(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewKYCHandler(db, storage.NewMemory(), nil)
+
+	mock.ExpectQuery(`SELECT identity_verified_at IS NOT NULL FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"verified"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO kyc_submissions`).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	h.Submit(rec, kycForm(t, kazakhID, map[string][]byte{"front": pngImage}))
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKYCDocument(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	store := storage.NewMemory()
+	require.NoError(t, store.Put(context.Background(), "kyc/7/front", bytes.NewReader(pngImage)))
+	h := NewKYCHandler(db, store, nil)
+
+	mock.ExpectQuery(`FROM kyc_documents\s+WHERE submission_id = \$1 AND kind = \$2`).
+		WithArgs(int64(7), "front").
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key", "content_type"}).AddRow("kyc/7/front", "image/png"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/kyc/7/documents/front", nil)
+	req.SetPathValue("id", "7")
+	req.SetPathValue("kind", "front")
+	rec := httptest.NewRecorder()
+	h.Document(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	require.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	require.Equal(t, pngImage, rec.Body.Bytes())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func reviewKYC(h *KYCHandler, action string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/kyc/7/"+action, strings.NewReader(body))
+	req.SetPathValue("id", "7")
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	if action == "approve" {
+		h.Approve(rec, req)
+	} else {
+		h.Reject(rec, req)
+	}
+	return rec
+}
+
+func TestKYCApprove(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewKYCHandler(db, nil, NewAdminHandler(db, nil))
+
+	mock.ExpectQuery(`SELECT user_id FROM kyc_submissions WHERE id = \$1`).
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE kyc_submissions SET status = 'approved'`).
+		WithArgs(int64(7), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET identity_verified_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(int64(4), "identity_approved", nil, []byte(`{}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(1), "approve_kyc", int64(4), nil, "", []byte(`{"submission_id":7}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := reviewKYC(h, "approve", "")
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKYCApprove_IdentityTaken(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewKYCHandler(db, nil, NewAdminHandler(db, nil))
+
+	mock.ExpectQuery(`SELECT user_id FROM kyc_submissions`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE kyc_submissions SET status = 'approved'`).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	rec := reviewKYC(h, "approve", "")
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "another account")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKYCReject(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewKYCHandler(db, nil, NewAdminHandler(db, nil))
+
+	mock.ExpectQuery(`SELECT user_id FROM kyc_submissions`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE kyc_submissions\s+SET status = 'rejected'`).
+		WithArgs(int64(7), int64(1), "photo is blurry").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(int64(4), "identity_rejected", nil, []byte(`{"reason":"photo is blurry"}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO admin_audit_log`).
+		WithArgs(int64(1), "reject_kyc", int64(4), nil, "photo is blurry", []byte(`{"submission_id":7}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := reviewKYC(h, "reject", `{"reason":"photo is blurry"}`)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKYCReview_OwnSubmission(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewKYCHandler(db, nil, NewAdminHandler(db, nil))
+
+	mock.ExpectQuery(`SELECT user_id FROM kyc_submissions`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+
+	rec := reviewKYC(h, "approve", "")
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/trust"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// limitError is an agreement that would take a user over one of their
+// limits. It is reported to the client as 403 with code.
+type limitError struct {
+	code string
+	msg  string
+}
+
+func (e *limitError) write(w http.ResponseWriter) {
+	utils.WriteJSONErrorCode(w, e.msg, e.code, http.StatusForbidden)
+}
+
+// lockUser takes a row lock on the user until tx ends, so concurrent
+// requests checking the same user's limits run one after another.
+func lockUser(tx *sqlx.Tx, userID int64) error {
+	var id int64
+	return tx.Get(&id, "SELECT id FROM users WHERE id=$1 FOR UPDATE", userID)
+}
+
+// checkAmountLimit checks amount against the per-agreement limits of the
+// user's verification level and trust score. role is "borrow" or "lend".
+func checkAmountLimit(tx *sqlx.Tx, cfg *config.Config, userID int64, role string, amount float64) (*limitError, error) {
+	if len(cfg.MaxAgreementAmount) == 0 && len(cfg.MaxAgreementAmountByScore) == 0 {
+		return nil, nil
+	}
+
+	var user struct {
+		models.User
+		TrustScore int `db:"trust_score"`
+	}
+	err := tx.Get(&user, `
+		SELECT email_verified_at, identity_verified_at,
+		       COALESCE((SELECT score FROM trust_scores WHERE user_id = users.id), 0) AS trust_score
+		FROM users WHERE id=$1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	level := user.VerificationLevel()
+	if limit := cfg.MaxAgreementAmount[level]; limit > 0 && amount > limit {
+		msg := fmt.Sprintf("you can %s at most %.2f KZT per agreement at your verification level", role, limit)
+		if level < trust.LevelIdentity {
+			msg += "; verify your identity to raise it"
+		}
+		return &limitError{code: "verification_limit_exceeded", msg: msg}, nil
+	}
+
+	if limit := scoreLimit(cfg.MaxAgreementAmountByScore, user.TrustScore); limit > 0 && amount > limit {
+		return &limitError{
+			code: "trust_score_limit_exceeded",
+			msg:  fmt.Sprintf("you can %s at most %.2f KZT per agreement with a trust score of %d", role, limit, user.TrustScore),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// scoreLimit returns the limit of the highest tier score reaches, or 0.
+func scoreLimit(limits []config.ScoreLimit, score int) float64 {
+	limit := 0.0
+	for _, l := range limits {
+		if score >= l.MinScore {
+			limit = l.Amount
+		}
+	}
+	return limit
+}
+
+// checkBorrowerLimits checks that borrowing amount more keeps the borrower
+// within their outstanding principal and, for a new request, pending
+// request limits. The borrower must be locked with lockUser in tx.
+func checkBorrowerLimits(tx *sqlx.Tx, cfg *config.Config, borrowerID int64, amount float64, newRequest bool) (*limitError, error) {
+	if cfg.MaxOutstandingPrincipal <= 0 && (!newRequest || cfg.MaxPendingRequests <= 0) {
+		return nil, nil
+	}
+
+	var totals struct {
+		Outstanding float64 `db:"outstanding"`
+		Pending     int     `db:"pending"`
+	}
+	err := tx.Get(&totals, `
+		SELECT
+			COALESCE(SUM(principal_amount) FILTER (WHERE status IN ('active', 'disputed')), 0) AS outstanding,
+			COUNT(*) FILTER (WHERE status = 'pending') AS pending
+		FROM agreements
+		WHERE borrower_id = $1
+	`, borrowerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if newRequest && cfg.MaxPendingRequests > 0 && totals.Pending >= cfg.MaxPendingRequests {
+		return &limitError{
+			code: "pending_limit_exceeded",
+			msg:  fmt.Sprintf("you can have at most %d agreement requests awaiting a lender", cfg.MaxPendingRequests),
+		}, nil
+	}
+
+	if cfg.MaxOutstandingPrincipal > 0 && totals.Outstanding+amount > cfg.MaxOutstandingPrincipal {
+		return &limitError{
+			code: "outstanding_limit_exceeded",
+			msg: fmt.Sprintf("a borrower can owe at most %.2f KZT in principal at a time and already owes %.2f KZT",
+				cfg.MaxOutstandingPrincipal, totals.Outstanding),
+		}, nil
+	}
+
+	return nil, nil
+}
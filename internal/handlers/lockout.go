@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/mailer"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// Failed logins are counted per account (by email, so unknown addresses are
+// throttled the same way and lockouts reveal nothing) and per client IP.
+const (
+	throttleScopeAccount = "account"
+	throttleScopeIP      = "ip"
+
+	// freeLoginAttempts is how many failures go without any delay.
+	freeLoginAttempts = 3
+	// maxLoginDelay caps the progressive delay between attempts.
+	maxLoginDelay = time.Minute
+)
+
+type loginThrottle struct {
+	Scope        string     `db:"scope"`
+	Key          string     `db:"key"`
+	Failures     int        `db:"failures"`
+	LastFailedAt *time.Time `db:"last_failed_at"`
+	LockedUntil  *time.Time `db:"locked_until"`
+}
+
+// loginDelay is how long to wait after the given number of consecutive
+// failures: nothing for the first freeLoginAttempts, then 1s, 2s, 4s, ...
+// up to maxLoginDelay.
+func loginDelay(failures int) time.Duration {
+	if failures < freeLoginAttempts {
+		return 0
+	}
+	n := failures - freeLoginAttempts
+	if n >= 6 {
+		return maxLoginDelay
+	}
+	return min(time.Second<<n, maxLoginDelay)
+}
+
+// retryAfter returns how long the client has to wait before its next
+// attempt, or zero if it may try now.
+func (t loginThrottle) retryAfter(now time.Time) time.Duration {
+	if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+		return t.LockedUntil.Sub(now)
+	}
+	if t.LastFailedAt == nil {
+		return 0
+	}
+	if wait := t.LastFailedAt.Add(loginDelay(t.Failures)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// checkLoginThrottle locks the throttle row of email in tx and rejects the
+// attempt while the account or ip is delayed or locked. The account row
+// stays locked until tx ends, so concurrent attempts on one account are
+// checked one after the other and each sees the failures counted before
+// it. The ip row is only read: locking it would serialize every login from
+// behind one address, and its limit is far higher anyway. It writes a 429
+// response with Retry-After and returns false in that case.
+func (h *AuthHandler) checkLoginThrottle(w http.ResponseWriter, tx *sqlx.Tx, email, ip string) bool {
+	// a new account row is inserted (and locked) if there is none yet; it
+	// is rolled back with tx unless a failure is counted
+	var account loginThrottle
+	err := tx.Get(&account, `
+		INSERT INTO login_throttle (scope, key) VALUES ($1, $2)
+		ON CONFLICT (scope, key) DO UPDATE SET key = EXCLUDED.key
+		RETURNING scope, key, failures, last_failed_at, locked_until
+	`, throttleScopeAccount, email)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
+		return false
+	}
+
+	var byIP loginThrottle
+	err = h.DB.Get(&byIP, `
+		SELECT scope, key, failures, last_failed_at, locked_until FROM login_throttle
+		WHERE scope = $1 AND key = $2
+	`, throttleScopeIP, ip)
+	if err != nil && err != sql.ErrNoRows {
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
+		return false
+	}
+
+	now := time.Now()
+	wait, locked := time.Duration(0), false
+	for _, t := range []loginThrottle{account, byIP} {
+		wait = max(wait, t.retryAfter(now))
+		if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+			locked = true
+		}
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	seconds := int(wait.Round(time.Second).Seconds())
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	if locked {
+		utils.WriteJSONErrorCode(w, "too many failed login attempts, try again later", "login_locked", http.StatusTooManyRequests)
+	} else {
+		utils.WriteJSONErrorCode(w, "too many failed login attempts, slow down", "login_throttled", http.StatusTooManyRequests)
+	}
+	return false
+}
+
+// recordLoginFailure counts a failed attempt against the account and the IP
+// and, when an existing account gets locked, notifies its owner with an
+// unlock link.
+func (h *AuthHandler) recordLoginFailure(ctx context.Context, email, ip string) {
+	if h.countLoginFailures(h.DB, email, ip) {
+		h.notifyLockout(ctx, email)
+	}
+}
+
+// countLoginFailures counts a failed attempt against the account, through
+// accountDB, and the IP, always directly, and locks whichever reached its
+// limit. It reports whether the account got locked. Errors are only
+// logged, they must not change the login response.
+func (h *AuthHandler) countLoginFailures(accountDB sqlx.Ext, email, ip string) bool {
+	accountLocked, err := h.countLoginFailure(accountDB, throttleScopeAccount, email, h.Cfg.LoginMaxAccountFailures)
+	if err != nil {
+		log.Printf("failed to record login failure: %v", err)
+		return false
+	}
+	if _, err := h.countLoginFailure(h.DB, throttleScopeIP, ip, h.Cfg.LoginMaxIPFailures); err != nil {
+		log.Printf("failed to record login failure: %v", err)
+		return false
+	}
+	return accountLocked
+}
+
+func (h *AuthHandler) notifyLockout(ctx context.Context, email string) {
+	if err := h.sendLockoutNotice(ctx, email); err != nil {
+		log.Printf("failed to send lockout notice: %v", err)
+	}
+}
+
+// countLoginFailure increments the failure counter of one scope, starting
+// over when the previous failure is older than the lockout duration. Once
+// limit is reached the key is locked and the counter reset, so the delays
+// start over after the lockout ends.
+func (h *AuthHandler) countLoginFailure(db sqlx.Ext, scope, key string, limit int) (bool, error) {
+	var failures int
+	err := sqlx.Get(db, &failures, `
+		INSERT INTO login_throttle (scope, key, failures, last_failed_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttle.last_failed_at < NOW() - $3 * INTERVAL '1 second' THEN 1
+				ELSE login_throttle.failures + 1
+			END,
+			last_failed_at = NOW()
+		RETURNING failures
+	`, scope, key, int(h.Cfg.LoginLockoutDuration.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	if failures < limit {
+		return false, nil
+	}
+
+	_, err = db.Exec(`
+		UPDATE login_throttle SET failures = 0, locked_until = $3
+		WHERE scope = $1 AND key = $2
+	`, scope, key, time.Now().Add(h.Cfg.LoginLockoutDuration))
+	return err == nil, err
+}
+
+// clearAccountThrottle forgets failed attempts for the user's account after
+// a successful login or a proof of email ownership. IP counters are kept, so
+// logging into one's own account does not reset an attacker's budget.
+func clearAccountThrottle(db sqlx.Execer, userID int64) error {
+	_, err := db.Exec(`
+		DELETE FROM login_throttle
+		WHERE scope = 'account' AND key = (SELECT lower(email) FROM users WHERE id = $1)
+	`, userID)
+	return err
+}
+
+func (h *AuthHandler) sendLockoutNotice(ctx context.Context, email string) error {
+	var userID int
+	err := h.DB.Get(&userID, "SELECT id FROM users WHERE lower(email) = $1 AND deleted_at IS NULL", email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("DELETE FROM account_unlock_tokens WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO account_unlock_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, utils.HashToken(token), time.Now().Add(h.Cfg.LoginLockoutDuration))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(h.Cfg.AppURL, "/") + "/unlock-account?token=" + token
+	return h.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your Uade account was locked",
+		Text: "We locked logins to your Uade account after several failed attempts.\n\n" +
+			"It unlocks by itself in " + h.Cfg.LoginLockoutDuration.String() + ". " +
+			"If it was you, open this link to unlock it now:\n" + link + "\n\n" +
+			"If it was not you, someone may be guessing your password. " +
+			"Consider choosing a new one and enabling two-factor authentication.\n",
+	})
+}
+
+// UnlockAccount lifts a login lockout using the token from the lockout email.
+func (h *AuthHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.Token == "" {
+		utils.WriteJSONError(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var userID int64
+	err = tx.Get(&userID, `
+		UPDATE account_unlock_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, utils.HashToken(input.Token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		utils.WriteJSONError(w, "failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := clearAccountThrottle(tx, userID); err != nil {
+		utils.WriteJSONError(w, "failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var throttleColumns = []string{"scope", "key", "failures", "last_failed_at", "locked_until"}
+
+// expectLoginThrottle expects Login to lock the throttle row of the account
+// and read the one of the IP, finding no previous failures.
+func expectLoginThrottle(mock sqlmock.Sqlmock, email string) {
+	expectLoginThrottleRows(mock, email,
+		sqlmock.NewRows(throttleColumns).AddRow("account", email, 0, nil, nil),
+		sqlmock.NewRows(throttleColumns).AddRow("ip", "192.0.2.1", 0, nil, nil))
+}
+
+func expectLoginThrottleRows(mock sqlmock.Sqlmock, email string, account, ip *sqlmock.Rows) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO login_throttle \(scope, key\) VALUES \(\$1, \$2\) ON CONFLICT \(scope, key\) DO UPDATE SET key = EXCLUDED.key RETURNING`).
+		WithArgs("account", email).
+		WillReturnRows(account)
+	mock.ExpectQuery(`SELECT scope, key, failures, last_failed_at, locked_until FROM login_throttle\s+WHERE scope = \$1 AND key = \$2`).
+		WithArgs("ip", sqlmock.AnyArg()).
+		WillReturnRows(ip)
+}
+
+// expectLoginFailure expects a failure to be counted for the account and the
+// IP without reaching either limit.
+func expectLoginFailure(mock sqlmock.Sqlmock, email string, failures int) {
+	mock.ExpectQuery(`INSERT INTO login_throttle`).
+		WithArgs("account", email, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(failures))
+	mock.ExpectQuery(`INSERT INTO login_throttle`).
+		WithArgs("ip", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(failures))
+}
+
+// withLockout configures a low account failure limit for newAuthTestHandler.
+func withLockout(cfg *config.Config) {
+	cfg.LoginMaxAccountFailures = 3
+	cfg.LoginMaxIPFailures = 50
+	cfg.LoginLockoutDuration = 15 * time.Minute
+}
+
+func TestLoginDelay(t *testing.T) {
+	require.Equal(t, time.Duration(0), loginDelay(0))
+	require.Equal(t, time.Duration(0), loginDelay(freeLoginAttempts-1))
+	require.Equal(t, time.Second, loginDelay(freeLoginAttempts))
+	require.Equal(t, 4*time.Second, loginDelay(freeLoginAttempts+2))
+	require.Equal(t, maxLoginDelay, loginDelay(freeLoginAttempts+20))
+}
+
+func TestLogin_Throttled(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, withLockout)
+
+	expectLoginThrottleRows(mock, "user@example.com",
+		sqlmock.NewRows(throttleColumns).AddRow("account", "user@example.com", freeLoginAttempts+3, time.Now(), nil),
+		sqlmock.NewRows(throttleColumns).AddRow("ip", "192.0.2.1", 0, nil, nil))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"email":"User@example.com","password":"12345678"}`))
+	rec := httptest.NewRecorder()
+	h.Login(rec, req)
+
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "8", rec.Header().Get("Retry-After"))
+	require.Contains(t, rec.Body.String(), `"code":"login_throttled"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_Locked(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, withLockout)
+
+	expectLoginThrottleRows(mock, "user@example.com",
+		sqlmock.NewRows(throttleColumns).AddRow("account", "user@example.com", 0, nil, nil),
+		sqlmock.NewRows(throttleColumns).AddRow("ip", "192.0.2.1", 0, time.Now(), time.Now().Add(10*time.Minute)))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"email":"user@example.com","password":"12345678"}`))
+	rec := httptest.NewRecorder()
+	h.Login(rec, req)
+
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "600", rec.Header().Get("Retry-After"))
+	require.Contains(t, rec.Body.String(), `"code":"login_locked"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_LockoutNotifiesOwner(t *testing.T) {
+	h, mock, m := newAuthTestHandler(t, withLockout)
+
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectQuery(`SELECT id, password_hash, state, suspended_until, totp_enabled_at FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash", "state", "suspended_until"}).AddRow(1, "not-a-hash", "active", nil))
+	mock.ExpectQuery(`INSERT INTO login_throttle`).
+		WithArgs("account", "user@example.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+	mock.ExpectExec(`UPDATE login_throttle SET failures = 0, locked_until = \$3`).
+		WithArgs("account", "user@example.com", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO login_throttle`).
+		WithArgs("ip", "192.0.2.1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT id FROM users WHERE lower\(email\) = \$1`).
+		WithArgs("user@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM account_unlock_tokens`).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO account_unlock_tokens`).
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"email":"user@example.com","password":"wrong-pass"}`))
+	rec := httptest.NewRecorder()
+	h.Login(rec, req)
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Len(t, m.Sent(), 1)
+	require.Equal(t, "user@example.com", m.Sent()[0].To)
+	require.Contains(t, m.Sent()[0].Text, "https://uade.kz/unlock-account?token=")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnlockAccount_InvalidToken(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, withLockout)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE account_unlock_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("bogus")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/unlock", strings.NewReader(`{"token":"bogus"}`))
+	rec := httptest.NewRecorder()
+	h.UnlockAccount(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnlockAccount_Success(t *testing.T) {
+	h, mock, _ := newAuthTestHandler(t, withLockout)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE account_unlock_tokens SET used_at = NOW\(\)`).
+		WithArgs(utils.HashToken("valid")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectExec(`DELETE FROM login_throttle`).
+		WithArgs(int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/unlock", strings.NewReader(`{"token":"valid"}`))
+	rec := httptest.NewRecorder()
+	h.UnlockAccount(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
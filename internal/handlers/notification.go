@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/notify"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+type NotificationHandler struct {
+	DB *sqlx.DB
+}
+
+func NewNotificationHandler(db *sqlx.DB) *NotificationHandler {
+	return &NotificationHandler{DB: db}
+}
+
+// List returns the caller's notifications, newest first. With unread=true
+// only those not yet read are returned.
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT id, user_id, type, agreement_id, data, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1`
+	args := []any{caller.UserID}
+	if r.URL.Query().Get("unread") == "true" {
+		query += " AND read_at IS NULL"
+	}
+
+	limit, offset := pagination(r)
+	args = append(args, limit)
+	query += " ORDER BY created_at DESC, id DESC LIMIT $" + strconv.Itoa(len(args))
+	args = append(args, offset)
+	query += " OFFSET $" + strconv.Itoa(len(args))
+
+	notifications := make([]models.Notification, 0)
+	if err := h.DB.Select(&notifications, query, args...); err != nil {
+		utils.WriteJSONError(w, "failed to fetch notifications", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, notifications, http.StatusOK)
+}
+
+// MarkRead marks one of the caller's notifications as read.
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.DB.Exec(
+		"UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2",
+		id, caller.UserID,
+	)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to mark notification as read", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.WriteJSONError(w, "notification not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkAllRead marks every unread notification of the caller as read.
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.DB.Exec("UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL", caller.UserID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to mark notifications as read", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Settings returns the caller's email language and, for every notification
+// type, the channels it is delivered on.
+func (h *NotificationHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	settings, err := h.settings(caller.UserID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, settings, http.StatusOK)
+}
+
+// UpdateSettings changes the email language and the channels of the listed
+// notification types; in_app or email left out of an entry stay as they
+// are.
+func (h *NotificationHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Locale      *string `json:"locale"`
+		Preferences []struct {
+			Type  string `json:"type"`
+			InApp *bool  `json:"in_app"`
+			Email *bool  `json:"email"`
+		} `json:"preferences"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.Locale != nil && !notify.ValidLocale(*input.Locale) {
+		utils.WriteJSONError(w, "unsupported locale", http.StatusBadRequest)
+		return
+	}
+	for _, p := range input.Preferences {
+		if !notify.ValidType(p.Type) {
+			utils.WriteJSONError(w, "unknown notification type: "+p.Type, http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to update notification settings", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if input.Locale != nil {
+		if _, err := tx.Exec("UPDATE users SET locale = $1 WHERE id = $2", *input.Locale, caller.UserID); err != nil {
+			utils.WriteJSONError(w, "failed to update notification settings", http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, p := range input.Preferences {
+		_, err := tx.Exec(`
+			INSERT INTO notification_preferences (user_id, type, in_app, email)
+			VALUES ($1, $2, COALESCE($3, true), COALESCE($4, true))
+			ON CONFLICT (user_id, type) DO UPDATE
+			SET in_app = COALESCE($3, notification_preferences.in_app),
+			    email = COALESCE($4, notification_preferences.email)
+		`, caller.UserID, p.Type, p.InApp, p.Email)
+		if err != nil {
+			utils.WriteJSONError(w, "failed to update notification settings", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to update notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	h.Settings(w, r)
+}
+
+// settings lists a preference for every type, with every channel on for
+// types the user never changed.
+func (h *NotificationHandler) settings(userID int64) (models.NotificationSettings, error) {
+	settings := models.NotificationSettings{Preferences: make([]models.NotificationPreference, 0, len(notify.Types))}
+	if err := h.DB.Get(&settings.Locale, "SELECT locale FROM users WHERE id = $1", userID); err != nil {
+		return settings, err
+	}
+
+	var stored []models.NotificationPreference
+	err := h.DB.Select(&stored, "SELECT type, in_app, email FROM notification_preferences WHERE user_id = $1", userID)
+	if err != nil {
+		return settings, err
+	}
+	byType := make(map[string]models.NotificationPreference, len(stored))
+	for _, p := range stored {
+		byType[p.Type] = p
+	}
+
+	for _, t := range notify.Types {
+		p, ok := byType[t]
+		if !ok {
+			p = models.NotificationPreference{Type: t, InApp: true, Email: true}
+		}
+		settings.Preferences = append(settings.Preferences, p)
+	}
+	return settings, nil
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var notificationColumns = []string{"id", "user_id", "type", "agreement_id", "data", "read_at", "created_at"}
+
+func TestNotificationList_Unread(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewNotificationHandler(db)
+
+	mock.ExpectQuery(`FROM notifications\s+WHERE user_id = \$1 AND read_at IS NULL ORDER BY created_at DESC, id DESC LIMIT \$2 OFFSET \$3`).
+		WithArgs(int64(2), 10, 20).
+		WillReturnRows(sqlmock.NewRows(notificationColumns).
+			AddRow(5, 2, "agreement_accepted", 9, []byte(`{}`), nil, time.Now()))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/notifications?unread=true&limit=10&offset=20", nil), 2)
+	rec := httptest.NewRecorder()
+	h.List(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"type":"agreement_accepted"`)
+	require.Contains(t, rec.Body.String(), `"agreement_id":9`)
+	require.NotContains(t, rec.Body.String(), "read_at")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationList_Empty(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewNotificationHandler(db)
+
+	mock.ExpectQuery(`WHERE user_id = \$1 ORDER BY`).
+		WithArgs(int64(2), defaultPageLimit, 0).
+		WillReturnRows(sqlmock.NewRows(notificationColumns))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/notifications", nil), 2)
+	rec := httptest.NewRecorder()
+	h.List(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `[]`, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func markNotificationRead(h *NotificationHandler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/notifications/5/read", nil)
+	req.SetPathValue("id", "5")
+	rec := httptest.NewRecorder()
+	h.MarkRead(rec, asUser(req, 2))
+	return rec
+}
+
+func TestNotificationMarkRead(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewNotificationHandler(db)
+
+	mock.ExpectExec(`UPDATE notifications SET read_at = COALESCE\(read_at, NOW\(\)\) WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(int64(5), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := markNotificationRead(h)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationMarkRead_OtherUsers(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewNotificationHandler(db)
+
+	mock.ExpectExec(`UPDATE notifications SET read_at`).
+		WithArgs(int64(5), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rec := markNotificationRead(h)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationMarkAllRead(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewNotificationHandler(db)
+
+	mock.ExpectExec(`UPDATE notifications SET read_at = NOW\(\) WHERE user_id = \$1 AND read_at IS NULL`).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	req := asUser(httptest.NewRequest(http.MethodPost, "/api/notifications/read-all", nil), 2)
+	rec := httptest.NewRecorder()
+	h.MarkAllRead(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationSettings_Defaults(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewNotificationHandler(db)
+
+	mock.ExpectQuery(`SELECT locale FROM users WHERE id = \$1`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"locale"}).AddRow("ru"))
+	mock.ExpectQuery(`SELECT type, in_app, email FROM notification_preferences WHERE user_id = \$1`).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "in_app", "email"}).AddRow("review_received", true, false))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/users/me/notification-settings", nil), 2)
+	rec := httptest.NewRecorder()
+	h.Settings(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"locale":"ru"`)
+	require.Contains(t, rec.Body.String(), `{"type":"agreement_requested","in_app":true,"email":true}`)
+	require.Contains(t, rec.Body.String(), `{"type":"review_received","in_app":true,"email":false}`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func updateNotificationSettings(h *NotificationHandler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/api/users/me/notification-settings", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.UpdateSettings(rec, asUser(req, 2))
+	return rec
+}
+
+func TestNotificationUpdateSettings(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewNotificationHandler(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET locale = \$1 WHERE id = \$2`).
+		WithArgs("ru", int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO notification_preferences .* ON CONFLICT \(user_id, type\) DO UPDATE`).
+		WithArgs(int64(2), "agreement_due_soon", nil, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT locale FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"locale"}).AddRow("ru"))
+	mock.ExpectQuery(`FROM notification_preferences`).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "in_app", "email"}).AddRow("agreement_due_soon", true, false))
+
+	rec := updateNotificationSettings(h, `{"locale":"ru","preferences":[{"type":"agreement_due_soon","email":false}]}`)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `{"type":"agreement_due_soon","in_app":true,"email":false}`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationUpdateSettings_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"unknown locale", `{"locale":"de"}`, "unsupported locale"},
+		{"unknown type", `{"preferences":[{"type":"agreement_exploded","email":false}]}`, "unknown notification type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			h := NewNotificationHandler(db)
+
+			rec := updateNotificationSettings(h, tt.body)
+
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+			require.Contains(t, rec.Body.String(), tt.want)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
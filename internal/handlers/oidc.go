@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/oidc"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+var (
+	errIdentityEmailNotVerified = errors.New("the provider has not verified this email address")
+	errIdentityAccountExists    = errors.New("an account with this email already exists; log in with your password and verify your email first")
+	errIdentityConflict         = errors.New("this account is already linked to another account at this provider")
+)
+
+// OIDCHandler logs users in through external OpenID Connect providers. The
+// frontend starts a login, sends the user to the returned authorization URL
+// and passes the code and state the provider redirects back with to
+// Callback, which answers like AuthHandler.Login.
+type OIDCHandler struct {
+	Auth      *AuthHandler
+	Providers map[string]*oidc.Provider
+}
+
+func NewOIDCHandler(auth *AuthHandler, providers map[string]*oidc.Provider) *OIDCHandler {
+	return &OIDCHandler{Auth: auth, Providers: providers}
+}
+
+// ListProviders returns the names of the configured providers.
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(h.Providers))
+	for name := range h.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	utils.WriteJSON(w, map[string][]string{"providers": names}, http.StatusOK)
+}
+
+func (h *OIDCHandler) provider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	p, ok := h.Providers[r.PathValue("provider")]
+	if !ok {
+		utils.WriteJSONError(w, "unknown provider", http.StatusNotFound)
+	}
+	return p, ok
+}
+
+// Start begins a login at the provider with a fresh state, nonce and PKCE
+// verifier, and returns the URL to send the user to.
+func (h *OIDCHandler) Start(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Device string `json:"device"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		token, err := utils.GenerateToken()
+		if err != nil {
+			utils.WriteJSONError(w, "failed to start login", http.StatusInternalServerError)
+			return
+		}
+		secrets[i] = token
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := p.AuthCodeURL(r.Context(), state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		log.Printf("oidc %s: %v", p.Name, err)
+		utils.WriteJSONError(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	_, err = h.Auth.DB.Exec(`
+		INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, device, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, utils.HashToken(state), p.Name, nonce, verifier, strings.TrimSpace(input.Device), time.Now().Add(h.Auth.Cfg.OIDCLoginTTL))
+	if err != nil {
+		utils.WriteJSONError(w, "failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, map[string]string{"authorization_url": authURL}, http.StatusOK)
+}
+
+// Callback completes a login with the code and state from the provider. The
+// identity is matched to a linked user, else linked to the user with the
+// same verified email, else a new user is created.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.Code == "" || input.State == "" {
+		utils.WriteJSONError(w, "code and state are required", http.StatusBadRequest)
+		return
+	}
+
+	// each state can be used once, so a stolen callback URL cannot be replayed
+	var login struct {
+		Nonce        string `db:"nonce"`
+		CodeVerifier string `db:"code_verifier"`
+		Device       string `db:"device"`
+	}
+	err := h.Auth.DB.Get(&login, `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+		RETURNING nonce, code_verifier, device
+	`, utils.HashToken(input.State), p.Name)
+	if err == sql.ErrNoRows {
+		utils.WriteJSONError(w, "invalid or expired state", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := p.Exchange(r.Context(), input.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("oidc %s: %v", p.Name, err)
+		utils.WriteJSONError(w, "login at identity provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := h.resolveIdentity(p.Name, claims)
+	switch {
+	case errors.Is(err, errIdentityEmailNotVerified):
+		utils.WriteJSONErrorCode(w, err.Error(), "email_not_verified", http.StatusForbidden)
+		return
+	case errors.Is(err, errIdentityAccountExists):
+		utils.WriteJSONErrorCode(w, err.Error(), "account_exists", http.StatusConflict)
+		return
+	case errors.Is(err, errIdentityConflict):
+		utils.WriteJSONErrorCode(w, err.Error(), "identity_conflict", http.StatusConflict)
+		return
+	case err != nil:
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	var user models.User
+	err = h.Auth.DB.Get(&user, "SELECT id, state, suspended_until, deleted_at, totp_enabled_at FROM users WHERE id=$1", userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if code := user.AccessDenial(time.Now()); code != "" {
+		utils.WriteAccessDenied(w, code, user.SuspendedUntil)
+		return
+	}
+
+	// the provider vouches for the first factor only
+	if user.TOTPEnabledAt != nil {
+		h.Auth.startLoginChallenge(w, user.ID, login.Device)
+		return
+	}
+
+	tokens, err := h.Auth.startSession(r, int(user.ID), login.Device)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, tokens, http.StatusOK)
+}
+
+// resolveIdentity returns the user the provider identity belongs to,
+// linking or creating one on first login.
+func (h *OIDCHandler) resolveIdentity(provider string, claims *oidc.Claims) (int64, error) {
+	tx, err := h.Auth.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var userID int64
+	err = tx.Get(&userID, `
+		UPDATE user_identities SET last_login_at = NOW(), email = $3
+		WHERE provider = $1 AND subject = $2
+		RETURNING user_id
+	`, provider, claims.Subject, claims.Email)
+	if err == nil {
+		return userID, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// linking by email is only safe when both sides have proven they own it
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, errIdentityEmailNotVerified
+	}
+
+	var existing struct {
+		ID              int64      `db:"id"`
+		EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	}
+	err = tx.Get(&existing, "SELECT id, email_verified_at FROM users WHERE lower(email) = lower($1) FOR UPDATE", claims.Email)
+	switch {
+	case err == nil:
+		// an unverified account may have been registered by someone else
+		// who knows its password
+		if existing.EmailVerifiedAt == nil {
+			return 0, errIdentityAccountExists
+		}
+		userID = existing.ID
+
+		var linked bool
+		err = tx.Get(&linked, "SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = $1 AND provider = $2)", userID, provider)
+		if err != nil {
+			return 0, err
+		}
+		if linked {
+			return 0, errIdentityConflict
+		}
+
+	case err == sql.ErrNoRows:
+		userID, err = createIdentityUser(tx, claims)
+		if err != nil {
+			return 0, err
+		}
+
+	default:
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+	`, userID, provider, claims.Subject, claims.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// createIdentityUser registers a user from provider claims. The account has
+// no usable password; one can be set through the password reset flow.
+func createIdentityUser(tx *sqlx.Tx, claims *oidc.Claims) (int64, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+	if len(name) > 256 {
+		name = name[:256]
+	}
+
+	secret, err := utils.GenerateToken()
+	if err != nil {
+		return 0, err
+	}
+	passwordHash, err := utils.HashPassword(secret)
+	if err != nil {
+		return 0, fmt.Errorf("hash password: %w", err)
+	}
+
+	var userID int64
+	err = tx.Get(&userID, `
+		INSERT INTO users (name, email, password_hash, email_verified_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING id
+	`, name, claims.Email, passwordHash)
+	return userID, err
+}
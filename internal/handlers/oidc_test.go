@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/oidc"
+	"github.com/railanbaigazy/uade-api/internal/oidc/oidctest"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// captureArg matches any string argument and remembers it.
+type captureArg struct{ value *string }
+
+func (c captureArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.value = s
+	return ok
+}
+
+type oidcTest struct {
+	h    *OIDCHandler
+	mock sqlmock.Sqlmock
+	srv  *oidctest.Server
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	srv, err := oidctest.NewServer("uade", "client-secret")
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	cfg := &config.Config{
+		JWTKeys:           jwtkeys.NewHMAC("test-secret"),
+		AccessTokenTTL:    15 * time.Minute,
+		RefreshTokenTTL:   24 * time.Hour,
+		LoginChallengeTTL: 5 * time.Minute,
+		OIDCLoginTTL:      10 * time.Minute,
+	}
+	auth := NewAuthHandler(sqlx.NewDb(sqlDB, "sqlmock"), cfg, nil)
+	providers := map[string]*oidc.Provider{
+		"mock": oidc.NewProvider(srv.Config("mock", "https://uade.kz/oauth/callback/mock"), nil),
+	}
+
+	return &oidcTest{h: NewOIDCHandler(auth, providers), mock: mock, srv: srv}
+}
+
+// login runs Start, the provider's authorization and the expectations up to
+// the claimed login state, and returns the callback request.
+func (o *oidcTest) login(t *testing.T, user oidctest.User) *http.Request {
+	t.Helper()
+	o.srv.SetUser(user)
+
+	var nonce, verifier string
+	o.mock.ExpectExec(`INSERT INTO oidc_login_states`).
+		WithArgs(sqlmock.AnyArg(), "mock", captureArg{&nonce}, captureArg{&verifier}, "phone", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/mock/start", strings.NewReader(`{"device":"phone"}`))
+	req.SetPathValue("provider", "mock")
+	rec := httptest.NewRecorder()
+	o.h.Start(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	code, state, err := o.srv.Authorize(resp["authorization_url"])
+	require.NoError(t, err)
+
+	o.mock.ExpectQuery(`DELETE FROM oidc_login_states`).
+		WithArgs(utils.HashToken(state), "mock").
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "code_verifier", "device"}).AddRow(nonce, verifier, "phone"))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/oidc/mock/callback",
+		strings.NewReader(`{"code":"`+code+`","state":"`+state+`"}`))
+	req.SetPathValue("provider", "mock")
+	return req
+}
+
+func (o *oidcTest) expectSession(userID int) {
+	o.mock.ExpectQuery(`SELECT id, state, suspended_until, deleted_at, totp_enabled_at FROM users`).
+		WithArgs(int64(userID)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "state", "suspended_until", "deleted_at", "totp_enabled_at"}).
+			AddRow(userID, "active", nil, nil, nil))
+	o.mock.ExpectBegin()
+	o.mock.ExpectQuery(`INSERT INTO sessions`).
+		WithArgs(userID, "phone", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	o.mock.ExpectExec(`INSERT INTO refresh_tokens`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	o.mock.ExpectCommit()
+}
+
+var aigerim = oidctest.User{Subject: "sub-1", Email: "aigerim@example.com", EmailVerified: true, Name: "Aigerim"}
+
+func TestOIDCCallback_LinkedIdentity(t *testing.T) {
+	o := newOIDCTest(t)
+	req := o.login(t, aigerim)
+
+	o.mock.ExpectBegin()
+	o.mock.ExpectQuery(`UPDATE user_identities SET last_login_at`).
+		WithArgs("mock", "sub-1", "aigerim@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	o.mock.ExpectCommit()
+	o.expectSession(7)
+
+	rec := httptest.NewRecorder()
+	o.h.Callback(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), "refresh_token")
+	require.NoError(t, o.mock.ExpectationsWereMet())
+}
+
+func TestOIDCCallback_CreatesUser(t *testing.T) {
+	o := newOIDCTest(t)
+	req := o.login(t, aigerim)
+
+	o.mock.ExpectBegin()
+	o.mock.ExpectQuery(`UPDATE user_identities`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	o.mock.ExpectQuery(`SELECT id, email_verified_at FROM users WHERE lower\(email\) = lower\(\$1\) FOR UPDATE`).
+		WithArgs("aigerim@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email_verified_at"}))
+	o.mock.ExpectQuery(`INSERT INTO users`).
+		WithArgs("Aigerim", "aigerim@example.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	o.mock.ExpectExec(`INSERT INTO user_identities`).
+		WithArgs(int64(8), "mock", "sub-1", "aigerim@example.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	o.mock.ExpectCommit()
+	o.expectSession(8)
+
+	rec := httptest.NewRecorder()
+	o.h.Callback(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, o.mock.ExpectationsWereMet())
+}
+
+func TestOIDCCallback_LinksVerifiedAccount(t *testing.T) {
+	o := newOIDCTest(t)
+	req := o.login(t, aigerim)
+
+	o.mock.ExpectBegin()
+	o.mock.ExpectQuery(`UPDATE user_identities`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	o.mock.ExpectQuery(`SELECT id, email_verified_at FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email_verified_at"}).AddRow(3, time.Now()))
+	o.mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(int64(3), "mock").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	o.mock.ExpectExec(`INSERT INTO user_identities`).
+		WithArgs(int64(3), "mock", "sub-1", "aigerim@example.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	o.mock.ExpectCommit()
+	o.expectSession(3)
+
+	rec := httptest.NewRecorder()
+	o.h.Callback(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, o.mock.ExpectationsWereMet())
+}
+
+func TestOIDCCallback_UnverifiedAccountNotLinked(t *testing.T) {
+	o := newOIDCTest(t)
+	req := o.login(t, aigerim)
+
+	o.mock.ExpectBegin()
+	o.mock.ExpectQuery(`UPDATE user_identities`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	o.mock.ExpectQuery(`SELECT id, email_verified_at FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email_verified_at"}).AddRow(3, nil))
+	o.mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	o.h.Callback(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.Contains(t, rec.Body.String(), "account_exists")
+	require.NoError(t, o.mock.ExpectationsWereMet())
+}
+
+func TestOIDCCallback_UnverifiedProviderEmail(t *testing.T) {
+	o := newOIDCTest(t)
+	user := aigerim
+	user.EmailVerified = false
+	req := o.login(t, user)
+
+	o.mock.ExpectBegin()
+	o.mock.ExpectQuery(`UPDATE user_identities`).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	o.mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	o.h.Callback(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "email_not_verified")
+	require.NoError(t, o.mock.ExpectationsWereMet())
+}
+
+func TestOIDCCallback_UnknownState(t *testing.T) {
+	o := newOIDCTest(t)
+
+	o.mock.ExpectQuery(`DELETE FROM oidc_login_states`).
+		WithArgs(utils.HashToken("forged"), "mock").
+		WillReturnRows(sqlmock.NewRows([]string{"nonce", "code_verifier", "device"}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/mock/callback", strings.NewReader(`{"code":"c","state":"forged"}`))
+	req.SetPathValue("provider", "mock")
+	rec := httptest.NewRecorder()
+	o.h.Callback(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, o.mock.ExpectationsWereMet())
+}
+
+func TestOIDCStart_UnknownProvider(t *testing.T) {
+	o := newOIDCTest(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/other/start", nil)
+	req.SetPathValue("provider", "other")
+	rec := httptest.NewRecorder()
+	o.h.Start(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -1,31 +1,77 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/rbac"
+	"github.com/railanbaigazy/uade-api/internal/trust"
 	"github.com/railanbaigazy/uade-api/internal/utils"
 )
 
 type PostHandler struct {
-	DB *sqlx.DB
+	DB  *sqlx.DB
+	Cfg *config.Config
 }
 
-func NewPostHandler(db *sqlx.DB) *PostHandler {
-	return &PostHandler{DB: db}
+func NewPostHandler(db *sqlx.DB, cfg *config.Config) *PostHandler {
+	return &PostHandler{DB: db, Cfg: cfg}
 }
 
+var validPostTypes = map[string]bool{
+	"lend":   true,
+	"borrow": true,
+}
+
+var validReportReasons = map[string]bool{
+	"scam":  true,
+	"spam":  true,
+	"other": true,
+}
+
+// newPostStatus is the status of a freshly created or edited post.
+func (h *PostHandler) newPostStatus() string {
+	if h.Cfg.PostPreModeration {
+		return "pending_review"
+	}
+	return "published"
+}
+
+// GetAll lists published posts of authors that are not deleted, optionally
+// only those of one type and by authors with at least a given trust score.
 func (h *PostHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	minScore, ok := minScoreParam(w, r)
+	if !ok {
+		return
+	}
+
 	posts := make([]models.Post, 0)
 
-	query := `SELECT id, title, content, type, author_id, created_at 
+	query := `SELECT id, title, content, type, author_id, min_trust_score, created_at 
 	          FROM posts 
-	          ORDER BY created_at DESC`
+	          WHERE deleted_at IS NULL AND status = 'published'
+	            AND EXISTS (SELECT 1 FROM users u WHERE u.id = posts.author_id AND u.deleted_at IS NULL)`
+	args := []any{}
+	if postType := r.URL.Query().Get("type"); postType != "" {
+		if !validPostTypes[postType] {
+			utils.WriteJSONError(w, "type must be one of: lend, borrow", http.StatusBadRequest)
+			return
+		}
+		args = append(args, postType)
+		query += " AND type = $" + strconv.Itoa(len(args))
+	}
+	if minScore != nil {
+		args = append(args, *minScore)
+		query += " AND COALESCE((SELECT score FROM trust_scores WHERE user_id = posts.author_id), 0) >= $" + strconv.Itoa(len(args))
+	}
+	query += " ORDER BY created_at DESC"
 
-	if err := h.DB.Select(&posts, query); err != nil {
+	if err := h.DB.Select(&posts, query, args...); err != nil {
 		utils.WriteJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -35,23 +81,81 @@ func (h *PostHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Mine lists the caller's own posts in every moderation status, newest
+// first, so authors see posts awaiting review and why one was rejected.
+func (h *PostHandler) Mine(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r)
+
+	posts := make([]models.Post, 0)
+	err := h.DB.Select(&posts, `
+		SELECT id, title, content, type, author_id, status, moderation_reason, min_trust_score, created_at
+		FROM posts
+		WHERE author_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, caller.UserID, limit, offset)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch posts", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, posts, http.StatusOK)
+}
+
+// minScoreParam reads the optional min_score query parameter. Users without
+// a computed trust score count as 0.
+func minScoreParam(w http.ResponseWriter, r *http.Request) (*int, bool) {
+	raw := r.URL.Query().Get("min_score")
+	if raw == "" {
+		return nil, true
+	}
+	score, err := strconv.Atoi(raw)
+	if err != nil || score < 0 || score > trust.MaxScore {
+		utils.WriteJSONError(w, "min_score must be between 0 and 100", http.StatusBadRequest)
+		return nil, false
+	}
+	return &score, true
+}
+
+// validMinTrustScore reports whether a post's min_trust_score is unset or
+// a possible trust score.
+func validMinTrustScore(p models.Post) bool {
+	return p.MinTrustScore == nil || (*p.MinTrustScore >= 0 && *p.MinTrustScore <= trust.MaxScore)
+}
+
 func (h *PostHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var p models.Post
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
 		utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if p.MinTrustScore != nil && p.Type != "lend" {
+		utils.WriteJSONError(w, "min_trust_score is only allowed on lend posts", http.StatusBadRequest)
+		return
+	}
+	if !validMinTrustScore(p) {
+		utils.WriteJSONError(w, "min_trust_score must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
 
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
 	query := `
-		INSERT INTO posts (title, content, type, author_id, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		RETURNING id, created_at
+		INSERT INTO posts (title, content, type, author_id, status, min_trust_score, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, status, created_at
 	`
 
-	if err := h.DB.Get(&p, query, p.Title, p.Content, p.Type, userID); err != nil {
+	if err := h.DB.Get(&p, query, p.Title, p.Content, p.Type, userID, h.newPostStatus(), p.MinTrustScore); err != nil {
 		utils.WriteJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -72,25 +176,50 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !validMinTrustScore(p) {
+		utils.WriteJSONError(w, "min_trust_score must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
 
-	var authorID int64
-	if err := h.DB.Get(&authorID, "SELECT author_id FROM posts WHERE id=$1", id); err != nil {
+	var post struct {
+		AuthorID int64  `db:"author_id"`
+		Type     string `db:"type"`
+	}
+	if err := h.DB.Get(&post, "SELECT author_id, type FROM posts WHERE id=$1 AND deleted_at IS NULL", id); err != nil {
 		utils.WriteJSONError(w, "not found", http.StatusNotFound)
 		return
 	}
 
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
-	if userID != authorID {
+	isModerator := rbac.Has(caller.Role, rbac.PostsModerate)
+	if userID != post.AuthorID && !isModerator {
 		utils.WriteJSONError(w, "not allowed", http.StatusForbidden)
 		return
 	}
+	if p.MinTrustScore != nil && post.Type != "lend" {
+		utils.WriteJSONError(w, "min_trust_score is only allowed on lend posts", http.StatusBadRequest)
+		return
+	}
 
-	_, err := h.DB.Exec(
-		"UPDATE posts SET title=$1, content=$2 WHERE id=$3",
-		p.Title, p.Content, id,
-	)
+	var err error
+	if h.Cfg.PostPreModeration && !isModerator {
+		// under pre-moderation an edit goes back to the queue, otherwise an
+		// approved post could be rewritten into anything
+		_, err = h.DB.Exec(
+			"UPDATE posts SET title=$1, content=$2, min_trust_score=$3, status='pending_review' WHERE id=$4",
+			p.Title, p.Content, p.MinTrustScore, id,
+		)
+	} else {
+		_, err = h.DB.Exec(
+			"UPDATE posts SET title=$1, content=$2, min_trust_score=$3 WHERE id=$4",
+			p.Title, p.Content, p.MinTrustScore, id,
+		)
+	}
 	if err != nil {
 		utils.WriteJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -103,22 +232,26 @@ func (h *PostHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
 
 	var authorID int64
-	if err := h.DB.Get(&authorID, "SELECT author_id FROM posts WHERE id=$1", id); err != nil {
+	if err := h.DB.Get(&authorID, "SELECT author_id FROM posts WHERE id=$1 AND deleted_at IS NULL", id); err != nil {
 		utils.WriteJSONError(w, "not found", http.StatusNotFound)
 		return
 	}
 
-	userIDStr := r.Header.Get("X-User-ID")
-	userID, _ := strconv.ParseInt(userIDStr, 10, 64)
-
-	if userID != authorID {
+	if userID != authorID && !rbac.Has(caller.Role, rbac.PostsModerate) {
 		utils.WriteJSONError(w, "not allowed", http.StatusForbidden)
 		return
 	}
 
-	_, err := h.DB.Exec("DELETE FROM posts WHERE id=$1", id)
+	// posts are soft-deleted so agreements referencing them stay intact;
+	// jobs.PurgeSoftDeleted removes them for good after the retention period
+	_, err := h.DB.Exec("UPDATE posts SET deleted_at = NOW() WHERE id=$1", id)
 	if err != nil {
 		utils.WriteJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -126,3 +259,95 @@ func (h *PostHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// Report files a complaint about a published post. Once the number of reports
+// since the last moderation decision reaches Cfg.PostReportThreshold the post
+// is hidden until a moderator reviews it.
+func (h *PostHandler) Report(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Reason  string `json:"reason"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !validReportReasons[input.Reason] {
+		utils.WriteJSONError(w, "reason must be one of: scam, spam, other", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to report post", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var authorID int64
+	err = tx.Get(&authorID, `
+		SELECT author_id FROM posts
+		WHERE id = $1 AND deleted_at IS NULL AND status = 'published'
+		FOR UPDATE
+	`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "post not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to report post", http.StatusInternalServerError)
+		return
+	}
+
+	if authorID == userID {
+		utils.WriteJSONError(w, "cannot report your own post", http.StatusBadRequest)
+		return
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO post_reports (post_id, reporter_id, reason, comment)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (post_id, reporter_id) DO NOTHING
+	`, id, userID, input.Reason, input.Comment)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to report post", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.WriteJSONError(w, "post already reported", http.StatusConflict)
+		return
+	}
+
+	// reports filed before a moderator approved the post were already reviewed
+	_, err = tx.Exec(`
+		UPDATE posts SET status = 'hidden'
+		WHERE id = $1 AND (
+			SELECT COUNT(*) FROM post_reports pr
+			WHERE pr.post_id = posts.id
+			  AND pr.created_at > COALESCE(posts.moderated_at, '-infinity')
+		) >= $2
+	`, id, h.Cfg.PostReportThreshold)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to report post", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to report post", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
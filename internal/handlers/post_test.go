@@ -11,6 +11,8 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/principal"
 	"github.com/railanbaigazy/uade-api/internal/utils"
 	"github.com/stretchr/testify/require"
 )
@@ -18,12 +20,12 @@ import (
 // Get All
 func TestPostHandler_GetAll_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	rows := sqlmock.NewRows([]string{"id", "title", "content", "author_id", "created_at"}).
 		AddRow(1, "Hello", "World", 10, time.Now())
 
-	mock.ExpectQuery(`SELECT id, title, content, type, author_id, created_at FROM posts`).
+	mock.ExpectQuery(`SELECT id, title, content, type, author_id, min_trust_score, created_at FROM posts`).
 		WillReturnRows(rows)
 
 	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
@@ -43,9 +45,9 @@ func TestPostHandler_GetAll_Success(t *testing.T) {
 
 func TestPostHandler_GetAll_DBError(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
-	mock.ExpectQuery(`SELECT id, title, content, type, author_id, created_at FROM posts`).
+	mock.ExpectQuery(`SELECT id, title, content, type, author_id, min_trust_score, created_at FROM posts`).
 		WillReturnError(sql.ErrConnDone)
 
 	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
@@ -59,10 +61,78 @@ func TestPostHandler_GetAll_DBError(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestPostHandler_GetAll_Filters(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{})
+
+	mock.ExpectQuery(`FROM posts WHERE .* AND type = \$1 AND COALESCE\(\(SELECT score FROM trust_scores WHERE user_id = posts.author_id\), 0\) >= \$2`).
+		WithArgs("borrow", 70).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts?type=borrow&min_score=70", nil)
+	rec := httptest.NewRecorder()
+
+	h.GetAll(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostHandler_GetAll_InvalidType(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts?type=foo", nil)
+	rec := httptest.NewRecorder()
+
+	h.GetAll(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "type must be one of")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostHandler_GetAll_HidesDeletedAuthors(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{})
+
+	mock.ExpectQuery(`FROM posts WHERE deleted_at IS NULL AND status = 'published' AND EXISTS \(SELECT 1 FROM users u WHERE u.id = posts.author_id AND u.deleted_at IS NULL\) ORDER BY created_at DESC`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	rec := httptest.NewRecorder()
+
+	h.GetAll(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostHandler_Mine(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{})
+
+	rows := sqlmock.NewRows([]string{"id", "title", "content", "type", "author_id", "status", "moderation_reason", "min_trust_score", "created_at"}).
+		AddRow(4, "Loan", "Details", "lend", 2, "rejected", "misleading terms", nil, time.Now())
+	mock.ExpectQuery(`FROM posts\s+WHERE author_id = \$1 AND deleted_at IS NULL ORDER BY created_at DESC, id DESC LIMIT \$2 OFFSET \$3`).
+		WithArgs(int64(2), defaultPageLimit, 0).
+		WillReturnRows(rows)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/users/me/posts", nil), 2)
+	rec := httptest.NewRecorder()
+
+	h.Mine(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"status":"rejected"`)
+	require.Contains(t, rec.Body.String(), `"moderation_reason":"misleading terms"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 // Create
 func TestPostHandler_Create_BadJSON(t *testing.T) {
 	db, _ := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(`{`)) // invalid JSON
 	rec := httptest.NewRecorder()
@@ -75,17 +145,17 @@ func TestPostHandler_Create_BadJSON(t *testing.T) {
 
 func TestPostHandler_Create_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	body := `{"title": "Test", "content": "Content", "type": "lend"}`
 	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "5")
+	req = asUser(req, 5)
 
 	rows := sqlmock.NewRows([]string{"id", "created_at"}).
 		AddRow(10, time.Now())
 
 	mock.ExpectQuery(`INSERT INTO posts`).
-		WithArgs("Test", "Content", "lend", int64(5)).
+		WithArgs("Test", "Content", "lend", int64(5), "published", nil).
 		WillReturnRows(rows)
 
 	rec := httptest.NewRecorder()
@@ -101,13 +171,28 @@ func TestPostHandler_Create_Success(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestPostHandler_Create_MinTrustScoreOnBorrowPost(t *testing.T) {
+	db, _ := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{})
+
+	body := `{"title": "Test", "content": "Content", "type": "borrow", "min_trust_score": 50}`
+	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
+	req = asUser(req, 5)
+
+	rec := httptest.NewRecorder()
+	h.Create(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "only allowed on lend posts")
+}
+
 func TestPostHandler_Create_DBError(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	body := `{"title": "Fail", "content": "Ops"}`
 	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 
 	mock.ExpectQuery(`INSERT INTO posts`).
 		WillReturnError(sql.ErrTxDone)
@@ -124,12 +209,12 @@ func TestPostHandler_Create_DBError(t *testing.T) {
 // Update
 func TestPostHandler_Update_NotFound(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPut, "/api/posts/999", strings.NewReader(`{"title":"x"}`))
 	req.SetPathValue("id", "999")
 
-	mock.ExpectQuery(`SELECT author_id FROM posts WHERE id=\$1`).
+	mock.ExpectQuery(`SELECT author_id, type FROM posts WHERE id=\$1`).
 		WithArgs("999").
 		WillReturnError(sql.ErrNoRows)
 
@@ -141,15 +226,15 @@ func TestPostHandler_Update_NotFound(t *testing.T) {
 
 func TestPostHandler_Update_Forbidden(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPut, "/api/posts/10", strings.NewReader(`{"title":"x","content":"y"}`))
-	req.Header.Set("X-User-ID", "2") // acting user
+	req = asUser(req, 2) // acting user
 	req.SetPathValue("id", "10")
 
 	// author is user 1, acting user is 2 → forbidden
-	mock.ExpectQuery(`SELECT author_id FROM posts`).
-		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(1))
+	mock.ExpectQuery(`SELECT author_id, type FROM posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(1, "lend"))
 
 	rec := httptest.NewRecorder()
 	h.Update(rec, req)
@@ -160,17 +245,17 @@ func TestPostHandler_Update_Forbidden(t *testing.T) {
 
 func TestPostHandler_Update_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodPut, "/api/posts/10", strings.NewReader(`{"title":"new","content":"updated"}`))
-	req.Header.Set("X-User-ID", "3")
+	req = asUser(req, 3)
 	req.SetPathValue("id", "10")
 
-	mock.ExpectQuery(`SELECT author_id FROM posts WHERE id=`).
-		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(3))
+	mock.ExpectQuery(`SELECT author_id, type FROM posts WHERE id=`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(3, "lend"))
 
 	mock.ExpectExec(`UPDATE posts`).
-		WithArgs("new", "updated", "10").
+		WithArgs("new", "updated", nil, "10").
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	rec := httptest.NewRecorder()
@@ -185,12 +270,32 @@ func TestPostHandler_Update_Success(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestPostHandler_Update_MinTrustScoreOnBorrowPost(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/posts/10", strings.NewReader(`{"title":"new","content":"updated","min_trust_score":50}`))
+	req = asUser(req, 3)
+	req.SetPathValue("id", "10")
+
+	mock.ExpectQuery(`SELECT author_id, type FROM posts WHERE id=`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "type"}).AddRow(3, "borrow"))
+
+	rec := httptest.NewRecorder()
+	h.Update(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "only allowed on lend posts")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 // Delete
 func TestPostHandler_Delete_NotFound(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodDelete, "/api/posts/20", nil)
+	req = asUser(req, 1)
 	req.SetPathValue("id", "20")
 
 	mock.ExpectQuery(`SELECT author_id FROM posts`).
@@ -204,10 +309,10 @@ func TestPostHandler_Delete_NotFound(t *testing.T) {
 
 func TestPostHandler_Delete_Forbidden(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodDelete, "/api/posts/12", nil)
-	req.Header.Set("X-User-ID", "9")
+	req = asUser(req, 9)
 	req.SetPathValue("id", "12")
 
 	mock.ExpectQuery(`SELECT author_id FROM posts`).
@@ -221,16 +326,16 @@ func TestPostHandler_Delete_Forbidden(t *testing.T) {
 
 func TestPostHandler_Delete_Success(t *testing.T) {
 	db, mock := utils.NewSQLXMock(t)
-	h := NewPostHandler(db)
+	h := NewPostHandler(db, &config.Config{})
 
 	req := httptest.NewRequest(http.MethodDelete, "/api/posts/7", nil)
-	req.Header.Set("X-User-ID", "3")
+	req = asUser(req, 3)
 	req.SetPathValue("id", "7")
 
 	mock.ExpectQuery(`SELECT author_id FROM posts`).
 		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(3))
 
-	mock.ExpectExec(`DELETE FROM posts`).
+	mock.ExpectExec(`UPDATE posts SET deleted_at = NOW\(\) WHERE id=\$1`).
 		WithArgs("7").
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
@@ -241,3 +346,147 @@ func TestPostHandler_Delete_Success(t *testing.T) {
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestPostHandler_Delete_Moderator(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/posts/12", nil)
+	req = principal.WithRequest(req, principal.Principal{UserID: 9, Role: "moderator"})
+	req.SetPathValue("id", "12")
+
+	// moderators may remove posts they did not author
+	mock.ExpectQuery(`SELECT author_id FROM posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(5))
+
+	mock.ExpectExec(`UPDATE posts SET deleted_at = NOW\(\) WHERE id=\$1`).
+		WithArgs("12").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := httptest.NewRecorder()
+	h.Delete(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostHandler_Create_PreModeration(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{PostPreModeration: true})
+
+	body := `{"title": "Test", "content": "Content", "type": "lend"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/posts", strings.NewReader(body))
+	req = asUser(req, 5)
+
+	rows := sqlmock.NewRows([]string{"id", "status", "created_at"}).
+		AddRow(10, "pending_review", time.Now())
+
+	mock.ExpectQuery(`INSERT INTO posts`).
+		WithArgs("Test", "Content", "lend", int64(5), "pending_review", nil).
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	h.Create(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	var p models.Post
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	require.Equal(t, "pending_review", p.Status)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Report
+func TestPostHandler_Report_InvalidReason(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{PostReportThreshold: 3})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/1/report", strings.NewReader(`{"reason":"boring"}`))
+	req = asUser(req, 2)
+	req.SetPathValue("id", "1")
+	rec := httptest.NewRecorder()
+
+	h.Report(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostHandler_Report_OwnPost(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{PostReportThreshold: 3})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT author_id FROM posts`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(2))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/1/report", strings.NewReader(`{"reason":"spam"}`))
+	req = asUser(req, 2)
+	req.SetPathValue("id", "1")
+	rec := httptest.NewRecorder()
+
+	h.Report(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostHandler_Report_AlreadyReported(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{PostReportThreshold: 3})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT author_id FROM posts`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(10))
+	mock.ExpectExec(`INSERT INTO post_reports`).
+		WithArgs(int64(1), int64(2), "scam", "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/1/report", strings.NewReader(`{"reason":"scam"}`))
+	req = asUser(req, 2)
+	req.SetPathValue("id", "1")
+	rec := httptest.NewRecorder()
+
+	h.Report(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostHandler_Report_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewPostHandler(db, &config.Config{PostReportThreshold: 3})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT author_id FROM posts`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(10))
+	mock.ExpectExec(`INSERT INTO post_reports`).
+		WithArgs(int64(1), int64(2), "scam", "asks for a deposit").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE posts SET status = 'hidden'`).
+		WithArgs(int64(1), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/1/report",
+		strings.NewReader(`{"reason":"scam","comment":"asks for a deposit"}`))
+	req = asUser(req, 2)
+	req.SetPathValue("id", "1")
+	rec := httptest.NewRecorder()
+
+	h.Report(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
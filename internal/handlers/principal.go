@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+// currentUser returns the authenticated caller stored by JWTAuth. Handlers
+// must not fall back to an anonymous user, so without a principal it
+// answers 401 and returns false.
+func currentUser(w http.ResponseWriter, r *http.Request) (principal.Principal, bool) {
+	p, ok := principal.FromContext(r.Context())
+	if !ok {
+		utils.WriteJSONError(w, "authentication required", http.StatusUnauthorized)
+	}
+	return p, ok
+}
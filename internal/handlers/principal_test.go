@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// asUser authenticates req as a regular user logged in with a session.
+func asUser(req *http.Request, userID int64) *http.Request {
+	return principal.WithRequest(req, principal.Principal{UserID: userID, Role: "user", Scopes: []string{principal.ScopeAll}})
+}
+
+func TestHandlersRejectMissingPrincipal(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	handlers := map[string]http.HandlerFunc{
+		"profile":          NewUserHandler(db, nil, nil).Profile,
+		"sessions":         NewSessionHandler(db).List,
+		"agreements":       NewAgreementHandler(db, nil).GetUserAgreements,
+		"delete post":      NewPostHandler(db, nil).Delete,
+		"two-factor setup": NewTwoFactorHandler(db, nil).Setup,
+	}
+
+	for name, h := range handlers {
+		t.Run(name, func(t *testing.T) {
+			// a spoofed header must not stand in for authentication
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-User-ID", "1")
+			req.SetPathValue("id", "1")
+			rec := httptest.NewRecorder()
+
+			h(rec, req)
+			require.Equal(t, http.StatusUnauthorized, rec.Code)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
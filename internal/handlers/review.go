@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/notify"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+const maxReviewCommentLength = 2000
+
+type ReviewHandler struct {
+	DB *sqlx.DB
+}
+
+func NewReviewHandler(db *sqlx.DB) *ReviewHandler {
+	return &ReviewHandler{DB: db}
+}
+
+// Create lets a party of a completed or defaulted agreement rate the other
+// party, once per agreement.
+func (h *ReviewHandler) Create(w http.ResponseWriter, r *http.Request) {
+	agreementID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Rating  int    `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.Rating < 1 || input.Rating > 5 {
+		utils.WriteJSONError(w, "rating must be between 1 and 5", http.StatusBadRequest)
+		return
+	}
+	input.Comment = strings.TrimSpace(input.Comment)
+	if utf8.RuneCountInString(input.Comment) > maxReviewCommentLength {
+		utils.WriteJSONError(w, "comment must be at most 2000 characters", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	var agreement struct {
+		LenderID   int64  `db:"lender_id"`
+		BorrowerID int64  `db:"borrower_id"`
+		Status     string `db:"status"`
+	}
+	err = h.DB.Get(&agreement, "SELECT lender_id, borrower_id, status FROM agreements WHERE id = $1", agreementID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "agreement not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch agreement", http.StatusInternalServerError)
+		return
+	}
+
+	var revieweeID int64
+	switch userID {
+	case agreement.LenderID:
+		revieweeID = agreement.BorrowerID
+	case agreement.BorrowerID:
+		revieweeID = agreement.LenderID
+	default:
+		utils.WriteJSONError(w, "only parties can review an agreement", http.StatusForbidden)
+		return
+	}
+
+	if agreement.Status != "completed" && agreement.Status != "defaulted" {
+		utils.WriteJSONError(w, "can only review completed or defaulted agreements", http.StatusBadRequest)
+		return
+	}
+
+	review := models.Review{
+		AgreementID: agreementID,
+		ReviewerID:  userID,
+		RevieweeID:  revieweeID,
+		Rating:      input.Rating,
+		Comment:     input.Comment,
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create review", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	err = tx.Get(&review, `
+		INSERT INTO reviews (agreement_id, reviewer_id, reviewee_id, rating, comment)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (agreement_id, reviewer_id) DO NOTHING
+		RETURNING id, status, created_at
+	`, agreementID, userID, revieweeID, input.Rating, input.Comment)
+	if err == sql.ErrNoRows {
+		utils.WriteJSONError(w, "agreement already reviewed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create review", http.StatusInternalServerError)
+		return
+	}
+
+	err = notify.Send(tx, notify.Event{
+		UserID:      revieweeID,
+		Type:        notify.ReviewReceived,
+		AgreementID: &agreementID,
+		Data:        map[string]any{"review_id": review.ID, "rating": input.Rating},
+	})
+	if err != nil {
+		utils.WriteJSONError(w, "failed to create review", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to create review", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, review, http.StatusCreated)
+}
+
+// ListForUser returns the published reviews about a user, newest first.
+func (h *ReviewHandler) ListForUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := pagination(r)
+
+	reviews := make([]models.Review, 0)
+	err = h.DB.Select(&reviews, `
+		SELECT rv.id, rv.agreement_id, rv.reviewer_id, u.name AS reviewer_name, rv.reviewee_id,
+		       rv.rating, rv.comment, rv.created_at
+		FROM reviews rv
+		JOIN users u ON u.id = rv.reviewer_id
+		WHERE rv.reviewee_id = $1 AND rv.status = 'published'
+		ORDER BY rv.created_at DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, offset)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, reviews, http.StatusOK)
+}
+
+// Report flags a review as abusive for moderators. Reported reviews stay
+// visible until a moderator hides them.
+func (h *ReviewHandler) Report(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	reason, ok := decodeReason(w, r)
+	if !ok {
+		return
+	}
+
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	var reviewerID int64
+	err = h.DB.Get(&reviewerID, "SELECT reviewer_id FROM reviews WHERE id = $1 AND status = 'published'", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "review not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to report review", http.StatusInternalServerError)
+		return
+	}
+	if reviewerID == userID {
+		utils.WriteJSONError(w, "cannot report your own review", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec(`
+		INSERT INTO review_reports (review_id, reporter_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (review_id, reporter_id) DO NOTHING
+	`, id, userID, reason)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to report review", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.WriteJSONError(w, "review already reported", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+var reviewAgreementColumns = []string{"lender_id", "borrower_id", "status"}
+
+func postReview(h *ReviewHandler, userID int64, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements/3/review", strings.NewReader(body))
+	req.SetPathValue("id", "3")
+	req = asUser(req, userID)
+	rec := httptest.NewRecorder()
+	h.Create(rec, req)
+	return rec
+}
+
+func TestReviewCreate_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewReviewHandler(db)
+
+	mock.ExpectQuery(`SELECT lender_id, borrower_id, status FROM agreements WHERE id = \$1`).
+		WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows(reviewAgreementColumns).AddRow(1, 2, "completed"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO reviews`).
+		WithArgs(int64(3), int64(2), int64(1), 5, "Paid on time").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(10, "published", time.Now()))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(int64(1), "review_received", sqlmock.AnyArg(), []byte(`{"rating":5,"review_id":10}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := postReview(h, 2, `{"rating":5,"comment":" Paid on time "}`)
+
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"reviewee_id":1`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviewCreate_OncePerAgreement(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewReviewHandler(db)
+
+	mock.ExpectQuery(`SELECT lender_id, borrower_id, status FROM agreements`).
+		WillReturnRows(sqlmock.NewRows(reviewAgreementColumns).AddRow(1, 2, "defaulted"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO reviews`).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	rec := postReview(h, 1, `{"rating":1}`)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviewCreate_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		userID     int64
+		status     string
+		body       string
+		wantStatus int
+	}{
+		{"rating too low", 1, "completed", `{"rating":0}`, http.StatusBadRequest},
+		{"rating too high", 1, "completed", `{"rating":6}`, http.StatusBadRequest},
+		{"comment too long", 1, "completed", `{"rating":3,"comment":"` + strings.Repeat("a", 2001) + `"}`, http.StatusBadRequest},
+		{"not a party", 9, "completed", `{"rating":3}`, http.StatusForbidden},
+		{"agreement still active", 1, "active", `{"rating":3}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := utils.NewSQLXMock(t)
+			h := NewReviewHandler(db)
+
+			mock.ExpectQuery(`SELECT lender_id, borrower_id, status FROM agreements`).
+				WillReturnRows(sqlmock.NewRows(reviewAgreementColumns).AddRow(1, 2, tt.status))
+
+			rec := postReview(h, tt.userID, tt.body)
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestReviewListForUser(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewReviewHandler(db)
+
+	mock.ExpectQuery(`FROM reviews rv\s+JOIN users u ON u.id = rv.reviewer_id\s+WHERE rv.reviewee_id = \$1 AND rv.status = 'published'`).
+		WithArgs(int64(1), defaultPageLimit, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "agreement_id", "reviewer_id", "reviewer_name", "reviewee_id", "rating", "comment", "created_at"}).
+			AddRow(10, 3, 2, "Dana", 1, 5, "Great lender", time.Now()))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/1/reviews", nil)
+	req.SetPathValue("id", "1")
+	rec := httptest.NewRecorder()
+	h.ListForUser(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"reviewer_name":"Dana"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviewReport(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewReviewHandler(db)
+
+	mock.ExpectQuery(`SELECT reviewer_id FROM reviews WHERE id = \$1 AND status = 'published'`).
+		WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"reviewer_id"}).AddRow(2))
+	mock.ExpectExec(`INSERT INTO review_reports`).
+		WithArgs(int64(10), int64(1), "insults").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/reviews/10/report", strings.NewReader(`{"reason":"insults"}`))
+	req.SetPathValue("id", "10")
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.Report(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviewReport_OwnReview(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewReviewHandler(db)
+
+	mock.ExpectQuery(`SELECT reviewer_id FROM reviews`).
+		WillReturnRows(sqlmock.NewRows([]string{"reviewer_id"}).AddRow(1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/reviews/10/report", strings.NewReader(`{"reason":"oops"}`))
+	req.SetPathValue("id", "10")
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.Report(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
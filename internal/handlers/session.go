@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+type SessionHandler struct {
+	DB *sqlx.DB
+}
+
+func NewSessionHandler(db *sqlx.DB) *SessionHandler {
+	return &SessionHandler{DB: db}
+}
+
+// List returns the user's active sessions, most recently used first.
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+	currentID := caller.SessionID
+
+	sessions := make([]models.Session, 0)
+	err := h.DB.Select(&sessions, `
+		SELECT id, user_id, device, ip, user_agent, created_at, last_used_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch sessions", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	utils.WriteJSON(w, sessions, http.StatusOK)
+}
+
+// Revoke logs out a single session of the current user.
+func (h *SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	res, err := h.DB.Exec(`
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		utils.WriteJSONError(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAll logs the current user out everywhere, including this session.
+func (h *SessionHandler) RevokeAll(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	_, err := h.DB.Exec(
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
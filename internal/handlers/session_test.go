@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// List
+func TestSessionHandler_List_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewSessionHandler(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/me/sessions", nil)
+	req = principal.WithRequest(req, principal.Principal{UserID: 1, SessionID: 4})
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "user_id", "device", "ip", "user_agent", "created_at", "last_used_at", "revoked_at"}).
+		AddRow(4, 1, "Pixel 8", "10.0.0.1", "okhttp/4.12", now, now, nil).
+		AddRow(2, 1, "", "10.0.0.2", "Mozilla/5.0", now, now.Add(-time.Hour), nil)
+
+	mock.ExpectQuery(`SELECT .* FROM sessions WHERE user_id = \$1 AND revoked_at IS NULL`).
+		WithArgs(int64(1)).
+		WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	h.List(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var sessions []models.Session
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&sessions))
+	require.Len(t, sessions, 2)
+	require.True(t, sessions[0].Current)
+	require.False(t, sessions[1].Current)
+	require.Equal(t, "Pixel 8", sessions[0].Device)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionHandler_List_DBError(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewSessionHandler(db)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/me/sessions", nil)
+	req = asUser(req, 1)
+
+	mock.ExpectQuery(`SELECT .* FROM sessions`).
+		WillReturnError(sql.ErrConnDone)
+
+	rec := httptest.NewRecorder()
+	h.List(rec, req)
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Revoke
+func TestSessionHandler_Revoke_NotFound(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewSessionHandler(db)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/me/sessions/8", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "8")
+
+	// session 8 belongs to someone else, so nothing is updated
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("8", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rec := httptest.NewRecorder()
+	h.Revoke(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.Contains(t, rec.Body.String(), "session not found")
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionHandler_Revoke_Success(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewSessionHandler(db)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/me/sessions/2", nil)
+	req = asUser(req, 1)
+	req.SetPathValue("id", "2")
+
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE id = \$1 AND user_id = \$2`).
+		WithArgs("2", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := httptest.NewRecorder()
+	h.Revoke(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// RevokeAll
+func TestSessionHandler_RevokeAll(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewSessionHandler(db)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/me/sessions", nil)
+	req = asUser(req, 1)
+
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE user_id = \$1`).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	rec := httptest.NewRecorder()
+	h.RevokeAll(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
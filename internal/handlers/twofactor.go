@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/totp"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+)
+
+var errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+
+type TwoFactorHandler struct {
+	DB  *sqlx.DB
+	Cfg *config.Config
+}
+
+func NewTwoFactorHandler(db *sqlx.DB, cfg *config.Config) *TwoFactorHandler {
+	return &TwoFactorHandler{DB: db, Cfg: cfg}
+}
+
+// Setup generates a new TOTP secret for the user. It only takes effect once
+// confirmed with a valid code through Enable.
+func (h *TwoFactorHandler) Setup(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	var user struct {
+		Email         string     `db:"email"`
+		TOTPEnabledAt *time.Time `db:"totp_enabled_at"`
+	}
+	if err := h.DB.Get(&user, "SELECT email, totp_enabled_at FROM users WHERE id = $1", userID); err != nil {
+		utils.WriteJSONError(w, "failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		utils.WriteJSONError(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.DB.Exec("UPDATE users SET totp_secret = $1 WHERE id = $2", secret, userID); err != nil {
+		utils.WriteJSONError(w, "failed to save secret", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, map[string]string{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(h.Cfg.TOTPIssuer, user.Email, secret),
+	}, http.StatusOK)
+}
+
+// Enable confirms the secret from Setup with a code from the authenticator
+// app and returns a fresh set of recovery codes. They are shown only once.
+func (h *TwoFactorHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var user struct {
+		Secret        *string    `db:"totp_secret"`
+		TOTPEnabledAt *time.Time `db:"totp_enabled_at"`
+	}
+	err = tx.Get(&user, "SELECT totp_secret, totp_enabled_at FROM users WHERE id = $1 FOR UPDATE", userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		utils.WriteJSONError(w, "two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.Secret == nil {
+		utils.WriteJSONError(w, "call setup first", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := totp.Validate(*user.Secret, code, time.Now())
+	if !ok {
+		utils.WriteJSONError(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1 WHERE id = $2", step, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, map[string][]string{"recovery_codes": codes}, http.StatusOK)
+}
+
+// Disable turns two-factor authentication off. It requires a current TOTP
+// code or a recovery code.
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	h.withSecondFactor(w, userID, code, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, totp_failed_attempts = 0
+			WHERE id = $1
+		`, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID)
+		return err
+	}, func() {
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// RegenerateRecoveryCodes invalidates all existing recovery codes and
+// returns a new set.
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	var codes []string
+	h.withSecondFactor(w, userID, code, func(tx *sqlx.Tx) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	}, func() {
+		utils.WriteJSON(w, map[string][]string{"recovery_codes": codes}, http.StatusOK)
+	})
+}
+
+// withSecondFactor verifies code and runs fn in the same transaction, so a
+// recovery code is only spent when the change goes through. Wrong codes are
+// counted like those for agreements.
+func (h *TwoFactorHandler) withSecondFactor(w http.ResponseWriter, userID int64, code string, fn func(tx *sqlx.Tx) error, done func()) {
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	ok, err := verifyCountedSecondFactor(tx, userID, code)
+	if errors.Is(err, errTwoFactorLocked) {
+		utils.WriteJSONErrorCode(w, err.Error(), "two_factor_locked", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errTwoFactorNotEnabled) {
+		utils.WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		utils.WriteJSONError(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	if err := fn(tx); err != nil {
+		utils.WriteJSONError(w, "failed to update two-factor settings", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to update two-factor settings", http.StatusInternalServerError)
+		return
+	}
+
+	done()
+}
+
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return "", false
+	}
+
+	input.Code = strings.TrimSpace(input.Code)
+	if input.Code == "" {
+		utils.WriteJSONError(w, "code is required", http.StatusBadRequest)
+		return "", false
+	}
+
+	return input.Code, true
+}
+
+// verifySecondFactor checks a TOTP code or, failing the TOTP shape, a
+// recovery code for the user. Each TOTP code and each recovery code is
+// accepted only once. It returns errTwoFactorNotEnabled for users without
+// two-factor authentication.
+func verifySecondFactor(tx *sqlx.Tx, userID int64, code string) (bool, error) {
+	var user struct {
+		Secret   string `db:"totp_secret"`
+		LastStep int64  `db:"totp_last_step"`
+	}
+	err := tx.Get(&user, `
+		SELECT totp_secret, totp_last_step FROM users
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL
+		FOR UPDATE
+	`, userID)
+	if err == sql.ErrNoRows {
+		return false, errTwoFactorNotEnabled
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if totp.IsCode(code) {
+		step, ok := totp.Validate(user.Secret, code, time.Now())
+		if !ok || step <= user.LastStep {
+			return false, nil
+		}
+		_, err := tx.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2", step, userID)
+		return err == nil, err
+	}
+
+	res, err := tx.Exec(`
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, utils.HashToken(totp.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores the
+// hashes of a new set, returning the plain codes.
+func replaceRecoveryCodes(tx *sqlx.Tx, userID int64) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes(totp.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+	for _, c := range codes {
+		_, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, utils.HashToken(c))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// maxSecondFactorAttempts bounds how many codes can be guessed for
+// agreements and two-factor settings before the user has to log in again,
+// like maxLoginChallengeAttempts does for a login.
+const maxSecondFactorAttempts = maxLoginChallengeAttempts
+
+var errTwoFactorLocked = errors.New("too many invalid two-factor codes, log in again")
+
+// verifyCountedSecondFactor is verifySecondFactor under the attempt cap: it
+// returns errTwoFactorLocked once maxSecondFactorAttempts codes were wrong.
+// A wrong code is counted by committing tx, which therefore must not hold
+// any other change yet; a missing code is not counted. A correct code
+// resets the count in tx.
+func verifyCountedSecondFactor(tx *sqlx.Tx, userID int64, code string) (bool, error) {
+	var attempts int
+	if err := tx.Get(&attempts, "SELECT totp_failed_attempts FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return false, err
+	}
+	if attempts >= maxSecondFactorAttempts {
+		return false, errTwoFactorLocked
+	}
+
+	ok, err := verifySecondFactor(tx, userID, code)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		if code == "" {
+			return false, nil
+		}
+		_, err := tx.Exec("UPDATE users SET totp_failed_attempts = totp_failed_attempts + 1 WHERE id = $1", userID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		return false, err
+	}
+
+	if attempts > 0 {
+		if _, err := tx.Exec("UPDATE users SET totp_failed_attempts = 0 WHERE id = $1", userID); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// requireSecondFactor enforces Cfg.TwoFactorAgreementThreshold: agreements
+// with a principal above it need a fresh code in the X-Two-Factor-Code
+// header. The code is consumed in tx, so it stays valid if the agreement
+// change fails; see verifyCountedSecondFactor for how wrong codes are
+// counted. It writes the error response and returns false when the check
+// fails.
+func requireSecondFactor(w http.ResponseWriter, r *http.Request, tx *sqlx.Tx, cfg *config.Config, userID int64, amount float64) bool {
+	if cfg.TwoFactorAgreementThreshold <= 0 || amount <= cfg.TwoFactorAgreementThreshold {
+		return true
+	}
+
+	code := strings.TrimSpace(r.Header.Get("X-Two-Factor-Code"))
+
+	ok, err := verifyCountedSecondFactor(tx, userID, code)
+	switch {
+	case errors.Is(err, errTwoFactorLocked):
+		utils.WriteJSONErrorCode(w, err.Error(), "two_factor_locked", http.StatusForbidden)
+		return false
+	case errors.Is(err, errTwoFactorNotEnabled):
+		utils.WriteJSONErrorCode(w, "enable two-factor authentication for agreements of this amount", "two_factor_setup_required", http.StatusForbidden)
+		return false
+	case err != nil:
+		utils.WriteJSONError(w, "failed to verify code", http.StatusInternalServerError)
+		return false
+	case code == "":
+		utils.WriteJSONErrorCode(w, "two-factor code required", "two_factor_required", http.StatusForbidden)
+		return false
+	case !ok:
+		utils.WriteJSONErrorCode(w, "invalid two-factor code", "two_factor_invalid", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/totp"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorHandler_Setup(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewTwoFactorHandler(db, &config.Config{TOTPIssuer: "Uade"})
+
+	mock.ExpectQuery(`SELECT email, totp_enabled_at FROM users`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "totp_enabled_at"}).AddRow("user@example.com", nil))
+	mock.ExpectExec(`UPDATE users SET totp_secret = \$1`).
+		WithArgs(sqlmock.AnyArg(), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/2fa/setup", nil)
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.Setup(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp map[string]string
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.NotEmpty(t, resp["secret"])
+	require.True(t, strings.HasPrefix(resp["provisioning_uri"], "otpauth://totp/Uade:user@example.com?"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorHandler_Setup_AlreadyEnabled(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewTwoFactorHandler(db, &config.Config{TOTPIssuer: "Uade"})
+
+	mock.ExpectQuery(`SELECT email, totp_enabled_at FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "totp_enabled_at"}).AddRow("user@example.com", time.Now()))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/2fa/setup", nil)
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.Setup(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorHandler_Enable(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewTwoFactorHandler(db, &config.Config{})
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	code, err := totp.CodeAt(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT totp_secret, totp_enabled_at FROM users`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled_at"}).AddRow(secret, nil))
+	mock.ExpectExec(`UPDATE users SET totp_enabled_at = NOW\(\)`).
+		WithArgs(totp.Step(time.Now()), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM recovery_codes`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	for range totp.RecoveryCodeCount {
+		mock.ExpectExec(`INSERT INTO recovery_codes`).
+			WithArgs(int64(4), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/2fa/enable", strings.NewReader(`{"code":"`+code+`"}`))
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.Enable(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp map[string][]string
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp["recovery_codes"], totp.RecoveryCodeCount)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorHandler_Enable_InvalidCode(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewTwoFactorHandler(db, &config.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT totp_secret, totp_enabled_at FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_enabled_at"}).AddRow("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", nil))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/2fa/enable", strings.NewReader(`{"code":"000000"}`))
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.Enable(rec, req)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorHandler_Disable_RecoveryCode(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewTwoFactorHandler(db, &config.Config{})
+
+	mock.ExpectBegin()
+	expectSecondFactorAttempts(mock, 0)
+	mock.ExpectQuery(`SELECT totp_secret, totp_last_step FROM users`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_last_step"}).AddRow("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 0))
+	mock.ExpectExec(`UPDATE recovery_codes SET used_at`).
+		WithArgs(int64(4), utils.HashToken("abcde-fghij")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET totp_secret = NULL`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM recovery_codes`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 9))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/2fa/disable", strings.NewReader(`{"code":"ABCDEFGHIJ"}`))
+	req = asUser(req, 4)
+	rec := httptest.NewRecorder()
+	h.Disable(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorHandler_Disable_LockedAfterInvalidCodes(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewTwoFactorHandler(db, &config.Config{})
+
+	for attempts := 0; attempts <= maxSecondFactorAttempts; attempts++ {
+		mock.ExpectBegin()
+		expectSecondFactorAttempts(mock, attempts)
+		if attempts == maxSecondFactorAttempts {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectQuery(`SELECT totp_secret, totp_last_step FROM users`).
+				WithArgs(int64(4)).
+				WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_last_step"}).AddRow("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", 0))
+			mock.ExpectExec(`UPDATE recovery_codes SET used_at`).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`UPDATE users SET totp_failed_attempts = totp_failed_attempts \+ 1 WHERE id = \$1`).
+				WithArgs(int64(4)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/users/me/2fa/disable", strings.NewReader(`{"code":"WRONG-GUESS"}`))
+		req = asUser(req, 4)
+		rec := httptest.NewRecorder()
+		h.Disable(rec, req)
+
+		if attempts == maxSecondFactorAttempts {
+			require.Equal(t, http.StatusForbidden, rec.Code)
+			require.Contains(t, rec.Body.String(), `"code":"two_factor_locked"`)
+		} else {
+			require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectSecondFactorAttempts expects the locked lookup of the user's failed
+// second factor attempts.
+func expectSecondFactorAttempts(mock sqlmock.Sqlmock, attempts int) {
+	mock.ExpectQuery(`SELECT totp_failed_attempts FROM users WHERE id = \$1 FOR UPDATE`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_failed_attempts"}).AddRow(attempts))
+}
+
+// beginSecondFactor opens a transaction for requireSecondFactor, expecting
+// the lookup of the user's failed attempts.
+func beginSecondFactor(t *testing.T, db *sqlx.DB, mock sqlmock.Sqlmock, attempts int) *sqlx.Tx {
+	mock.ExpectBegin()
+	expectSecondFactorAttempts(mock, attempts)
+	tx, err := db.Beginx()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = tx.Rollback() })
+	return tx
+}
+
+func TestRequireSecondFactor_AboveThreshold(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	cfg := &config.Config{TwoFactorAgreementThreshold: 500000}
+
+	// below the threshold nothing is checked
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements", nil)
+	require.True(t, requireSecondFactor(rec, req, nil, cfg, 4, 100000))
+
+	tx := beginSecondFactor(t, db, mock, 0)
+	mock.ExpectQuery(`SELECT totp_secret, totp_last_step FROM users`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_last_step"}))
+
+	rec = httptest.NewRecorder()
+	require.False(t, requireSecondFactor(rec, req, tx, cfg, 4, 1000000))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"two_factor_setup_required"`)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireSecondFactor_ValidCodeConsumedInTx(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	cfg := &config.Config{TwoFactorAgreementThreshold: 500000}
+
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	code, err := totp.CodeAt(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+
+	tx := beginSecondFactor(t, db, mock, 2)
+	mock.ExpectQuery(`SELECT totp_secret, totp_last_step FROM users`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_last_step"}).AddRow(secret, 0))
+	mock.ExpectExec(`UPDATE users SET totp_last_step`).
+		WithArgs(totp.Step(time.Now()), int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE users SET totp_failed_attempts = 0`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements", nil)
+	req.Header.Set("X-Two-Factor-Code", code)
+	rec := httptest.NewRecorder()
+	require.True(t, requireSecondFactor(rec, req, tx, cfg, 4, 1000000))
+
+	// nothing is committed, the code is used up together with the agreement
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireSecondFactor_InvalidCodeCounted(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	cfg := &config.Config{TwoFactorAgreementThreshold: 500000}
+
+	tx := beginSecondFactor(t, db, mock, 1)
+	// a last step in the future makes every code count as already used
+	mock.ExpectQuery(`SELECT totp_secret, totp_last_step FROM users`).
+		WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "totp_last_step"}).
+			AddRow("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", totp.Step(time.Now())+10))
+	mock.ExpectExec(`UPDATE users SET totp_failed_attempts = totp_failed_attempts \+ 1 WHERE id = \$1`).
+		WithArgs(int64(4)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements", nil)
+	req.Header.Set("X-Two-Factor-Code", "000000")
+	rec := httptest.NewRecorder()
+	require.False(t, requireSecondFactor(rec, req, tx, cfg, 4, 1000000))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"two_factor_invalid"`)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireSecondFactor_Locked(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	cfg := &config.Config{TwoFactorAgreementThreshold: 500000}
+
+	tx := beginSecondFactor(t, db, mock, maxSecondFactorAttempts)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/agreements", nil)
+	req.Header.Set("X-Two-Factor-Code", "123456")
+	rec := httptest.NewRecorder()
+	require.False(t, requireSecondFactor(rec, req, tx, cfg, 4, 1000000))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), `"code":"two_factor_locked"`)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
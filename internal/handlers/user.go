@@ -1,27 +1,41 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/config"
+	"github.com/railanbaigazy/uade-api/internal/mailer"
+	"github.com/railanbaigazy/uade-api/internal/utils"
 )
 
 type UserHandler struct {
-	DB *sqlx.DB
+	DB     *sqlx.DB
+	Cfg    *config.Config
+	Mailer mailer.Mailer
 }
 
-func NewUserHandler(db *sqlx.DB) *UserHandler {
-	return &UserHandler{DB: db}
+func NewUserHandler(db *sqlx.DB, cfg *config.Config, m mailer.Mailer) *UserHandler {
+	return &UserHandler{DB: db, Cfg: cfg, Mailer: m}
 }
 
 func (h *UserHandler) Profile(w http.ResponseWriter, r *http.Request) {
-	userID := r.Header.Get("X-User-ID")
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
 
 	var user models.User
 	err := h.DB.Get(&user,
-		"SELECT id, name, email, role, state, created_at FROM users WHERE id=$1", userID)
+		`SELECT id, name, email, role, state, created_at, email_verified_at, pending_email, identity_verified_at
+		 FROM users WHERE id=$1 AND deleted_at IS NULL`, caller.UserID)
 
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
@@ -33,3 +47,279 @@ func (h *UserHandler) Profile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// PublicProfile shows another user's track record: how many agreements
+// they completed or defaulted on as lender and borrower, how reliably they
+// repaid, how others rated them, and their active posts.
+func (h *UserHandler) PublicProfile(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONError(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var profile models.PublicProfile
+	err = h.DB.Get(&profile, `
+		SELECT id, name, created_at, (SELECT score FROM trust_scores WHERE user_id = users.id) AS trust_score
+		FROM users WHERE id=$1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "user not found", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	var stats struct {
+		LenderCompleted   int `db:"lender_completed"`
+		LenderDefaulted   int `db:"lender_defaulted"`
+		BorrowerCompleted int `db:"borrower_completed"`
+		BorrowerDefaulted int `db:"borrower_defaulted"`
+		BorrowerOnTime    int `db:"borrower_on_time"`
+	}
+	err = h.DB.Get(&stats, `
+		SELECT
+			COUNT(*) FILTER (WHERE lender_id = $1 AND status = 'completed') AS lender_completed,
+			COUNT(*) FILTER (WHERE lender_id = $1 AND status = 'defaulted') AS lender_defaulted,
+			COUNT(*) FILTER (WHERE borrower_id = $1 AND status = 'completed') AS borrower_completed,
+			COUNT(*) FILTER (WHERE borrower_id = $1 AND status = 'defaulted') AS borrower_defaulted,
+			COUNT(*) FILTER (
+				WHERE borrower_id = $1 AND status = 'completed' AND completed_at::date <= due_date
+			) AS borrower_on_time
+		FROM agreements
+		WHERE lender_id = $1 OR borrower_id = $1
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	profile.AsLender = models.AgreementStats{Completed: stats.LenderCompleted, Defaulted: stats.LenderDefaulted}
+	profile.AsBorrower = models.AgreementStats{Completed: stats.BorrowerCompleted, Defaulted: stats.BorrowerDefaulted}
+	if finished := stats.BorrowerCompleted + stats.BorrowerDefaulted; finished > 0 {
+		rate := float64(stats.BorrowerOnTime) / float64(finished)
+		profile.OnTimePaymentRate = &rate
+	}
+
+	err = h.DB.Get(&profile.Rating, `
+		SELECT COUNT(*) AS count, AVG(rating)::float8 AS average
+		FROM reviews
+		WHERE reviewee_id = $1 AND status = 'published'
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	profile.ActivePosts = make([]models.Post, 0)
+	err = h.DB.Select(&profile.ActivePosts, `
+		SELECT id, title, content, type, author_id, min_trust_score, created_at
+		FROM posts
+		WHERE author_id = $1 AND deleted_at IS NULL AND status = 'published'
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, profile, http.StatusOK)
+}
+
+// TrustScore returns the caller's trust score with the factors it is made
+// of. Scores are recomputed periodically by jobs.RecalculateTrustScores.
+func (h *UserHandler) TrustScore(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var score models.TrustScore
+	err := h.DB.Get(&score, "SELECT score, factors, computed_at FROM trust_scores WHERE user_id=$1", caller.UserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			utils.WriteJSONError(w, "trust score not computed yet", http.StatusNotFound)
+			return
+		}
+		utils.WriteJSONError(w, "failed to fetch trust score", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, score, http.StatusOK)
+}
+
+// UpdateProfile changes the caller's name and email. A new email needs the
+// current password and only replaces the current one once it is verified
+// through the link sent to it; until then it is returned as pending_email.
+// Sending the current email cancels a pending change.
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	var input struct {
+		Name            *string `json:"name"`
+		Email           *string `json:"email"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if input.Name == nil && input.Email == nil {
+		utils.WriteJSONError(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err := h.DB.Get(&user,
+		"SELECT id, name, email, password_hash, pending_email FROM users WHERE id=$1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		utils.WriteJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			utils.WriteJSONError(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if len(name) > 256 {
+			utils.WriteJSONError(w, "name must be at most 256 characters", http.StatusBadRequest)
+			return
+		}
+		user.Name = name
+	}
+
+	var newEmail string
+	if input.Email != nil {
+		email := strings.TrimSpace(*input.Email)
+		if _, err := mail.ParseAddress(email); err != nil || len(email) > 320 {
+			utils.WriteJSONError(w, "email is invalid", http.StatusBadRequest)
+			return
+		}
+
+		if email == user.Email {
+			user.PendingEmail = nil
+		} else {
+			// a stolen session alone must not be enough to take over the
+			// account through the password reset of a new address
+			if !utils.CheckPassword(user.PasswordHash, input.CurrentPassword) {
+				utils.WriteJSONErrorCode(w, "current password is incorrect", "invalid_password", http.StatusForbidden)
+				return
+			}
+
+			var taken bool
+			err := h.DB.Get(&taken, "SELECT EXISTS (SELECT 1 FROM users WHERE email=$1 AND id<>$2)", email, userID)
+			if err != nil {
+				utils.WriteJSONError(w, "failed to update profile", http.StatusInternalServerError)
+				return
+			}
+			if taken {
+				utils.WriteJSONError(w, "email already exists", http.StatusConflict)
+				return
+			}
+
+			user.PendingEmail = &email
+			newEmail = email
+		}
+	}
+
+	_, err = h.DB.Exec("UPDATE users SET name=$1, pending_email=$2 WHERE id=$3", user.Name, user.PendingEmail, userID)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	if newEmail != "" {
+		if err := sendVerificationEmail(r, h.DB, h.Cfg, h.Mailer, int(userID), newEmail, true); err != nil {
+			utils.WriteJSONError(w, "failed to send verification email", http.StatusInternalServerError)
+			return
+		}
+
+		err := h.Mailer.Send(r.Context(), mailer.Message{
+			To:      user.Email,
+			Subject: "Your Uade email is being changed",
+			Text: "Someone asked to change the email of your Uade account to " + newEmail + ".\n\n" +
+				"The change takes effect once the new address is confirmed. " +
+				"If this was not you, reset your password and log out of all sessions.\n",
+		})
+		if err != nil {
+			log.Printf("failed to notify user %d of email change: %v", userID, err)
+		}
+	}
+
+	h.Profile(w, r)
+}
+
+// ChangePassword sets a new password after checking the current one and
+// ends every other session of the user.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	caller, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	userID := caller.UserID
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.WriteJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if len(input.NewPassword) < 6 {
+		utils.WriteJSONError(w, "password must be at least 6 characters", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	err := h.DB.Get(&passwordHash, "SELECT password_hash FROM users WHERE id=$1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		utils.WriteJSONError(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if !utils.CheckPassword(passwordHash, input.CurrentPassword) {
+		utils.WriteJSONErrorCode(w, "current password is incorrect", "invalid_password", http.StatusForbidden)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		utils.WriteJSONError(w, "failed to change password", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("UPDATE users SET password_hash=$1 WHERE id=$2", hashedPassword, userID); err != nil {
+		utils.WriteJSONError(w, "failed to change password", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id=$1 AND id<>$2 AND revoked_at IS NULL",
+		userID, caller.SessionID,
+	)
+	if err != nil {
+		utils.WriteJSONError(w, "failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.WriteJSONError(w, "failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
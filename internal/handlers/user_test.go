@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +14,9 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/railanbaigazy/uade-api/internal/app/middleware"
 	"github.com/railanbaigazy/uade-api/internal/app/models"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
+	"github.com/railanbaigazy/uade-api/internal/principal"
+	"github.com/railanbaigazy/uade-api/internal/utils"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,18 +29,18 @@ func TestProfileHandler(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 	// Mock the SELECT query
-	rows := sqlmock.NewRows([]string{"id", "name", "email", "role", "state", "created_at"}).
-		AddRow(1, "Test User", "me@example.com", "user", "active", time.Now())
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "role", "state", "created_at", "email_verified_at"}).
+		AddRow(1, "Test User", "me@example.com", "user", "active", time.Now(), time.Now())
 
-	mock.ExpectQuery("SELECT id, name, email, role, state, created_at FROM users WHERE id=\\$1").
-		WithArgs("1").
+	mock.ExpectQuery("SELECT id, name, email, role, state, created_at, email_verified_at, pending_email, identity_verified_at FROM users WHERE id=\\$1").
+		WithArgs(int64(1)).
 		WillReturnRows(rows)
 
-	h := NewUserHandler(sqlxDB)
+	h := NewUserHandler(sqlxDB, nil, nil)
 
-	// Simulate the middleware setting X-User-ID header
+	// Simulate the middleware setting the principal
 	req := httptest.NewRequest(http.MethodGet, "/api/users/me", nil)
-	req.Header.Set("X-User-ID", "1")
+	req = asUser(req, 1)
 
 	rec := httptest.NewRecorder()
 	h.Profile(rec, req)
@@ -63,14 +67,14 @@ func TestProfileHandler_WithMiddleware(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 	// Mock the SELECT query
-	rows := sqlmock.NewRows([]string{"id", "name", "email", "role", "state", "created_at"}).
-		AddRow(42, "John Doe", "john@example.com", "user", "active", time.Now())
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "role", "state", "created_at", "email_verified_at"}).
+		AddRow(42, "John Doe", "john@example.com", "user", "active", time.Now(), time.Now())
 
-	mock.ExpectQuery("SELECT id, name, email, role, state, created_at FROM users WHERE id=\\$1").
-		WithArgs("42").
+	mock.ExpectQuery("SELECT id, name, email, role, state, created_at, email_verified_at, pending_email, identity_verified_at FROM users WHERE id=\\$1").
+		WithArgs(int64(42)).
 		WillReturnRows(rows)
 
-	h := NewUserHandler(sqlxDB)
+	h := NewUserHandler(sqlxDB, nil, nil)
 	secret := "test-secret-key"
 
 	// Create a valid JWT token
@@ -87,7 +91,7 @@ func TestProfileHandler_WithMiddleware(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer "+tokenStr)
 
 	// Wrap handler with JWT middleware
-	wrappedHandler := middleware.JWTAuth(secret, http.HandlerFunc(h.Profile))
+	wrappedHandler := middleware.JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(h.Profile))
 
 	rec := httptest.NewRecorder()
 	wrappedHandler.ServeHTTP(rec, req)
@@ -112,13 +116,13 @@ func TestProfileHandler_MissingAuth(t *testing.T) {
 	defer db.Close()
 
 	sqlxDB := sqlx.NewDb(db, "sqlmock")
-	h := NewUserHandler(sqlxDB)
+	h := NewUserHandler(sqlxDB, nil, nil)
 	secret := "test-secret"
 
 	req := httptest.NewRequest(http.MethodGet, "/api/users/me", nil)
 	// No Authorization header
 
-	wrappedHandler := middleware.JWTAuth(secret, http.HandlerFunc(h.Profile))
+	wrappedHandler := middleware.JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(h.Profile))
 
 	rec := httptest.NewRecorder()
 	wrappedHandler.ServeHTTP(rec, req)
@@ -134,13 +138,13 @@ func TestProfileHandler_InvalidToken(t *testing.T) {
 	defer db.Close()
 
 	sqlxDB := sqlx.NewDb(db, "sqlmock")
-	h := NewUserHandler(sqlxDB)
+	h := NewUserHandler(sqlxDB, nil, nil)
 	secret := "test-secret"
 
 	req := httptest.NewRequest(http.MethodGet, "/api/users/me", nil)
 	req.Header.Set("Authorization", "Bearer invalid.token.here")
 
-	wrappedHandler := middleware.JWTAuth(secret, http.HandlerFunc(h.Profile))
+	wrappedHandler := middleware.JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(h.Profile))
 
 	rec := httptest.NewRecorder()
 	wrappedHandler.ServeHTTP(rec, req)
@@ -158,11 +162,11 @@ func TestProfileHandler_UserNotFound(t *testing.T) {
 	sqlxDB := sqlx.NewDb(db, "sqlmock")
 
 	// Mock query returns no rows
-	mock.ExpectQuery("SELECT id, name, email, role, state, created_at FROM users WHERE id=\\$1").
+	mock.ExpectQuery("SELECT id, name, email, role, state, created_at, email_verified_at, pending_email, identity_verified_at FROM users WHERE id=\\$1").
 		WithArgs("999").
 		WillReturnError(sql.ErrNoRows)
 
-	h := NewUserHandler(sqlxDB)
+	h := NewUserHandler(sqlxDB, nil, nil)
 	secret := "test-secret"
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
@@ -174,7 +178,7 @@ func TestProfileHandler_UserNotFound(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/api/users/me", nil)
 	req.Header.Set("Authorization", "Bearer "+tokenStr)
 
-	wrappedHandler := middleware.JWTAuth(secret, http.HandlerFunc(h.Profile))
+	wrappedHandler := middleware.JWTAuth(jwtkeys.NewHMAC(secret), nil, nil, http.HandlerFunc(h.Profile))
 
 	rec := httptest.NewRecorder()
 	wrappedHandler.ServeHTTP(rec, req)
@@ -182,3 +186,290 @@ func TestProfileHandler_UserNotFound(t *testing.T) {
 	require.Equal(t, http.StatusNotFound, rec.Code)
 	require.Contains(t, rec.Body.String(), "User not found")
 }
+
+var profileColumns = []string{"id", "name", "email", "role", "state", "created_at", "email_verified_at", "pending_email"}
+
+func expectUserForUpdate(t *testing.T, mock sqlmock.Sqlmock, password string) {
+	hash, err := utils.HashPassword(password)
+	require.NoError(t, err)
+	mock.ExpectQuery(`SELECT id, name, email, password_hash, pending_email FROM users`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password_hash", "pending_email"}).
+			AddRow(1, "Old Name", "old@example.com", hash, nil))
+}
+
+func TestUpdateProfile_Name(t *testing.T) {
+	auth, mock, m := newAuthTestHandler(t, nil)
+	h := NewUserHandler(auth.DB, auth.Cfg, auth.Mailer)
+
+	expectUserForUpdate(t, mock, "secret1")
+	mock.ExpectExec(`UPDATE users SET name=\$1, pending_email=\$2 WHERE id=\$3`).
+		WithArgs("New Name", nil, int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT id, name, email, role, state, created_at, email_verified_at, pending_email, identity_verified_at FROM users`).
+		WillReturnRows(sqlmock.NewRows(profileColumns).AddRow(1, "New Name", "old@example.com", "user", "active", time.Now(), time.Now(), nil))
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(`{"name":"  New Name "}`))
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.UpdateProfile(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), "New Name")
+	require.Empty(t, m.Sent())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfile_EmailNeedsVerification(t *testing.T) {
+	auth, mock, m := newAuthTestHandler(t, nil)
+	h := NewUserHandler(auth.DB, auth.Cfg, auth.Mailer)
+
+	expectUserForUpdate(t, mock, "secret1")
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("new@example.com", int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`UPDATE users SET name=\$1, pending_email=\$2`).
+		WithArgs("Old Name", "new@example.com", int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO email_verification_tokens`).
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), "new@example.com").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT id, name, email, role, state, created_at, email_verified_at, pending_email, identity_verified_at FROM users`).
+		WillReturnRows(sqlmock.NewRows(profileColumns).AddRow(1, "Old Name", "old@example.com", "user", "active", time.Now(), time.Now(), "new@example.com"))
+
+	body := `{"email":"new@example.com","current_password":"secret1"}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(body))
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.UpdateProfile(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var user models.User
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&user))
+	require.Equal(t, "old@example.com", user.Email)
+	require.Equal(t, "new@example.com", *user.PendingEmail)
+
+	sent := m.Sent()
+	require.Len(t, sent, 2)
+	require.Equal(t, "new@example.com", sent[0].To)
+	require.Contains(t, sent[0].Text, "/verify-email?token=")
+	require.Equal(t, "old@example.com", sent[1].To)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfile_EmailWrongPassword(t *testing.T) {
+	auth, mock, m := newAuthTestHandler(t, nil)
+	h := NewUserHandler(auth.DB, auth.Cfg, auth.Mailer)
+
+	expectUserForUpdate(t, mock, "secret1")
+
+	body := `{"email":"new@example.com","current_password":"wrong"}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(body))
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.UpdateProfile(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "invalid_password")
+	require.Empty(t, m.Sent())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfile_EmailTaken(t *testing.T) {
+	auth, mock, _ := newAuthTestHandler(t, nil)
+	h := NewUserHandler(auth.DB, auth.Cfg, auth.Mailer)
+
+	expectUserForUpdate(t, mock, "secret1")
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	body := `{"email":"taken@example.com","current_password":"secret1"}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(body))
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.UpdateProfile(rec, req)
+
+	require.Equal(t, http.StatusConflict, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateProfile_Validation(t *testing.T) {
+	auth, _, _ := newAuthTestHandler(t, nil)
+	h := NewUserHandler(auth.DB, auth.Cfg, auth.Mailer)
+
+	for _, body := range []string{`{}`, `not json`} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/users/me", strings.NewReader(body))
+		req = asUser(req, 1)
+		rec := httptest.NewRecorder()
+		h.UpdateProfile(rec, req)
+
+		require.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	auth, mock, _ := newAuthTestHandler(t, nil)
+	h := NewUserHandler(auth.DB, auth.Cfg, auth.Mailer)
+
+	hash, err := utils.HashPassword("secret1")
+	require.NoError(t, err)
+	mock.ExpectQuery(`SELECT password_hash FROM users`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(hash))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE users SET password_hash=\$1 WHERE id=\$2`).
+		WithArgs(sqlmock.AnyArg(), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE sessions SET revoked_at = NOW\(\) WHERE user_id=\$1 AND id<>\$2`).
+		WithArgs(int64(1), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	body := `{"current_password":"secret1","new_password":"secret2"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/password", strings.NewReader(body))
+	req = principal.WithRequest(req, principal.Principal{UserID: 1, SessionID: 7})
+	rec := httptest.NewRecorder()
+	h.ChangePassword(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangePassword_WrongCurrentPassword(t *testing.T) {
+	auth, mock, _ := newAuthTestHandler(t, nil)
+	h := NewUserHandler(auth.DB, auth.Cfg, auth.Mailer)
+
+	hash, err := utils.HashPassword("secret1")
+	require.NoError(t, err)
+	mock.ExpectQuery(`SELECT password_hash FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(hash))
+
+	body := `{"current_password":"wrong","new_password":"secret2"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/users/me/password", strings.NewReader(body))
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.ChangePassword(rec, req)
+
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicProfile(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewUserHandler(db, nil, nil)
+
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, name, created_at, .* AS trust_score FROM users WHERE id=\$1 AND deleted_at IS NULL`).
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at", "trust_score"}).AddRow(5, "Aigerim", since, 72))
+	mock.ExpectQuery(`FROM agreements`).
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"lender_completed", "lender_defaulted", "borrower_completed", "borrower_defaulted", "borrower_on_time"}).
+			AddRow(4, 1, 3, 1, 2))
+	mock.ExpectQuery(`FROM reviews`).
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "average"}).AddRow(2, 4.5))
+	mock.ExpectQuery(`SELECT id, title, content, type, author_id, min_trust_score, created_at FROM posts`).
+		WithArgs(int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "content", "type", "author_id", "created_at"}).
+			AddRow(9, "Lending 100k", "Short term", "lend", 5, time.Now()))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/5", nil)
+	req.SetPathValue("id", "5")
+	req = asUser(req, 1)
+	rec := httptest.NewRecorder()
+	h.PublicProfile(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, "Aigerim", body["name"])
+	require.Equal(t, map[string]any{"completed": 4.0, "defaulted": 1.0}, body["as_lender"])
+	require.Equal(t, map[string]any{"completed": 3.0, "defaulted": 1.0}, body["as_borrower"])
+	require.Equal(t, 0.5, body["on_time_payment_rate"])
+	require.Equal(t, 72.0, body["trust_score"])
+	require.Equal(t, map[string]any{"average": 4.5, "count": 2.0}, body["rating"])
+	require.Len(t, body["active_posts"], 1)
+	for _, private := range []string{"email", "state", "role", "pending_email"} {
+		require.NotContains(t, body, private)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublicProfile_NoFinishedLoans(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewUserHandler(db, nil, nil)
+
+	mock.ExpectQuery(`SELECT id, name, created_at, .* FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(5, "Aigerim", time.Now()))
+	mock.ExpectQuery(`FROM agreements`).
+		WillReturnRows(sqlmock.NewRows([]string{"lender_completed", "lender_defaulted", "borrower_completed", "borrower_defaulted", "borrower_on_time"}).
+			AddRow(0, 0, 0, 0, 0))
+	mock.ExpectQuery(`FROM reviews`).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "average"}).AddRow(0, nil))
+	mock.ExpectQuery(`FROM posts`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "content", "type", "author_id", "created_at"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/5", nil)
+	req.SetPathValue("id", "5")
+	rec := httptest.NewRecorder()
+	h.PublicProfile(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"on_time_payment_rate":null`)
+	require.Contains(t, rec.Body.String(), `"rating":{"average":null,"count":0}`)
+	require.Contains(t, rec.Body.String(), `"active_posts":[]`)
+}
+
+func TestPublicProfile_NotFound(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewUserHandler(db, nil, nil)
+
+	mock.ExpectQuery(`SELECT id, name, created_at, .* FROM users`).
+		WithArgs(int64(404)).
+		WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/404", nil)
+	req.SetPathValue("id", "404")
+	rec := httptest.NewRecorder()
+	h.PublicProfile(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrustScore(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewUserHandler(db, nil, nil)
+
+	mock.ExpectQuery(`SELECT score, factors, computed_at FROM trust_scores WHERE user_id=\$1`).
+		WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"score", "factors", "computed_at"}).
+			AddRow(55, []byte(`[{"name":"base","points":30,"max":30,"detail":"starting score"}]`), time.Now()))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/users/me/trust-score", nil), 3)
+	rec := httptest.NewRecorder()
+	h.TrustScore(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"score":55`)
+	require.Contains(t, rec.Body.String(), `"factors":[{"name":"base"`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrustScore_NotComputed(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	h := NewUserHandler(db, nil, nil)
+
+	mock.ExpectQuery(`FROM trust_scores`).
+		WithArgs(int64(3)).
+		WillReturnError(sql.ErrNoRows)
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/api/users/me/trust-score", nil), 3)
+	rec := httptest.NewRecorder()
+	h.TrustScore(rec, req)
+
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
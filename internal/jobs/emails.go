@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/mailer"
+	"github.com/railanbaigazy/uade-api/internal/notify"
+)
+
+const (
+	emailBatchSize = 100
+	// emailSendTimeout bounds a single send. A claimed batch is leased for
+	// as long as sending all of it may take; rows a crashed replica did not
+	// get to are picked up again once the lease runs out.
+	emailSendTimeout = 30 * time.Second
+	emailClaimLease  = emailBatchSize * emailSendTimeout
+	// maxEmailAttempts is how often a notification email is tried before
+	// it is given up; with the backoff below that spans about eight hours.
+	maxEmailAttempts = 10
+	maxEmailBackoff  = 6 * time.Hour
+)
+
+type queuedEmail struct {
+	ID          int64           `db:"id"`
+	Type        string          `db:"type"`
+	AgreementID *int64          `db:"agreement_id"`
+	Data        json.RawMessage `db:"data"`
+	Attempts    int             `db:"attempts"`
+	Name        string          `db:"name"`
+	Email       string          `db:"email"`
+	Locale      string          `db:"locale"`
+}
+
+// emailBackoff is the wait after the given number of failed attempts:
+// a minute, doubling up to maxEmailBackoff.
+func emailBackoff(attempts int) time.Duration {
+	return min(time.Minute<<(attempts-1), maxEmailBackoff)
+}
+
+// SendQueuedEmails renders and sends the notification emails that are due.
+// Failed sends are retried with backoff, up to maxEmailAttempts. The batch
+// is claimed up front by counting the attempt and pushing next_attempt_at
+// past the lease, so replicas running the job concurrently do not send the
+// same email twice and no transaction is held open while sending.
+func SendQueuedEmails(ctx context.Context, db *sqlx.DB, m mailer.Mailer, appURL string) error {
+	var queued []queuedEmail
+	err := db.SelectContext(ctx, &queued, `
+		UPDATE email_outbox o
+		SET attempts = o.attempts + 1, next_attempt_at = $2
+		FROM users u
+		WHERE u.id = o.user_id AND o.id IN (
+		    SELECT id FROM email_outbox
+		    WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+		    ORDER BY next_attempt_at
+		    LIMIT $1
+		    FOR UPDATE SKIP LOCKED
+		)
+		RETURNING o.id, o.type, o.agreement_id, o.data, o.attempts, u.name, u.email, u.locale
+	`, emailBatchSize, time.Now().Add(emailClaimLease))
+	if err != nil {
+		return err
+	}
+
+	sent, failed := 0, 0
+	for _, q := range queued {
+		err := sendQueuedEmail(ctx, m, appURL, q)
+		if err == nil {
+			sent++
+			_, err = db.ExecContext(ctx, "UPDATE email_outbox SET sent_at = NOW() WHERE id = $1", q.ID)
+			if err != nil {
+				log.Printf("failed to record notification email %d as sent: %v", q.ID, err)
+			}
+			continue
+		}
+
+		failed++
+		if q.Attempts >= maxEmailAttempts {
+			log.Printf("giving up on notification email %d: %v", q.ID, err)
+			_, err = db.ExecContext(ctx,
+				"UPDATE email_outbox SET last_error = $2, failed_at = NOW() WHERE id = $1", q.ID, err.Error())
+		} else {
+			_, err = db.ExecContext(ctx,
+				"UPDATE email_outbox SET last_error = $2, next_attempt_at = $3 WHERE id = $1",
+				q.ID, err.Error(), time.Now().Add(emailBackoff(q.Attempts)))
+		}
+		if err != nil {
+			log.Printf("failed to record failure of notification email %d: %v", q.ID, err)
+		}
+	}
+
+	if sent+failed > 0 {
+		log.Printf("sent %d notification emails, %d failed", sent, failed)
+	}
+	return nil
+}
+
+func sendQueuedEmail(ctx context.Context, m mailer.Mailer, appURL string, q queuedEmail) error {
+	var data map[string]any
+	if err := json.Unmarshal(q.Data, &data); err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(appURL, "/") + "/notifications"
+	if q.AgreementID != nil {
+		link = fmt.Sprintf("%s/agreements/%d", strings.TrimRight(appURL, "/"), *q.AgreementID)
+	}
+
+	msg, err := notify.RenderEmail(q.Locale, q.Type, notify.EmailData{Name: q.Name, Link: link, Data: data})
+	if err != nil {
+		return err
+	}
+	msg.To = q.Email
+
+	ctx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	defer cancel()
+	return m.Send(ctx, msg)
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/mailer"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyMailer fails for one recipient and delivers everything else.
+type flakyMailer struct {
+	*mailer.MemoryMailer
+	failTo string
+}
+
+func (m flakyMailer) Send(ctx context.Context, msg mailer.Message) error {
+	if msg.To == m.failTo {
+		return errors.New("421 try again later")
+	}
+	return m.MemoryMailer.Send(ctx, msg)
+}
+
+// afterArg matches times later than a minimum.
+type afterArg struct{ min time.Time }
+
+func (a afterArg) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	return ok && t.After(a.min)
+}
+
+func TestSendQueuedEmails(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	m := flakyMailer{MemoryMailer: mailer.NewMemoryMailer(), failTo: "down@example.com"}
+
+	mock.ExpectQuery(`UPDATE email_outbox o\s+SET attempts = o.attempts \+ 1, next_attempt_at = \$2\s+FROM users u.* FOR UPDATE SKIP LOCKED\s+\)\s+RETURNING`).
+		WithArgs(emailBatchSize, afterArg{time.Now().Add(emailClaimLease - time.Minute)}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "agreement_id", "data", "attempts", "name", "email", "locale"}).
+			AddRow(1, "agreement_accepted", 9, []byte(`{}`), 1, "Aida", "aida@example.com", "ru").
+			AddRow(2, "identity_approved", nil, []byte(`{}`), 1, "Marat", "down@example.com", "en").
+			AddRow(3, "identity_approved", nil, []byte(`{}`), maxEmailAttempts, "Marat", "down@example.com", "en"))
+	mock.ExpectExec(`UPDATE email_outbox SET sent_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE email_outbox SET last_error = \$2, next_attempt_at = \$3 WHERE id = \$1`).
+		WithArgs(int64(2), "421 try again later", afterArg{time.Now().Add(59 * time.Second)}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE email_outbox SET last_error = \$2, failed_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(int64(3), "421 try again later").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, SendQueuedEmails(context.Background(), db, m, "https://uade.kz/"))
+
+	sent := m.Sent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "aida@example.com", sent[0].To)
+	require.Equal(t, "Ваша заявка на заём принята", sent[0].Subject)
+	require.Contains(t, sent[0].Text, "https://uade.kz/agreements/9")
+	require.Contains(t, sent[0].HTML, "Aida")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEmailBackoff(t *testing.T) {
+	require.Equal(t, time.Minute, emailBackoff(1))
+	require.Equal(t, 8*time.Minute, emailBackoff(4))
+	require.Equal(t, maxEmailBackoff, emailBackoff(maxEmailAttempts))
+}
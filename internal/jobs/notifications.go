@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/notify"
+)
+
+// SendDueReminders reminds the borrowers of active agreements due within
+// days that their repayment is coming up. Each agreement is reminded once.
+func SendDueReminders(ctx context.Context, db *sqlx.DB, days int) error {
+	var due []struct {
+		ID         int64     `db:"id"`
+		BorrowerID int64     `db:"borrower_id"`
+		DueDate    time.Time `db:"due_date"`
+		Amount     float64   `db:"total_amount"`
+		Currency   string    `db:"currency"`
+	}
+	err := db.SelectContext(ctx, &due, `
+		SELECT a.id, a.borrower_id, a.due_date, a.total_amount, a.currency
+		FROM agreements a
+		WHERE a.status = 'active' AND a.due_date <= CURRENT_DATE + $1::int
+		  AND NOT EXISTS (
+		      SELECT 1 FROM agreement_reminders r WHERE r.agreement_id = a.id AND r.kind = 'due_soon'
+		  )
+	`, days)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, a := range due {
+		ok, err := sendDueReminder(ctx, db, a.ID, notify.Event{
+			UserID:      a.BorrowerID,
+			Type:        notify.AgreementDueSoon,
+			AgreementID: &a.ID,
+			Data: map[string]any{
+				"due_date":     a.DueDate.Format("2006-01-02"),
+				"total_amount": a.Amount,
+				"currency":     a.Currency,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if ok {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("sent %d due date reminders", sent)
+	}
+	return nil
+}
+
+// sendDueReminder records the reminder of an agreement and sends it, or
+// reports false if another replica sent it first.
+func sendDueReminder(ctx context.Context, db *sqlx.DB, agreementID int64, e notify.Event) (bool, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO agreement_reminders (agreement_id, kind) VALUES ($1, 'due_soon')
+		ON CONFLICT DO NOTHING
+	`, agreementID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	if err := notify.Send(tx, e); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
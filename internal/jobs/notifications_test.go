@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendDueReminders(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	due := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`FROM agreements a\s+WHERE a.status = 'active' AND a.due_date <= CURRENT_DATE \+ \$1::int`).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "borrower_id", "due_date", "total_amount", "currency"}).
+			AddRow(5, 2, due, 1100.0, "KZT").
+			AddRow(6, 3, due, 500.0, "KZT"))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO agreement_reminders`).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO notifications`).
+		WithArgs(int64(2), "agreement_due_soon", int64(5),
+			[]byte(`{"currency":"KZT","due_date":"2026-03-02","total_amount":1100}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox`).
+		WithArgs(int64(2), "agreement_due_soon", int64(5), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// already reminded by another replica
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO agreement_reminders`).
+		WithArgs(int64(6)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	require.NoError(t, SendDueReminders(context.Background(), db, 3))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
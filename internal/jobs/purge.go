@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PurgeSoftDeleted permanently removes posts and users that were soft-deleted
+// more than retention ago. Rows still referenced by agreements are kept,
+// since agreements must outlive the posts and users they were made with, and
+// so are users who acted as admins, whom the audit log must keep naming.
+func PurgeSoftDeleted(ctx context.Context, db *sqlx.DB, retention time.Duration) error {
+	cutoff := time.Now().Add(-retention)
+
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM posts p
+		WHERE p.deleted_at < $1
+		  AND NOT EXISTS (SELECT 1 FROM agreements a WHERE a.post_id = p.id)
+	`, cutoff)
+	if err != nil {
+		return err
+	}
+	posts, _ := res.RowsAffected()
+
+	// deleting a user cascades to their posts, so skip users whose posts
+	// are referenced by agreements as well
+	res, err = db.ExecContext(ctx, `
+		DELETE FROM users u
+		WHERE u.deleted_at < $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM agreements a
+		      WHERE a.lender_id = u.id OR a.borrower_id = u.id
+		  )
+		  AND NOT EXISTS (
+		      SELECT 1 FROM agreements a
+		      JOIN posts p ON p.id = a.post_id
+		      WHERE p.author_id = u.id
+		  )
+		  AND NOT EXISTS (SELECT 1 FROM admin_audit_log l WHERE l.admin_id = u.id)
+	`, cutoff)
+	if err != nil {
+		return err
+	}
+	users, _ := res.RowsAffected()
+
+	if posts > 0 || users > 0 {
+		log.Printf("purged %d posts and %d users deleted before %s", posts, users, cutoff.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// PurgeExpiredSessions deletes refresh tokens that expired more than a day
+// ago (used tokens are kept until then so reuse can still be detected),
+// then sessions left without any refresh token, expired two-factor login
+// challenges and unfinished OpenID Connect logins.
+func PurgeExpiredSessions(ctx context.Context, db *sqlx.DB) error {
+	_, err := db.ExecContext(ctx,
+		"DELETE FROM refresh_tokens WHERE expires_at < $1",
+		time.Now().Add(-24*time.Hour),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		DELETE FROM sessions s
+		WHERE NOT EXISTS (SELECT 1 FROM refresh_tokens rt WHERE rt.session_id = s.id)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM login_challenges WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM oidc_login_states WHERE expires_at < NOW()")
+	return err
+}
+
+// PurgeLoginThrottle forgets failed login counters and unlock links that no
+// longer have any effect.
+func PurgeLoginThrottle(ctx context.Context, db *sqlx.DB, lockout time.Duration) error {
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM login_throttle
+		WHERE GREATEST(last_failed_at, locked_until) < $1
+	`, time.Now().Add(-lockout))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM account_unlock_tokens WHERE expires_at < NOW()")
+	return err
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+
+	mock.ExpectExec(`DELETE FROM posts p WHERE p.deleted_at < \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM users u WHERE u.deleted_at < \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := PurgeSoftDeleted(context.Background(), db, 30*24*time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeSoftDeleted_KeepsAuditedAdmins(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+
+	mock.ExpectExec(`DELETE FROM posts`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// admin_audit_log.admin_id restricts deletes, so a single audited admin
+	// among the deleted users would otherwise fail the whole purge
+	mock.ExpectExec(`DELETE FROM users u .* AND NOT EXISTS \(SELECT 1 FROM admin_audit_log l WHERE l.admin_id = u.id\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, PurgeSoftDeleted(context.Background(), db, time.Hour))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeSoftDeleted_PostsError(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+
+	mock.ExpectExec(`DELETE FROM posts`).
+		WillReturnError(sql.ErrConnDone)
+
+	err := PurgeSoftDeleted(context.Background(), db, time.Hour)
+	require.ErrorIs(t, err, sql.ErrConnDone)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeExpiredSessions(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+
+	mock.ExpectExec(`DELETE FROM refresh_tokens WHERE expires_at < \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`DELETE FROM sessions s WHERE NOT EXISTS`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM login_challenges WHERE expires_at < NOW\(\)`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM oidc_login_states WHERE expires_at < NOW\(\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, PurgeExpiredSessions(context.Background(), db))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeLoginThrottle(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+
+	mock.ExpectExec(`DELETE FROM login_throttle`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM account_unlock_tokens WHERE expires_at < NOW\(\)`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, PurgeLoginThrottle(context.Background(), db, 15*time.Minute))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/railanbaigazy/uade-api/internal/trust"
+)
+
+type trustInputs struct {
+	UserID           int64     `db:"id"`
+	CreatedAt        time.Time `db:"created_at"`
+	EmailVerified    bool      `db:"email_verified"`
+	IdentityVerified bool      `db:"identity_verified"`
+	FinishedLoans    int       `db:"finished_loans"`
+	OnTimeLoans      int       `db:"on_time_loans"`
+	Defaults         int       `db:"defaults"`
+	Disputes         int       `db:"disputes"`
+	TotalRepaid      float64   `db:"total_repaid"`
+}
+
+// RecalculateTrustScores recomputes the trust score of every active user
+// from their agreement history and stores it with its breakdown.
+func RecalculateTrustScores(ctx context.Context, db *sqlx.DB) error {
+	var users []trustInputs
+	err := db.SelectContext(ctx, &users, `
+		SELECT
+			u.id, u.created_at, u.email_verified_at IS NOT NULL AS email_verified,
+			u.identity_verified_at IS NOT NULL AS identity_verified,
+			COUNT(a.id) FILTER (
+				WHERE a.borrower_id = u.id AND a.status IN ('completed', 'defaulted')
+			) AS finished_loans,
+			COUNT(a.id) FILTER (
+				WHERE a.borrower_id = u.id AND a.status = 'completed' AND a.completed_at::date <= a.due_date
+			) AS on_time_loans,
+			COUNT(a.id) FILTER (WHERE a.borrower_id = u.id AND a.status = 'defaulted') AS defaults,
+			COUNT(a.id) FILTER (WHERE a.status = 'disputed') AS disputes,
+			COALESCE(SUM(a.total_amount) FILTER (
+				WHERE a.borrower_id = u.id AND a.status = 'completed'
+			), 0) AS total_repaid
+		FROM users u
+		LEFT JOIN agreements a ON a.lender_id = u.id OR a.borrower_id = u.id
+		WHERE u.deleted_at IS NULL
+		GROUP BY u.id
+	`)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, u := range users {
+		score := trust.Compute(trust.Inputs{
+			AccountAge:        now.Sub(u.CreatedAt),
+			VerificationLevel: trust.Level(u.EmailVerified, u.IdentityVerified),
+			FinishedLoans:     u.FinishedLoans,
+			OnTimeLoans:       u.OnTimeLoans,
+			Defaults:          u.Defaults,
+			Disputes:          u.Disputes,
+			TotalRepaid:       u.TotalRepaid,
+		})
+		factors, err := json.Marshal(score.Factors)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO trust_scores (user_id, score, factors, computed_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (user_id) DO UPDATE
+			SET score = EXCLUDED.score, factors = EXCLUDED.factors, computed_at = EXCLUDED.computed_at
+		`, u.UserID, score.Value, factors)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("recalculated trust scores of %d users", len(users))
+	return nil
+}
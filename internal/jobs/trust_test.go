@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/trust"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// factorsArg matches the JSON breakdown stored with a score.
+type factorsArg struct{}
+
+func (a factorsArg) Match(v driver.Value) bool {
+	var factors []trust.Factor
+	b, ok := v.([]byte)
+	return ok && json.Unmarshal(b, &factors) == nil && len(factors) > 0
+}
+
+func TestRecalculateTrustScores(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+
+	columns := []string{"id", "created_at", "email_verified", "identity_verified", "finished_loans", "on_time_loans", "defaults", "disputes", "total_repaid"}
+	mock.ExpectQuery(`FROM users u\s+LEFT JOIN agreements a`).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, time.Now(), false, false, 0, 0, 0, 0, 0).
+			AddRow(2, time.Now().AddDate(-2, 0, 0), true, false, 1, 0, 1, 0, 0).
+			AddRow(3, time.Now().AddDate(-2, 0, 0), true, true, 0, 0, 0, 0, 0))
+
+	mock.ExpectExec(`INSERT INTO trust_scores`).
+		WithArgs(int64(1), 30, factorsArg{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 30 base + 10 age + 10 email - 25 default
+	mock.ExpectExec(`INSERT INTO trust_scores`).
+		WithArgs(int64(2), 25, factorsArg{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 30 base + 10 age + 20 identity
+	mock.ExpectExec(`INSERT INTO trust_scores`).
+		WithArgs(int64(3), 60, factorsArg{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, RecalculateTrustScores(context.Background(), db))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,232 @@
+// Package jwtkeys manages the keys that sign and verify access tokens.
+//
+// Asymmetric keys (RS256 or EdDSA) are loaded from PEM files, one key per
+// file, named after their key ID (kid). Exactly one private key signs new
+// tokens; every key in the set verifies tokens carrying its kid and is
+// published through JWKS, so other services can verify tokens without being
+// able to mint them.
+//
+// Keys are read once at startup, so every step of a rotation takes a
+// restart. Rotation overlaps: add the new key file and restart (it is then
+// published but does not sign yet), switch the signing kid once verifiers
+// have picked it up, and delete the old file after the access token TTL has
+// passed. Keeping only the public half of a retired key is enough for
+// verification.
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys.
+const minRSABits = 2048
+
+// Key is a single verification key, optionally with its private half.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	sign   any
+	verify any
+}
+
+// CanSign reports whether the private half of the key is available.
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// KeySet holds the signing key and all keys accepted for verification.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewHMAC returns a key set with a single HS256 secret and no kid, which is
+// how tokens were signed before asymmetric keys were introduced.
+func NewHMAC(secret string) *KeySet {
+	k := &Key{Method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}
+	return &KeySet{signing: k, keys: map[string]*Key{"": k}}
+}
+
+// LoadDir loads every *.pem file in dir as a key named after the file and
+// signs with the private key signingKID. A non-empty legacySecret keeps
+// accepting HS256 tokens without kid, to migrate from a shared secret
+// without logging everyone out; it is never used to sign.
+func LoadDir(dir, signingKID, legacySecret string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.pem keys found in %s", dir)
+	}
+
+	ks := &KeySet{keys: make(map[string]*Key)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParsePEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ks.keys[kid] = key
+	}
+
+	signing, ok := ks.keys[signingKID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingKID, dir)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("signing key %q is a public key", signingKID)
+	}
+	ks.signing = signing
+
+	if legacySecret != "" {
+		ks.keys[""] = &Key{Method: jwt.SigningMethodHS256, verify: []byte(legacySecret)}
+	}
+
+	return ks, nil
+}
+
+// ParsePEM parses an RSA or Ed25519 key, private (PKCS#8 or PKCS#1) or
+// public (PKIX).
+func ParsePEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.sign, key.verify = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.verify = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.sign, key.verify = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.verify = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+
+	if pub, ok := key.verify.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+	}
+
+	return key, nil
+}
+
+// Sign signs claims with the signing key and records its kid in the header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.sign)
+}
+
+// Keyfunc resolves the verification key for a token by its kid. The token's
+// algorithm must match the key's, which rules out algorithm substitution.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.verify, nil
+}
+
+// Methods lists the algorithms of all keys in the set, for jwt.WithValidMethods.
+func (ks *KeySet) Methods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, k := range ks.keys {
+		if alg := k.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of the set. Symmetric keys are never
+// published.
+func (ks *KeySet) JWKS() []JWK {
+	enc := base64.RawURLEncoding
+
+	jwks := make([]JWK, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = enc.EncodeToString(pub.N.Bytes())
+			jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = enc.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
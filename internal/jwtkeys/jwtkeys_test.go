@@ -0,0 +1,217 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+func writeRSAKey(t *testing.T, dir, kid string, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	require.NoError(t, err)
+	writeKey(t, dir, kid, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	return key
+}
+
+func writeEd25519Key(t *testing.T, dir, kid string) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	writeKey(t, dir, kid, "PRIVATE KEY", der)
+	return key
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func parse(ks *KeySet, token string) error {
+	_, err := jwt.Parse(token, ks.Keyfunc, jwt.WithValidMethods(ks.Methods()))
+	return err
+}
+
+func TestLoadDir_SignsAndVerifies(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		write func(t *testing.T, dir string)
+		alg   string
+	}{
+		{"RS256", func(t *testing.T, dir string) { writeRSAKey(t, dir, "k1", 2048) }, "RS256"},
+		{"EdDSA", func(t *testing.T, dir string) { writeEd25519Key(t, dir, "k1") }, "EdDSA"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tc.write(t, dir)
+
+			ks, err := LoadDir(dir, "k1", "")
+			require.NoError(t, err)
+
+			token, err := ks.Sign(testClaims())
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			require.NoError(t, err)
+			require.Equal(t, "k1", parsed.Header["kid"])
+			require.Equal(t, tc.alg, parsed.Method.Alg())
+
+			require.NoError(t, parse(ks, token))
+		})
+	}
+}
+
+func TestLoadDir_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeRSAKey(t, dir, "2025-01", 2048)
+	writeEd25519Key(t, dir, "2025-02")
+
+	// tokens signed with the old key before the switch
+	before, err := LoadDir(dir, "2025-01", "")
+	require.NoError(t, err)
+	oldToken, err := before.Sign(testClaims())
+	require.NoError(t, err)
+
+	after, err := LoadDir(dir, "2025-02", "")
+	require.NoError(t, err)
+	newToken, err := after.Sign(testClaims())
+	require.NoError(t, err)
+
+	require.NoError(t, parse(after, oldToken))
+	require.NoError(t, parse(after, newToken))
+
+	// only the public half of the retired key remains
+	der, err := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	require.NoError(t, err)
+	writeKey(t, dir, "2025-01", "PUBLIC KEY", der)
+
+	retired, err := LoadDir(dir, "2025-02", "")
+	require.NoError(t, err)
+	require.NoError(t, parse(retired, oldToken))
+
+	// and once it is removed its tokens are rejected
+	require.NoError(t, os.Remove(filepath.Join(dir, "2025-01.pem")))
+	removed, err := LoadDir(dir, "2025-02", "")
+	require.NoError(t, err)
+	require.Error(t, parse(removed, oldToken))
+}
+
+func TestLoadDir_LegacySecret(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "k1")
+
+	legacy, err := NewHMAC("legacy").Sign(testClaims())
+	require.NoError(t, err)
+
+	ks, err := LoadDir(dir, "k1", "legacy")
+	require.NoError(t, err)
+	require.NoError(t, parse(ks, legacy))
+
+	without, err := LoadDir(dir, "k1", "")
+	require.NoError(t, err)
+	require.Error(t, parse(without, legacy))
+
+	// the legacy secret never signs and is never published
+	token, err := ks.Sign(testClaims())
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	require.Equal(t, "EdDSA", parsed.Method.Alg())
+	require.Len(t, ks.JWKS(), 1)
+}
+
+func TestLoadDir_Errors(t *testing.T) {
+	t.Run("empty dir", func(t *testing.T) {
+		_, err := LoadDir(t.TempDir(), "k1", "")
+		require.ErrorContains(t, err, "no *.pem keys")
+	})
+
+	t.Run("unknown signing key", func(t *testing.T) {
+		dir := t.TempDir()
+		writeEd25519Key(t, dir, "k1")
+		_, err := LoadDir(dir, "k2", "")
+		require.ErrorContains(t, err, `signing key "k2" not found`)
+	})
+
+	t.Run("public signing key", func(t *testing.T) {
+		dir := t.TempDir()
+		key := writeEd25519Key(t, dir, "k1")
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		require.NoError(t, err)
+		writeKey(t, dir, "k1", "PUBLIC KEY", der)
+
+		_, err = LoadDir(dir, "k1", "")
+		require.ErrorContains(t, err, "is a public key")
+	})
+
+	t.Run("short RSA key", func(t *testing.T) {
+		dir := t.TempDir()
+		writeRSAKey(t, dir, "k1", 1024)
+		_, err := LoadDir(dir, "k1", "")
+		require.ErrorContains(t, err, "at least 2048 bits")
+	})
+}
+
+func TestKeyfunc_RejectsAlgorithmSubstitution(t *testing.T) {
+	dir := t.TempDir()
+	key := writeRSAKey(t, dir, "k1", 2048)
+	ks, err := LoadDir(dir, "k1", "")
+	require.NoError(t, err)
+
+	// HS256 keyed with the published RSA public key
+	pub := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)})
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "k1"
+	token, err := forged.SignedString(pub)
+	require.NoError(t, err)
+
+	require.Error(t, parse(ks, token))
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := writeRSAKey(t, dir, "a", 2048)
+	edKey := writeEd25519Key(t, dir, "b")
+
+	ks, err := LoadDir(dir, "a", "legacy")
+	require.NoError(t, err)
+
+	jwks := ks.JWKS()
+	require.Len(t, jwks, 2)
+
+	require.Equal(t, "RSA", jwks[0].Kty)
+	require.Equal(t, "a", jwks[0].Kid)
+	require.Equal(t, "RS256", jwks[0].Alg)
+	require.Equal(t, "sig", jwks[0].Use)
+	require.Equal(t, "AQAB", jwks[0].E)
+	n, err := base64.RawURLEncoding.DecodeString(jwks[0].N)
+	require.NoError(t, err)
+	require.Equal(t, rsaKey.N.Bytes(), n)
+
+	require.Equal(t, "OKP", jwks[1].Kty)
+	require.Equal(t, "b", jwks[1].Kid)
+	require.Equal(t, "EdDSA", jwks[1].Alg)
+	require.Equal(t, "Ed25519", jwks[1].Crv)
+	x, err := base64.RawURLEncoding.DecodeString(jwks[1].X)
+	require.NoError(t, err)
+	require.Equal(t, []byte(edKey.Public().(ed25519.PublicKey)), x)
+
+	require.Empty(t, NewHMAC("secret").JWKS())
+}
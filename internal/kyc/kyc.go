@@ -0,0 +1,55 @@
+// Package kyc validates the identity data users submit for verification.
+package kyc
+
+import "time"
+
+// DocumentTypes are the identity documents accepted for verification.
+var DocumentTypes = map[string]bool{
+	"id_card":          true,
+	"passport":         true,
+	"residence_permit": true,
+}
+
+// ValidIIN reports whether s is a well-formed Kazakhstan individual
+// identification number: twelve digits starting with the birth date as
+// YYMMDD, a digit encoding century and sex, and a check digit.
+func ValidIIN(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	var d [12]int
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+		d[i] = int(c - '0')
+	}
+
+	// 1-2 for the 19th, 3-4 for the 20th and 5-6 for the 21st century,
+	// odd for men and even for women
+	if d[6] < 1 || d[6] > 6 {
+		return false
+	}
+	year := 1800 + (d[6]-1)/2*100 + d[0]*10 + d[1]
+	month := time.Month(d[2]*10 + d[3])
+	day := d[4]*10 + d[5]
+	birth := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if birth.Year() != year || birth.Month() != month || birth.Day() != day {
+		return false
+	}
+
+	check := checksum(d, [11]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11})
+	if check == 10 {
+		check = checksum(d, [11]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 1, 2})
+	}
+	// numbers whose check digit would be 10 again are never issued
+	return check != 10 && check == d[11]
+}
+
+func checksum(d [12]int, weights [11]int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += d[i] * w
+	}
+	return sum % 11
+}
@@ -0,0 +1,34 @@
+package kyc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidIIN(t *testing.T) {
+	tests := []struct {
+		iin   string
+		valid bool
+	}{
+		{"900101300007", true},
+		{"851202401230", true},
+		{"020305500113", true},
+		// check digit from the second set of weights
+		{"900101300811", true},
+
+		{"900101300008", false}, // wrong check digit
+		{"900101300080", false}, // check digit would be 10 with both weights
+		{"901301300007", false}, // month 13
+		{"900230300009", false}, // 30 February
+		{"010229500004", false}, // 29 February 2001
+		{"900101900005", false}, // unknown century digit
+		{"90010130000", false},  // too short
+		{"9001013000O7", false}, // not a digit
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.valid, ValidIIN(tt.iin), tt.iin)
+	}
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"log"
+
+	"github.com/railanbaigazy/uade-api/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	// HTML is an optional alternative to Text for clients that show it.
+	HTML string
+}
+
+// Mailer delivers a single email message.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns an SMTP mailer when SMTP_HOST is configured and a mailer that
+// only logs messages otherwise, so local development works without a server.
+func New(cfg *config.Config) Mailer {
+	if cfg.SMTPHost == "" {
+		log.Println("SMTP_HOST not set, emails will be written to the log")
+		return LogMailer{}
+	}
+	return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+}
+
+// LogMailer writes messages to the standard logger instead of sending them.
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
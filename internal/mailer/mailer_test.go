@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+
+	require.NoError(t, m.Send(context.Background(), Message{To: "a@example.com", Subject: "one"}))
+	require.NoError(t, m.Send(context.Background(), Message{To: "b@example.com", Subject: "two"}))
+
+	sent := m.Sent()
+	require.Len(t, sent, 2)
+	require.Equal(t, "a@example.com", sent[0].To)
+	require.Equal(t, "two", sent[1].Subject)
+}
+
+func TestSMTPMailer_Build(t *testing.T) {
+	m := NewSMTPMailer("smtp.example.com", "587", "", "", "Uade <no-reply@uade.kz>")
+	require.Equal(t, "smtp.example.com:587", m.Addr)
+	require.Nil(t, m.Auth)
+
+	now := time.Date(2025, 11, 26, 10, 0, 0, 0, time.UTC)
+	raw := string(m.build(Message{To: "user@example.com", Subject: "Сброс пароля", Text: "hello"}, now))
+
+	require.Contains(t, raw, "From: Uade <no-reply@uade.kz>\r\n")
+	require.Contains(t, raw, "To: user@example.com\r\n")
+	require.Contains(t, raw, "Subject: =?utf-8?q?")
+	require.Contains(t, raw, "Date: Wed, 26 Nov 2025 10:00:00 +0000\r\n")
+	require.True(t, strings.HasSuffix(raw, "\r\n\r\nhello"))
+}
+
+func TestSMTPMailer_CancelledContext(t *testing.T) {
+	m := NewSMTPMailer("127.0.0.1", "1", "", "", "no-reply@uade.kz")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.ErrorIs(t, m.Send(ctx, Message{To: "user@example.com"}), context.Canceled)
+}
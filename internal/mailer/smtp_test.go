@@ -0,0 +1,181 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type receivedMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTPServer accepts mail on a local port, speaking just enough SMTP
+// for net/smtp, and hands over every message it receives.
+type fakeSMTPServer struct {
+	ln         net.Listener
+	received   chan receivedMail
+	rejectRcpt bool
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &fakeSMTPServer{ln: ln, received: make(chan receivedMail, 1)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTPServer) mailer() *SMTPMailer {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return NewSMTPMailer(host, port, "", "", "Uade <no-reply@uade.kz>")
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost fake SMTP")
+
+	var msg receivedMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			_ = tp.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.From = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			_ = tp.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if s.rejectRcpt {
+				_ = tp.PrintfLine("550 mailbox unavailable")
+				continue
+			}
+			msg.To = append(msg.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "DATA":
+			_ = tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.received <- msg
+			msg = receivedMail{}
+			_ = tp.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer_SendsToServer(t *testing.T) {
+	server := newFakeSMTPServer(t)
+
+	err := server.mailer().Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Скоро срок погашения",
+		Text:    "Plain body",
+		HTML:    "<p>HTML body</p>",
+	})
+	require.NoError(t, err)
+
+	var got receivedMail
+	select {
+	case got = <-server.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	require.Equal(t, "no-reply@uade.kz", got.From)
+	require.Equal(t, []string{"user@example.com"}, got.To)
+
+	msg, err := mail.ReadMessage(strings.NewReader(got.Data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Скоро срок погашения", subject)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		parts[part.Header.Get("Content-Type")] = string(body)
+	}
+	require.Equal(t, map[string]string{
+		"text/plain; charset=utf-8": "Plain body",
+		"text/html; charset=utf-8":  "<p>HTML body</p>",
+	}, parts)
+}
+
+func TestSMTPMailer_RecipientRejected(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	server.rejectRcpt = true
+
+	err := server.mailer().Send(context.Background(), Message{To: "user@example.com", Text: "hello"})
+	require.ErrorContains(t, err, "550")
+}
+
+func TestSMTPMailer_UnresponsiveServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		// accept the connection but never greet
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		<-done
+		_ = conn.Close()
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	m := NewSMTPMailer(host, port, "", "", "no-reply@uade.kz")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = m.Send(ctx, Message{To: "user@example.com", Text: "hello"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+
+	"github.com/railanbaigazy/uade-api/internal/mailer"
+)
+
+// DefaultLocale is the language of emails to users who did not pick one
+// of Locales.
+const DefaultLocale = "en"
+
+// Locales lists the languages emails are available in.
+var Locales = []string{"en", "ru"}
+
+//go:embed templates
+var templateFS embed.FS
+
+// Every locale has a text template set, <locale>.txt, defining "<type>"
+// and "<type>.subject" for each type plus "footer", and an HTML set,
+// <locale>.html, defining the body "<type>" plus "button" and "footer" for
+// layout.html.
+var (
+	textTemplates = map[string]*texttemplate.Template{}
+	htmlTemplates = map[string]*htmltemplate.Template{}
+)
+
+func init() {
+	for _, locale := range Locales {
+		textTemplates[locale] = texttemplate.Must(
+			texttemplate.New("").Option("missingkey=zero").ParseFS(templateFS, "templates/"+locale+".txt"))
+		htmlTemplates[locale] = htmltemplate.Must(
+			htmltemplate.New("").Option("missingkey=zero").ParseFS(templateFS, "templates/layout.html", "templates/"+locale+".html"))
+	}
+}
+
+// ValidLocale reports whether emails are available in locale.
+func ValidLocale(locale string) bool {
+	_, ok := textTemplates[locale]
+	return ok
+}
+
+// EmailData is what a notification email is rendered from.
+type EmailData struct {
+	// Name is the recipient's name.
+	Name string
+	// Link opens what the notification is about in the app.
+	Link string
+	// Data is Event.Data as stored.
+	Data map[string]any
+}
+
+type layoutData struct {
+	Locale  string
+	Subject string
+	Link    string
+	Body    htmltemplate.HTML
+}
+
+// RenderEmail renders the email for a notification of type typ in locale,
+// falling back to DefaultLocale. The recipient is left for the caller.
+func RenderEmail(locale, typ string, d EmailData) (mailer.Message, error) {
+	if !ValidLocale(locale) {
+		locale = DefaultLocale
+	}
+	text, html := textTemplates[locale], htmlTemplates[locale]
+	if text.Lookup(typ) == nil || html.Lookup(typ) == nil {
+		return mailer.Message{}, fmt.Errorf("no %s email template for %s", locale, typ)
+	}
+
+	var subject, body, footer, htmlBody, page bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, typ+".subject", d); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := text.ExecuteTemplate(&body, typ, d); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := text.ExecuteTemplate(&footer, "footer", d); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, typ, d); err != nil {
+		return mailer.Message{}, err
+	}
+	err := html.ExecuteTemplate(&page, "layout", layoutData{
+		Locale:  locale,
+		Subject: subject.String(),
+		Link:    d.Link,
+		Body:    htmltemplate.HTML(htmlBody.String()),
+	})
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		Subject: subject.String(),
+		Text:    body.String() + "\n-- \n" + footer.String() + "\n",
+		HTML:    page.String(),
+	}, nil
+}
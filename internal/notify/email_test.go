@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderEmail_EveryTypeAndLocale(t *testing.T) {
+	for _, locale := range Locales {
+		for _, typ := range Types {
+			msg, err := RenderEmail(locale, typ, EmailData{Name: "Aida", Link: "https://uade.kz/agreements/9"})
+			require.NoError(t, err, "%s %s", locale, typ)
+			require.NotEmpty(t, msg.Subject, "%s %s", locale, typ)
+			require.Contains(t, msg.Text, "Aida")
+			require.Contains(t, msg.Text, "https://uade.kz/agreements/9")
+			require.Contains(t, msg.HTML, `href="https://uade.kz/agreements/9"`)
+			require.Contains(t, msg.HTML, "<title>"+msg.Subject+"</title>")
+		}
+	}
+}
+
+func TestRenderEmail_Localized(t *testing.T) {
+	d := EmailData{Name: "Aida", Data: map[string]any{"principal_amount": 1000, "currency": "KZT"}}
+
+	en, err := RenderEmail("en", AgreementRequested, d)
+	require.NoError(t, err)
+	require.Equal(t, "New loan request on your post", en.Subject)
+	require.Contains(t, en.Text, "borrow 1000 KZT")
+
+	ru, err := RenderEmail("ru", AgreementRequested, d)
+	require.NoError(t, err)
+	require.Equal(t, "Новая заявка на заём по вашему объявлению", ru.Subject)
+	require.Contains(t, ru.HTML, `<html lang="ru">`)
+	require.Contains(t, ru.HTML, "1000 KZT")
+
+	fallback, err := RenderEmail("de", AgreementRequested, d)
+	require.NoError(t, err)
+	require.Equal(t, en.Subject, fallback.Subject)
+}
+
+func TestRenderEmail_EscapesHTML(t *testing.T) {
+	msg, err := RenderEmail("en", IdentityRejected, EmailData{
+		Name: "<b>Aida</b>",
+		Data: map[string]any{"reason": `<script>alert("x")</script>`},
+	})
+	require.NoError(t, err)
+	require.NotContains(t, msg.HTML, "<script>")
+	require.NotContains(t, msg.HTML, "<b>Aida</b>")
+	require.Contains(t, msg.HTML, "&lt;script&gt;")
+	// the plain text part is not HTML
+	require.Contains(t, msg.Text, `<script>alert("x")</script>`)
+}
+
+func TestRenderEmail_UnknownType(t *testing.T) {
+	_, err := RenderEmail("en", "agreement_exploded", EmailData{})
+	require.Error(t, err)
+}
@@ -0,0 +1,89 @@
+// Package notify delivers events users should hear about, such as a loan
+// request on their post, to their notification inbox and by email.
+package notify
+
+import (
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Notification types.
+const (
+	// AgreementRequested tells a lender that a borrower requested an
+	// agreement on their post.
+	AgreementRequested = "agreement_requested"
+	AgreementAccepted  = "agreement_accepted"
+	AgreementCancelled = "agreement_cancelled"
+	// AgreementDueSoon reminds a borrower of an upcoming due date.
+	AgreementDueSoon = "agreement_due_soon"
+	ReviewReceived   = "review_received"
+	IdentityApproved = "identity_approved"
+	IdentityRejected = "identity_rejected"
+)
+
+// Types lists every notification type, in the order preferences are shown.
+var Types = []string{
+	AgreementRequested,
+	AgreementAccepted,
+	AgreementCancelled,
+	AgreementDueSoon,
+	ReviewReceived,
+	IdentityApproved,
+	IdentityRejected,
+}
+
+// ValidType reports whether t is a notification type.
+func ValidType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something that happened to a user.
+type Event struct {
+	UserID      int64
+	Type        string
+	AgreementID *int64
+	// Data holds details for displaying the notification; it is stored as
+	// a JSON object.
+	Data map[string]any
+}
+
+// Send delivers e on every channel the user has not turned off for its
+// type: it is stored in their inbox and, if their email is verified,
+// queued for sending by email. Pass the transaction making the change the
+// event is about, so the notification is only kept if it commits.
+func Send(ex sqlx.Execer, e Event) error {
+	if e.Data == nil {
+		e.Data = map[string]any{}
+	}
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.Exec(`
+		INSERT INTO notifications (user_id, type, agreement_id, data)
+		SELECT $1::int, $2::text, $3::int, $4::jsonb
+		WHERE NOT EXISTS (
+		    SELECT 1 FROM notification_preferences WHERE user_id = $1 AND type = $2 AND NOT in_app
+		)
+	`, e.UserID, e.Type, e.AgreementID, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.Exec(`
+		INSERT INTO email_outbox (user_id, type, agreement_id, data)
+		SELECT id, $2::text, $3::int, $4::jsonb FROM users
+		WHERE id = $1 AND email_verified_at IS NOT NULL AND deleted_at IS NULL
+		  AND NOT EXISTS (
+		      SELECT 1 FROM notification_preferences WHERE user_id = $1 AND type = $2 AND NOT email
+		  )
+	`, e.UserID, e.Type, e.AgreementID, data)
+	return err
+}
@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSend(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	agreementID := int64(9)
+
+	mock.ExpectExec(`INSERT INTO notifications \(user_id, type, agreement_id, data\)\s+SELECT .* NOT in_app`).
+		WithArgs(int64(2), AgreementAccepted, agreementID, []byte(`{"currency":"KZT"}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO email_outbox .* email_verified_at IS NOT NULL .* NOT email`).
+		WithArgs(int64(2), AgreementAccepted, agreementID, []byte(`{"currency":"KZT"}`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := Send(db, Event{UserID: 2, Type: AgreementAccepted, AgreementID: &agreementID, Data: map[string]any{"currency": "KZT"}})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestValidType(t *testing.T) {
+	require.True(t, ValidType(AgreementDueSoon))
+	require.False(t, ValidType("agreement_exploded"))
+}
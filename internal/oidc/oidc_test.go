@@ -0,0 +1,90 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/railanbaigazy/uade-api/internal/oidc"
+	"github.com/railanbaigazy/uade-api/internal/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "https://uade.kz/oauth/callback/mock"
+
+func newProvider(t *testing.T) (*oidc.Provider, *oidctest.Server) {
+	t.Helper()
+	srv, err := oidctest.NewServer("uade", "client-secret")
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	srv.SetUser(oidctest.User{Subject: "sub-1", Email: "aigerim@example.com", EmailVerified: true, Name: "Aigerim"})
+	return oidc.NewProvider(srv.Config("mock", redirectURL), nil), srv
+}
+
+func authorize(t *testing.T, p *oidc.Provider, srv *oidctest.Server, state, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, oidc.Challenge(verifier))
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	require.Equal(t, redirectURL, u.Query().Get("redirect_uri"))
+	require.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+
+	code, gotState, err := srv.Authorize(authURL)
+	require.NoError(t, err)
+	require.Equal(t, state, gotState)
+	return code
+}
+
+func TestProvider_Flow(t *testing.T) {
+	p, srv := newProvider(t)
+
+	code := authorize(t, p, srv, "state-1", "nonce-1", "verifier-1")
+	claims, err := p.Exchange(context.Background(), code, "verifier-1", "nonce-1")
+	require.NoError(t, err)
+	require.Equal(t, &oidc.Claims{Subject: "sub-1", Email: "aigerim@example.com", EmailVerified: true, Name: "Aigerim"}, claims)
+
+	// codes are single use
+	_, err = p.Exchange(context.Background(), code, "verifier-1", "nonce-1")
+	require.Error(t, err)
+}
+
+func TestProvider_WrongVerifier(t *testing.T) {
+	p, srv := newProvider(t)
+
+	code := authorize(t, p, srv, "state", "nonce", "verifier")
+	_, err := p.Exchange(context.Background(), code, "other-verifier", "nonce")
+	require.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestProvider_WrongNonce(t *testing.T) {
+	p, srv := newProvider(t)
+
+	code := authorize(t, p, srv, "state", "nonce", "verifier")
+	_, err := p.Exchange(context.Background(), code, "verifier", "replayed-nonce")
+	require.ErrorIs(t, err, oidc.ErrInvalidToken)
+}
+
+func TestProvider_WrongAudience(t *testing.T) {
+	_, srv := newProvider(t)
+
+	// a token issued to another client of the same provider
+	cfg := srv.Config("mock", redirectURL)
+	other := oidc.NewProvider(cfg, nil)
+	code := authorize(t, other, srv, "state", "nonce", "verifier")
+
+	cfg.ClientID = "someone-else"
+	_, err := oidc.NewProvider(cfg, nil).Exchange(context.Background(), code, "verifier", "nonce")
+	require.Error(t, err)
+}
+
+func TestProvider_IssuerMismatch(t *testing.T) {
+	_, srv := newProvider(t)
+
+	cfg := srv.Config("mock", redirectURL)
+	cfg.Issuer = srv.URL + "/"
+	_, err := oidc.NewProvider(cfg, nil).AuthCodeURL(context.Background(), "s", "n", "c")
+	require.ErrorContains(t, err, "does not match")
+}
@@ -0,0 +1,76 @@
+// Package principal carries the authenticated caller of a request through
+// its context.Context. Only middleware that verified the caller's
+// credentials stores a principal, so unlike request headers it cannot be
+// supplied by the client.
+package principal
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+// ScopeAll is held by principals authenticated with a session, which may do
+// everything their role allows.
+const ScopeAll = "*"
+
+// Scopes that can be granted to API keys.
+const (
+	ScopeRead            = "read"
+	ScopePostsWrite      = "posts:write"
+	ScopeAgreementsWrite = "agreements:write"
+)
+
+// APIKeyScopes lists the scopes users may grant to their API keys.
+var APIKeyScopes = []string{ScopeRead, ScopePostsWrite, ScopeAgreementsWrite}
+
+// Principal is the authenticated user behind a request.
+type Principal struct {
+	UserID int64
+	// Role is the current role of the user, filled in by ActiveUser.
+	Role string
+	// SessionID is the login session the access token belongs to, and
+	// APIKeyID the API key used instead; exactly one of them is set.
+	SessionID int64
+	APIKeyID  int64
+	// Scopes limits what the credentials may be used for.
+	Scopes []string
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, ScopeAll) || slices.Contains(p.Scopes, scope)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// WithRequest returns a shallow copy of r whose context carries p, the way
+// the authentication middleware passes the request on.
+func WithRequest(r *http.Request, p Principal) *http.Request {
+	return r.WithContext(NewContext(r.Context(), p))
+}
+
+// FromContext returns the principal stored in ctx, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok && p.UserID > 0
+}
+
+// UserID returns the ID of the authenticated user, or false when the request
+// is anonymous.
+func UserID(ctx context.Context) (int64, bool) {
+	p, ok := FromContext(ctx)
+	return p.UserID, ok
+}
+
+// Role returns the role of the authenticated user, or "" when the request is
+// anonymous or the role has not been loaded.
+func Role(ctx context.Context) string {
+	p, _ := FromContext(ctx)
+	return p.Role
+}
@@ -0,0 +1,44 @@
+package principal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	require.False(t, ok)
+
+	// a zero user ID never counts as authenticated
+	_, ok = FromContext(NewContext(context.Background(), Principal{Role: "admin"}))
+	require.False(t, ok)
+
+	ctx := NewContext(context.Background(), Principal{UserID: 7, Role: "moderator", SessionID: 3, Scopes: []string{ScopeAll}})
+	p, ok := FromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, int64(3), p.SessionID)
+
+	id, ok := UserID(ctx)
+	require.True(t, ok)
+	require.Equal(t, int64(7), id)
+	require.Equal(t, "moderator", Role(ctx))
+	require.Equal(t, "", Role(context.Background()))
+}
+
+func TestWithRequest(t *testing.T) {
+	req := WithRequest(httptest.NewRequest(http.MethodGet, "/", nil), Principal{UserID: 5})
+	id, ok := UserID(req.Context())
+	require.True(t, ok)
+	require.Equal(t, int64(5), id)
+}
+
+func TestHasScope(t *testing.T) {
+	require.True(t, Principal{Scopes: []string{ScopeAll}}.HasScope("agreements:write"))
+	require.True(t, Principal{Scopes: []string{"read", "agreements:write"}}.HasScope("agreements:write"))
+	require.False(t, Principal{Scopes: []string{"read"}}.HasScope("agreements:write"))
+	require.False(t, Principal{}.HasScope("read"))
+}
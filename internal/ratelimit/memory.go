@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxMemoryBuckets bounds the memory used by MemoryStore. When it is reached
+// buckets that have refilled completely are dropped, as they hold no state.
+const maxMemoryBuckets = 100000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	burst  int
+	rate   float64
+}
+
+// MemoryStore keeps buckets in process memory. Limits are per instance, so
+// it only suits single-instance deployments.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= maxMemoryBuckets {
+			s.prune(now)
+		}
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = refill(b.tokens, b.last, now, limit)
+	b.last = now
+	b.burst = limit.Burst
+	b.rate = limit.Rate()
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return Result{Allowed: allowed, Tokens: b.tokens}, nil
+}
+
+func (s *MemoryStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= float64(b.burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
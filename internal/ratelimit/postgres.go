@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so all
+// instances share the same limits. Each request is a single upsert.
+type PostgresStore struct {
+	DB *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{DB: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	// refilled mirrors refill(): the stored tokens plus what accrued since
+	// updated_at, capped at the burst
+	const refilled = `LEAST($2::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM ($4::timestamptz - b.updated_at))::float8, 0) * $3::float8)`
+
+	var res Result
+	err := s.DB.QueryRowxContext(ctx, `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::float8 - 1, TRUE, $4)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN `+refilled+` >= 1 THEN `+refilled+` - 1 ELSE `+refilled+` END,
+			allowed = `+refilled+` >= 1,
+			updated_at = $4
+		RETURNING tokens, allowed
+	`, key, limit.Burst, limit.Rate(), now).Scan(&res.Tokens, &res.Allowed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return res, nil
+}
+
+// Purge deletes buckets untouched since before, which have long refilled.
+func (s *PostgresStore) Purge(ctx context.Context, before time.Time) error {
+	_, err := s.DB.ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < $1", before)
+	return err
+}
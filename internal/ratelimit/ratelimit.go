@@ -0,0 +1,122 @@
+// Package ratelimit implements token-bucket rate limiting with pluggable
+// storage: in memory for a single instance, in Postgres for several.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Per on average, with bursts of up to Burst
+// requests at once.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Rate is the refill rate of the bucket in tokens per second.
+func (l Limit) Rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// ParseLimit parses limits written as "requests/period[:burst]", e.g.
+// "120/1m" or "5/1h:10". The burst defaults to the number of requests.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	rate, burst, hasBurst := strings.Cut(s, ":")
+
+	reqs, per, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, want requests/period[:burst]", s)
+	}
+
+	var l Limit
+	var err error
+	if l.Requests, err = strconv.Atoi(reqs); err != nil || l.Requests <= 0 {
+		return Limit{}, fmt.Errorf("invalid request count in limit %q", s)
+	}
+	if l.Per, err = time.ParseDuration(per); err != nil || l.Per <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in limit %q", s)
+	}
+
+	l.Burst = l.Requests
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid burst in limit %q", s)
+		}
+	}
+
+	return l, nil
+}
+
+// ParseRoutes parses per-route limits written as
+// "METHOD /path=limit;METHOD /path=limit", using the same patterns as the
+// routes in SetupRoutes.
+func ParseRoutes(s string) (map[string]Limit, error) {
+	routes := make(map[string]Limit)
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, limit, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route limit %q, want pattern=limit", entry)
+		}
+
+		l, err := ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		routes[strings.Join(strings.Fields(pattern), " ")] = l
+	}
+	return routes, nil
+}
+
+// Result describes the bucket after a request was counted.
+type Result struct {
+	Allowed bool
+	// Tokens left in the bucket; below one the next request is rejected.
+	Tokens float64
+}
+
+// Remaining is the number of requests that can be made right away.
+func (r Result) Remaining() int {
+	return int(math.Max(0, math.Floor(r.Tokens)))
+}
+
+// RetryAfter is how long until the next request will be allowed.
+func (r Result) RetryAfter(l Limit) time.Duration {
+	if r.Tokens >= 1 {
+		return 0
+	}
+	return seconds((1 - r.Tokens) / l.Rate())
+}
+
+// Reset is how long until the bucket is full again.
+func (r Result) Reset(l Limit) time.Duration {
+	return seconds((float64(l.Burst) - r.Tokens) / l.Rate())
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
+
+// Store keeps token buckets. Take refills the bucket for key according to
+// the time elapsed since the last call and takes one token if there is one.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// refill returns the tokens in a bucket that held tokens at last, capped at
+// the burst size.
+func refill(tokens float64, last, now time.Time, limit Limit) float64 {
+	elapsed := max(now.Sub(last).Seconds(), 0)
+	return math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate())
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/railanbaigazy/uade-api/internal/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("120/1m")
+	require.NoError(t, err)
+	require.Equal(t, Limit{Requests: 120, Per: time.Minute, Burst: 120}, l)
+	require.InDelta(t, 2.0, l.Rate(), 1e-9)
+
+	l, err = ParseLimit(" 5/1h:10 ")
+	require.NoError(t, err)
+	require.Equal(t, Limit{Requests: 5, Per: time.Hour, Burst: 10}, l)
+
+	for _, bad := range []string{"", "120", "0/1m", "10/soon", "10/1m:0", "ten/1m"} {
+		_, err := ParseLimit(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("POST  /api/auth/login=5/1m; GET /api/posts=60/1m:120;")
+	require.NoError(t, err)
+	require.Equal(t, map[string]Limit{
+		"POST /api/auth/login": {Requests: 5, Per: time.Minute, Burst: 5},
+		"GET /api/posts":       {Requests: 60, Per: time.Minute, Burst: 120},
+	}, routes)
+
+	_, err = ParseRoutes("POST /api/auth/login")
+	require.Error(t, err)
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Per: time.Second, Burst: 3}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		res, err := s.Take(ctx, "k", limit, now)
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+		require.Equal(t, i, res.Remaining())
+	}
+
+	res, err := s.Take(ctx, "k", limit, now)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, time.Second, res.RetryAfter(limit))
+	require.Equal(t, 2*time.Second, res.Reset(limit))
+
+	// other keys have their own bucket
+	res, err = s.Take(ctx, "other", limit, now)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	// two requests per second refill
+	res, err = s.Take(ctx, "k", limit, now.Add(500*time.Millisecond))
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Equal(t, 0, res.Remaining())
+
+	// the bucket never holds more than the burst
+	res, err = s.Take(ctx, "k", limit, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, res.Remaining())
+}
+
+func TestPostgresStore_Take(t *testing.T) {
+	db, mock := utils.NewSQLXMock(t)
+	s := NewPostgresStore(db)
+	limit := Limit{Requests: 60, Per: time.Minute, Burst: 10}
+	now := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO rate_limit_buckets AS b`).
+		WithArgs("user:1", 10, 1.0, now).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "allowed"}).AddRow(0.5, false))
+
+	res, err := s.Take(context.Background(), "user:1", limit, now)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 0, res.Remaining())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
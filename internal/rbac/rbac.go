@@ -0,0 +1,83 @@
+package rbac
+
+// Permission names an action that only some roles may perform.
+type Permission string
+
+const (
+	// PostsCreate allows publishing lend/borrow posts.
+	PostsCreate Permission = "posts:create"
+	// PostsModerate allows editing, hiding and restoring other users' posts.
+	PostsModerate Permission = "posts:moderate"
+
+	// ReviewsModerate allows hiding and restoring reviews.
+	ReviewsModerate Permission = "reviews:moderate"
+
+	// AgreementsCreate allows requesting and accepting agreements.
+	AgreementsCreate Permission = "agreements:create"
+	// AgreementsViewAll allows reading agreements one is not a party to.
+	AgreementsViewAll Permission = "agreements:view_all"
+
+	// DisputesOpen allows a party to dispute an agreement.
+	DisputesOpen Permission = "disputes:open"
+	// DisputesResolve allows deciding the outcome of a dispute.
+	DisputesResolve Permission = "disputes:resolve"
+
+	// KYCReview allows viewing identity documents and approving or
+	// rejecting identity verifications.
+	KYCReview Permission = "kyc:review"
+
+	// UsersView allows looking up any user, including private fields.
+	UsersView Permission = "users:view"
+	// UsersManage allows blocking, suspending, deleting and restoring users.
+	UsersManage Permission = "users:manage"
+	// UsersManageRoles allows changing user roles.
+	UsersManageRoles Permission = "users:manage_roles"
+)
+
+var userPermissions = []Permission{
+	PostsCreate,
+	AgreementsCreate,
+	DisputesOpen,
+}
+
+var moderatorPermissions = append(append([]Permission{}, userPermissions...),
+	PostsModerate,
+	ReviewsModerate,
+	AgreementsViewAll,
+	DisputesResolve,
+	KYCReview,
+	UsersView,
+)
+
+var adminPermissions = append(append([]Permission{}, moderatorPermissions...),
+	UsersManage,
+	UsersManageRoles,
+)
+
+// matrix maps each users.role value to the permissions it grants.
+var matrix = map[string][]Permission{
+	"user":      userPermissions,
+	"moderator": moderatorPermissions,
+	"admin":     adminPermissions,
+}
+
+// ValidRole reports whether role is one of the users.role values.
+func ValidRole(role string) bool {
+	_, ok := matrix[role]
+	return ok
+}
+
+// Has reports whether role grants p. Unknown roles grant nothing.
+func Has(role string, p Permission) bool {
+	for _, granted := range matrix[role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by role.
+func Permissions(role string) []Permission {
+	return append([]Permission{}, matrix[role]...)
+}
@@ -0,0 +1,60 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHas(t *testing.T) {
+	tests := []struct {
+		role string
+		perm Permission
+		want bool
+	}{
+		{"user", PostsCreate, true},
+		{"user", AgreementsCreate, true},
+		{"user", DisputesOpen, true},
+		{"user", PostsModerate, false},
+		{"user", ReviewsModerate, false},
+		{"user", KYCReview, false},
+		{"user", UsersManage, false},
+
+		{"moderator", PostsCreate, true},
+		{"moderator", PostsModerate, true},
+		{"moderator", ReviewsModerate, true},
+		{"moderator", KYCReview, true},
+		{"moderator", DisputesResolve, true},
+		{"moderator", UsersView, true},
+		{"moderator", UsersManage, false},
+		{"moderator", UsersManageRoles, false},
+
+		{"admin", PostsModerate, true},
+		{"admin", AgreementsViewAll, true},
+		{"admin", UsersManage, true},
+		{"admin", UsersManageRoles, true},
+
+		{"", PostsCreate, false},
+		{"superuser", UsersManage, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+" "+string(tt.perm), func(t *testing.T) {
+			require.Equal(t, tt.want, Has(tt.role, tt.perm))
+		})
+	}
+}
+
+func TestPermissions_ReturnsCopy(t *testing.T) {
+	perms := Permissions("user")
+	require.NotEmpty(t, perms)
+
+	perms[0] = UsersManage
+	require.False(t, Has("user", UsersManage))
+}
+
+func TestValidRole(t *testing.T) {
+	require.True(t, ValidRole("moderator"))
+	require.False(t, ValidRole("superuser"))
+	require.False(t, ValidRole(""))
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDir_PutOpenDelete(t *testing.T) {
+	ctx := context.Background()
+	d := NewDir(t.TempDir())
+
+	require.NoError(t, d.Put(ctx, "kyc/1/front", strings.NewReader("image")))
+
+	f, err := d.Open(ctx, "kyc/1/front")
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Equal(t, "image", string(data))
+
+	require.NoError(t, d.Delete(ctx, "kyc/1/front"))
+	_, err = d.Open(ctx, "kyc/1/front")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, d.Delete(ctx, "kyc/1/front"))
+}
+
+func TestDir_RejectsUnsafeKeys(t *testing.T) {
+	d := NewDir(t.TempDir())
+
+	for _, key := range []string{"", "../etc/passwd", "kyc/../../x", "/abs", "kyc//x"} {
+		require.Error(t, d.Put(context.Background(), key, strings.NewReader("x")), key)
+	}
+}
@@ -0,0 +1,20 @@
+// Package storage keeps uploaded files, such as identity documents, outside
+// the database.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned for keys that were never stored or were deleted.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage stores objects under opaque keys chosen by the caller.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes an object; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,81 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// base32 of the RFC 6238 SHA-1 test key "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeAt_RFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B lists 8-digit codes; ours are their last 6 digits
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range cases {
+		got, err := CodeAt(rfcSecret, Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, want, got, "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	step, ok := Validate(rfcSecret, "050471", now)
+	require.True(t, ok)
+	require.Equal(t, Step(now), step)
+
+	// the previous period is still accepted
+	_, ok = Validate(rfcSecret, "050471", now.Add(Period))
+	require.True(t, ok)
+
+	_, ok = Validate(rfcSecret, "050471", now.Add(3*Period))
+	require.False(t, ok)
+
+	_, ok = Validate(rfcSecret, "000000", now)
+	require.False(t, ok)
+
+	_, ok = Validate("not base32!", "050471", now)
+	require.False(t, ok)
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	require.Len(t, secret, 32)
+
+	code, err := CodeAt(secret, Step(time.Now()))
+	require.NoError(t, err)
+	require.True(t, IsCode(code))
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Uade", "user@example.com", rfcSecret)
+
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/Uade:user@example.com?"))
+	require.Contains(t, uri, "secret="+rfcSecret)
+	require.Contains(t, uri, "issuer=Uade")
+	require.Contains(t, uri, "digits=6")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(RecoveryCodeCount)
+	require.NoError(t, err)
+	require.Len(t, codes, RecoveryCodeCount)
+
+	for _, c := range codes {
+		require.Len(t, c, 11)
+		require.False(t, IsCode(c))
+		require.Equal(t, c, NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(c, "-", ""))+" "))
+	}
+}
@@ -0,0 +1,127 @@
+// Package trust computes the internal trust score of a user from their
+// agreement history and account, together with a breakdown explaining it.
+package trust
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// MaxScore is the best possible score; scores range from 0 to MaxScore.
+	MaxScore = 100
+
+	basePoints         = 30
+	maxAgePoints       = 10
+	ageForMaxPoints    = 12 // months
+	pointsPerLevel     = 10
+	maxOnTimePoints    = 30
+	loansForConfidence = 5
+	maxRepaidPoints    = 20
+	repaidForMaxPoints = 1_000_000 // KZT
+	pointsPerDefault   = -25
+	pointsPerDispute   = -10
+)
+
+// Verification levels of an account: a verified email, then an identity
+// document approved by a moderator.
+const (
+	LevelNone = iota
+	LevelEmail
+	LevelIdentity
+)
+
+// Level returns the verification level of an account.
+func Level(emailVerified, identityVerified bool) int {
+	switch {
+	case identityVerified:
+		return LevelIdentity
+	case emailVerified:
+		return LevelEmail
+	}
+	return LevelNone
+}
+
+// Inputs is what the score is computed from. Loans are agreements the user
+// took as borrower.
+type Inputs struct {
+	AccountAge        time.Duration
+	VerificationLevel int
+	// FinishedLoans counts completed and defaulted loans, OnTimeLoans those
+	// completed by their due date.
+	FinishedLoans int
+	OnTimeLoans   int
+	Defaults      int
+	// Disputes counts disputed agreements in either role.
+	Disputes    int
+	TotalRepaid float64
+}
+
+// Factor is one line of the explanation of a score.
+type Factor struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+	// Max is the most the factor can add, or 0 for penalties.
+	Max    int    `json:"max,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// Score is a computed trust score with its breakdown.
+type Score struct {
+	Value   int      `json:"score"`
+	Factors []Factor `json:"factors"`
+}
+
+// Compute scores in. The factors add up to the score before it is clamped
+// to 0..MaxScore.
+func Compute(in Inputs) Score {
+	months := int(in.AccountAge.Hours() / 24 / 30)
+	agePoints := min(months, ageForMaxPoints) * maxAgePoints / ageForMaxPoints
+
+	maxLevelPoints := LevelIdentity * pointsPerLevel
+	levelPoints := min(max(in.VerificationLevel, 0)*pointsPerLevel, maxLevelPoints)
+
+	// a perfect record over one loan says less than over several
+	onTimePoints := 0
+	onTimeDetail := "no finished loans yet"
+	if in.FinishedLoans > 0 {
+		rate := float64(in.OnTimeLoans) / float64(in.FinishedLoans)
+		confidence := float64(min(in.FinishedLoans, loansForConfidence)) / loansForConfidence
+		onTimePoints = int(math.Round(rate * confidence * maxOnTimePoints))
+		onTimeDetail = fmt.Sprintf("%d of %d finished loans repaid on time", in.OnTimeLoans, in.FinishedLoans)
+	}
+
+	repaidPoints := 0
+	if in.TotalRepaid > 0 {
+		share := math.Log10(1+in.TotalRepaid) / math.Log10(1+repaidForMaxPoints)
+		repaidPoints = int(math.Round(math.Min(share, 1) * maxRepaidPoints))
+	}
+
+	factors := []Factor{
+		{Name: "base", Points: basePoints, Max: basePoints, Detail: "starting score"},
+		{Name: "account_age", Points: agePoints, Max: maxAgePoints, Detail: fmt.Sprintf("member for %d months", months)},
+		{Name: "verification", Points: levelPoints, Max: maxLevelPoints, Detail: levelDetail(in.VerificationLevel)},
+		{Name: "on_time_repayment", Points: onTimePoints, Max: maxOnTimePoints, Detail: onTimeDetail},
+		{Name: "total_repaid", Points: repaidPoints, Max: maxRepaidPoints, Detail: fmt.Sprintf("%.2f KZT repaid", in.TotalRepaid)},
+		{Name: "defaults", Points: in.Defaults * pointsPerDefault, Detail: fmt.Sprintf("%d defaulted loans", in.Defaults)},
+		{Name: "disputes", Points: in.Disputes * pointsPerDispute, Detail: fmt.Sprintf("%d disputed agreements", in.Disputes)},
+	}
+
+	total := 0
+	for _, f := range factors {
+		total += f.Points
+	}
+
+	return Score{Value: min(max(total, 0), MaxScore), Factors: factors}
+}
+
+func levelDetail(level int) string {
+	switch {
+	case level >= LevelIdentity:
+		return "identity verified"
+	case level == LevelEmail:
+		return "email verified"
+	}
+	return "not verified"
+}
@@ -0,0 +1,63 @@
+package trust
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const month = 30 * 24 * time.Hour
+
+func TestCompute_NewAccount(t *testing.T) {
+	s := Compute(Inputs{})
+	require.Equal(t, basePoints, s.Value)
+}
+
+func TestCompute_BestRecordReachesMax(t *testing.T) {
+	s := Compute(Inputs{
+		AccountAge:        24 * month,
+		VerificationLevel: LevelIdentity,
+		FinishedLoans:     8,
+		OnTimeLoans:       8,
+		TotalRepaid:       5_000_000,
+	})
+	require.Equal(t, MaxScore, s.Value)
+}
+
+func TestCompute_FactorsExplainScore(t *testing.T) {
+	s := Compute(Inputs{
+		AccountAge:        6 * month,
+		VerificationLevel: LevelEmail,
+		FinishedLoans:     2,
+		OnTimeLoans:       1,
+		TotalRepaid:       100_000,
+	})
+
+	total := 0
+	points := map[string]int{}
+	for _, f := range s.Factors {
+		total += f.Points
+		points[f.Name] = f.Points
+	}
+	require.Equal(t, total, s.Value)
+	require.Equal(t, 5, points["account_age"])
+	require.Equal(t, 10, points["verification"])
+	// half on time over two of five loans needed for full confidence
+	require.Equal(t, 6, points["on_time_repayment"])
+	require.Equal(t, 17, points["total_repaid"])
+}
+
+func TestCompute_PenaltiesClampAtZero(t *testing.T) {
+	s := Compute(Inputs{FinishedLoans: 3, Defaults: 3, Disputes: 2})
+	require.Equal(t, 0, s.Value)
+
+	s = Compute(Inputs{AccountAge: 12 * month, VerificationLevel: LevelEmail, Disputes: 1})
+	require.Equal(t, 40, s.Value)
+}
+
+func TestLevel(t *testing.T) {
+	require.Equal(t, LevelNone, Level(false, false))
+	require.Equal(t, LevelEmail, Level(true, false))
+	require.Equal(t, LevelIdentity, Level(true, true))
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"net/http"
+	"time"
+)
+
+// WriteAccessDenied reports a code from models.User.AccessDenial to the
+// client, including the end of the suspension when there is one.
+func WriteAccessDenied(w http.ResponseWriter, code string, suspendedUntil *time.Time) {
+	switch code {
+	case "account_blocked":
+		WriteJSONErrorCode(w, "account is blocked", code, http.StatusForbidden)
+	case "account_suspended":
+		msg := "account is suspended"
+		if suspendedUntil != nil {
+			msg += " until " + suspendedUntil.UTC().Format(time.RFC3339)
+		}
+		WriteJSONErrorCode(w, msg, code, http.StatusForbidden)
+	default:
+		WriteJSONErrorCode(w, "account is no longer available", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAccessDenied(t *testing.T) {
+	until := time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		code       string
+		until      *time.Time
+		wantStatus int
+		wantMsg    string
+	}{
+		{"blocked", "account_blocked", nil, http.StatusForbidden, "account is blocked"},
+		{"suspended with end", "account_suspended", &until, http.StatusForbidden, "account is suspended until 2025-12-31T00:00:00Z"},
+		{"suspended indefinitely", "account_suspended", nil, http.StatusForbidden, "account is suspended"},
+		{"deleted", "account_deleted", nil, http.StatusUnauthorized, "account is no longer available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteAccessDenied(rec, tt.code, tt.until)
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			require.Equal(t, tt.code, body["code"])
+			require.Equal(t, tt.wantMsg, body["error"])
+		})
+	}
+}
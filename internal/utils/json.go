@@ -23,3 +23,9 @@ func WriteJSON(w http.ResponseWriter, data interface{}, status int) {
 		http.Error(w, "failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+// WriteJSONErrorCode is like WriteJSONError but adds a machine-readable code
+// so clients can tell apart errors that share a status.
+func WriteJSONErrorCode(w http.ResponseWriter, msg, code string, status int) {
+	WriteJSON(w, map[string]string{"error": msg, "code": code}, status)
+}
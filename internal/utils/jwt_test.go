@@ -2,8 +2,10 @@ package utils
 
 import (
 	"testing"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/railanbaigazy/uade-api/internal/jwtkeys"
 )
 
 func TestGenerateJWT(t *testing.T) {
@@ -35,7 +37,7 @@ func TestGenerateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, err := GenerateJWT(tt.userID, tt.secret)
+			token, err := GenerateJWT(tt.userID, 1, jwtkeys.NewHMAC(tt.secret), time.Hour)
 
 			if (err != nil) != tt.expectErr {
 				t.Errorf("GenerateJWT() error = %v, wantErr %v", err, tt.expectErr)
@@ -54,7 +56,7 @@ func TestGenerateJWTTokenValidation(t *testing.T) {
 	userID := 42
 	secret := "test-secret"
 
-	token, err := GenerateJWT(userID, secret)
+	token, err := GenerateJWT(userID, 1, jwtkeys.NewHMAC(secret), time.Hour)
 	if err != nil {
 		t.Fatalf("GenerateJWT() error = %v", err)
 	}
@@ -92,6 +94,11 @@ func TestGenerateJWTTokenValidation(t *testing.T) {
 		t.Errorf("user_id = %v, want %v", int(extractedUserID), userID)
 	}
 
+	// Check sid claim
+	if sid, ok := claims["sid"].(float64); !ok || int64(sid) != 1 {
+		t.Errorf("sid = %v, want 1", claims["sid"])
+	}
+
 	// Check that exp claim exists
 	if _, ok := claims["exp"]; !ok {
 		t.Fatal("exp claim is missing")
@@ -103,17 +110,40 @@ func TestGenerateJWTTokenValidation(t *testing.T) {
 	}
 }
 
+func TestGenerateJWTExpiry(t *testing.T) {
+	token, err := GenerateJWT(7, 1, jwtkeys.NewHMAC("test-secret"), 15*time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateJWT() error = %v", err)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	}); err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		t.Fatalf("exp claim is missing: %v", err)
+	}
+
+	if d := time.Until(exp.Time); d > 15*time.Minute || d < 14*time.Minute {
+		t.Errorf("token expires in %v, want ~15m", d)
+	}
+}
+
 func TestGenerateJWTWithDifferentSecrets(t *testing.T) {
 	userID := 123
 	secret1 := "secret-one"
 	secret2 := "secret-two"
 
-	token1, err := GenerateJWT(userID, secret1)
+	token1, err := GenerateJWT(userID, 1, jwtkeys.NewHMAC(secret1), time.Hour)
 	if err != nil {
 		t.Fatalf("GenerateJWT() error = %v", err)
 	}
 
-	token2, err := GenerateJWT(userID, secret2)
+	token2, err := GenerateJWT(userID, 1, jwtkeys.NewHMAC(secret2), time.Hour)
 	if err != nil {
 		t.Fatalf("GenerateJWT() error = %v", err)
 	}
@@ -137,7 +167,7 @@ func TestGenerateJWTTokenStructure(t *testing.T) {
 	userID := 100
 	secret := "my-secret"
 
-	token, err := GenerateJWT(userID, secret)
+	token, err := GenerateJWT(userID, 1, jwtkeys.NewHMAC(secret), time.Hour)
 	if err != nil {
 		t.Fatalf("GenerateJWT() error = %v", err)
 	}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs and
+// makes leaked keys easy to find with secret scanners.
+const APIKeyPrefix = "uade_"
+
+// GenerateToken returns a random URL-safe opaque token. Only its hash
+// (see HashToken) should ever be persisted.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 of an opaque token. Tokens are
+// high-entropy, so a fast unsalted hash is enough to make a leaked table useless.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token1, err := GenerateToken()
+	require.NoError(t, err)
+	require.Len(t, token1, 43) // 32 bytes, base64url without padding
+
+	token2, err := GenerateToken()
+	require.NoError(t, err)
+	require.NotEqual(t, token1, token2)
+}
+
+func TestHashToken(t *testing.T) {
+	hash := HashToken("abc")
+	require.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", hash)
+	require.Equal(t, hash, HashToken("abc"))
+	require.NotEqual(t, hash, HashToken("abd"))
+}
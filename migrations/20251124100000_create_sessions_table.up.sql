@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN session_id INT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens (session_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id SERIAL PRIMARY KEY,
+    admin_id INT NOT NULL REFERENCES users(id) ON DELETE RESTRICT,
+    action TEXT NOT NULL,
+    target_user_id INT REFERENCES users(id) ON DELETE SET NULL,
+    target_post_id INT REFERENCES posts(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_admin_audit_log_admin_id ON admin_audit_log (admin_id);
+CREATE INDEX idx_admin_audit_log_target_user_id ON admin_audit_log (target_user_id);
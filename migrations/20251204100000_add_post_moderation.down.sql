@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS post_reports;
+
+DROP INDEX IF EXISTS idx_posts_status;
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS moderated_at,
+    DROP COLUMN IF EXISTS moderation_reason,
+    DROP COLUMN IF EXISTS status;
+
+DROP TYPE IF EXISTS post_report_reason;
+DROP TYPE IF EXISTS post_status;
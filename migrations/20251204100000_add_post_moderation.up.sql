@@ -0,0 +1,19 @@
+CREATE TYPE post_status AS ENUM ('pending_review', 'published', 'rejected', 'hidden');
+CREATE TYPE post_report_reason AS ENUM ('scam', 'spam', 'other');
+
+ALTER TABLE posts
+    ADD COLUMN status post_status NOT NULL DEFAULT 'published',
+    ADD COLUMN moderation_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN moderated_at TIMESTAMPTZ;
+
+CREATE INDEX idx_posts_status ON posts (status) WHERE status <> 'published';
+
+CREATE TABLE IF NOT EXISTS post_reports (
+    id SERIAL PRIMARY KEY,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason post_report_reason NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (post_id, reporter_id)
+);
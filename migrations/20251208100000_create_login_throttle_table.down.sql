@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_unlock_tokens;
+DROP TABLE IF EXISTS login_throttle;
@@ -0,0 +1,2 @@
+ALTER TABLE email_verification_tokens DROP COLUMN IF EXISTS email;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
@@ -0,0 +1,5 @@
+-- a changed email only replaces the current one once it is verified
+ALTER TABLE users ADD COLUMN pending_email VARCHAR(320);
+
+-- set for links confirming a pending_email rather than the current email
+ALTER TABLE email_verification_tokens ADD COLUMN email VARCHAR(320);
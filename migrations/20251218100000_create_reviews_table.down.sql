@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS review_reports;
+DROP TABLE IF EXISTS reviews;
+DROP TYPE IF EXISTS review_status;
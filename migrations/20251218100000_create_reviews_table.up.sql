@@ -0,0 +1,31 @@
+CREATE TYPE review_status AS ENUM ('published', 'hidden');
+
+CREATE TABLE IF NOT EXISTS reviews (
+    id SERIAL PRIMARY KEY,
+    agreement_id INT NOT NULL REFERENCES agreements(id) ON DELETE CASCADE,
+    reviewer_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reviewee_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    comment TEXT NOT NULL DEFAULT '',
+
+    status review_status NOT NULL DEFAULT 'published',
+    moderation_reason TEXT NOT NULL DEFAULT '',
+    moderated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    -- each party reviews the other once per agreement
+    UNIQUE (agreement_id, reviewer_id),
+    CONSTRAINT valid_review_parties CHECK (reviewer_id != reviewee_id)
+);
+
+CREATE INDEX idx_reviews_reviewee_id ON reviews (reviewee_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS review_reports (
+    id SERIAL PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (review_id, reporter_id)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS min_trust_score;
+
+DROP TABLE IF EXISTS trust_scores;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS trust_scores (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    score INT NOT NULL CHECK (score BETWEEN 0 AND 100),
+    factors JSONB NOT NULL DEFAULT '[]',
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_trust_scores_score ON trust_scores (score);
+
+-- the lowest trust score a borrower needs to request an agreement on a lend post
+ALTER TABLE posts ADD COLUMN min_trust_score INT CHECK (min_trust_score BETWEEN 0 AND 100);
@@ -0,0 +1,43 @@
+CREATE TYPE kyc_status AS ENUM ('pending', 'approved', 'rejected');
+
+-- set when a moderator approves an identity document of the user
+ALTER TABLE users ADD COLUMN identity_verified_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS kyc_submissions (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    document_type VARCHAR(32) NOT NULL
+        CHECK (document_type IN ('id_card', 'passport', 'residence_permit')),
+    document_number VARCHAR(64) NOT NULL,
+    country CHAR(2) NOT NULL,
+    -- individual identification number, required for Kazakhstan documents
+    iin CHAR(12),
+
+    status kyc_status NOT NULL DEFAULT 'pending',
+    rejection_reason TEXT NOT NULL DEFAULT '',
+    reviewed_by INT REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_kyc_submissions_user_id ON kyc_submissions (user_id, created_at DESC);
+
+-- one submission awaiting review per user
+CREATE UNIQUE INDEX idx_kyc_submissions_pending ON kyc_submissions (user_id) WHERE status = 'pending';
+
+-- an identity can only verify one account
+CREATE UNIQUE INDEX idx_kyc_submissions_approved_document
+    ON kyc_submissions (country, document_type, document_number) WHERE status = 'approved';
+CREATE UNIQUE INDEX idx_kyc_submissions_approved_iin ON kyc_submissions (iin) WHERE status = 'approved';
+
+CREATE TABLE IF NOT EXISTS kyc_documents (
+    id SERIAL PRIMARY KEY,
+    submission_id INT NOT NULL REFERENCES kyc_submissions(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('front', 'back', 'selfie')),
+    storage_key TEXT NOT NULL,
+    content_type VARCHAR(64) NOT NULL,
+    size_bytes INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (submission_id, kind)
+);
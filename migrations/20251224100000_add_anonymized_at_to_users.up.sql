@@ -0,0 +1,3 @@
+-- set when a user deleted their own account and their personal data was
+-- erased; such accounts can no longer be restored
+ALTER TABLE users ADD COLUMN anonymized_at TIMESTAMPTZ;
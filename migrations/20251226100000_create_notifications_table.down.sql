@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS agreement_reminders;
+DROP TABLE IF EXISTS notifications;
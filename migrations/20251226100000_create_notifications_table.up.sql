@@ -0,0 +1,24 @@
+-- the in-app inbox: events a user should hear about, such as a loan
+-- request on their post
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    agreement_id INT REFERENCES agreements(id) ON DELETE CASCADE,
+    data JSONB NOT NULL DEFAULT '{}',
+
+    read_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_notifications_user_id ON notifications (user_id, created_at DESC);
+CREATE INDEX idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+-- reminders sent about an agreement, so each is sent only once
+CREATE TABLE IF NOT EXISTS agreement_reminders (
+    agreement_id INT NOT NULL REFERENCES agreements(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (agreement_id, kind)
+);
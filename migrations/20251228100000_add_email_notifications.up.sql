@@ -0,0 +1,33 @@
+-- language of the emails sent to the user
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT 'en';
+
+-- channels a user turned off per notification type; without a row every
+-- channel is on
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    in_app BOOLEAN NOT NULL DEFAULT true,
+    email BOOLEAN NOT NULL DEFAULT true,
+
+    PRIMARY KEY (user_id, type)
+);
+
+-- notification emails waiting to be sent; failed sends are retried with
+-- backoff until attempts run out
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    agreement_id INT REFERENCES agreements(id) ON DELETE CASCADE,
+    data JSONB NOT NULL DEFAULT '{}',
+
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error TEXT NOT NULL DEFAULT '',
+    sent_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_email_outbox_due ON email_outbox (next_attempt_at)
+    WHERE sent_at IS NULL AND failed_at IS NULL;